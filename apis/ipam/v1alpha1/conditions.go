@@ -28,12 +28,19 @@ import (
 const (
 	// A ConditionKindAllocationReady indicates whether the allocation is ready.
 	ConditionKindReady nddv1.ConditionKind = "Ready"
+	// A ConditionKindCapacityLow indicates whether the utilisation of an ip
+	// prefix exceeds its capacity thresholds.
+	ConditionKindCapacityLow nddv1.ConditionKind = "CapacityLow"
 )
 
 // ConditionReasons a package is or is not installed.
 const (
 	ConditionReasonReady    nddv1.ConditionReason = "Ready"
 	ConditionReasonNotReady nddv1.ConditionReason = "NotReady"
+
+	ConditionReasonCapacityOk       nddv1.ConditionReason = "CapacityOk"
+	ConditionReasonCapacityWarning  nddv1.ConditionReason = "CapacityWarning"
+	ConditionReasonCapacityCritical nddv1.ConditionReason = "CapacityCritical"
 )
 
 // Ready indicates that the resource is ready.
@@ -55,3 +62,35 @@ func NotReady() nddv1.Condition {
 		Reason:             ConditionReasonNotReady,
 	}
 }
+
+// CapacityOk indicates that the utilisation is below the capacity thresholds.
+func CapacityOk() nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindCapacityLow,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonCapacityOk,
+	}
+}
+
+// CapacityWarning indicates that the utilisation exceeds the warning threshold.
+func CapacityWarning(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindCapacityLow,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonCapacityWarning,
+		Message:            msg,
+	}
+}
+
+// CapacityCritical indicates that the utilisation exceeds the critical threshold.
+func CapacityCritical(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindCapacityLow,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonCapacityCritical,
+		Message:            msg,
+	}
+}
@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	"reflect"
+	"time"
 
 	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
 	"github.com/yndd/ndd-runtime/pkg/resource"
@@ -63,11 +64,14 @@ type In interface {
 	GetDescription() string
 	GetAllocationStrategy() string
 	GetDefaultPrefixLength(string, string) *uint32
+	GetCapacityThreshold() *IpamCapacityThreshold
+	GetQuarantinePeriod() time.Duration
 	GetTags() map[string]string
 	InitializeResource() error
 	SetStatus(string)
 	SetReason(string)
 	GetStatus() string
+	GetReason() string
 
 	SetOrganization(string)
 	SetDeployment(string)
@@ -139,6 +143,20 @@ func (x *IpamNetworkInstance) GetDefaultPrefixLength(p, af string) *uint32 {
 	return nil
 }
 
+func (x *IpamNetworkInstance) GetCapacityThreshold() *IpamCapacityThreshold {
+	if reflect.ValueOf(x.Spec.IpamNetworkInstance.CapacityThreshold).IsZero() {
+		return &IpamCapacityThreshold{}
+	}
+	return x.Spec.IpamNetworkInstance.CapacityThreshold
+}
+
+func (x *IpamNetworkInstance) GetQuarantinePeriod() time.Duration {
+	if reflect.ValueOf(x.Spec.IpamNetworkInstance.QuarantinePeriod).IsZero() {
+		return 0
+	}
+	return x.Spec.IpamNetworkInstance.QuarantinePeriod.Duration
+}
+
 func (x *IpamNetworkInstance) GetTags() map[string]string {
 	s := make(map[string]string)
 	if reflect.ValueOf(x.Spec.IpamNetworkInstance.Tag).IsZero() {
@@ -198,6 +216,13 @@ func (x *IpamNetworkInstance) GetStatus() string {
 	return "unknown"
 }
 
+func (x *IpamNetworkInstance) GetReason() string {
+	if x.Status.IpamNetworkInstance != nil && x.Status.IpamNetworkInstance.State != nil && x.Status.IpamNetworkInstance.State.Reason != nil {
+		return *x.Status.IpamNetworkInstance.State.Reason
+	}
+	return ""
+}
+
 func (x *IpamNetworkInstance) SetOrganization(s string) {
 	x.Status.SetOrganization(s)
 }
@@ -41,6 +41,12 @@ type IpamIpamNetworkInstance struct {
 	// +kubebuilder:default:="first-available"
 	AllocationStrategy  *string                                                `json:"allocation-strategy,omitempty"`
 	DefaultPrefixLength map[string]*IpamIpamNetworkInstanceDefaultPrefixLength `json:"default-prefix-length,omitempty"`
+	// CapacityThreshold is the default for the ip prefixes of the network instance
+	CapacityThreshold *IpamCapacityThreshold `json:"capacity-threshold,omitempty"`
+	// QuarantinePeriod is the time a released prefix is held before it is
+	// allocated again, except to an allocation with the same selector and
+	// source-tag; released prefixes are reused immediately when not set
+	QuarantinePeriod *metav1.Duration `json:"quarantine-period,omitempty"`
 	// kubebuilder:validation:MinLength=1
 	// kubebuilder:validation:MaxLength=255
 	// +kubebuilder:validation:Required
@@ -59,6 +65,17 @@ type IpamIpamNetworkInstanceDefaultPrefixLength struct {
 	AddressFamily map[string]*uint32 `json:"address-family,omitempty"`
 }
 
+// IpamCapacityThreshold defines the utilisation in percent above which the
+// capacity of an ip prefix is reported low
+type IpamCapacityThreshold struct {
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Warning *uint32 `json:"warning,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Critical *uint32 `json:"critical,omitempty"`
+}
+
 // A IpamSpec defines the desired state of a Ipam.
 type IpamNetworkInstanceSpec struct {
 	//nddov1.OdaInfo      `json:",inline"`
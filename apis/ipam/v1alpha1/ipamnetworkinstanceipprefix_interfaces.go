@@ -61,8 +61,15 @@ type Ipp interface {
 	GetNetworkInstanceName() string
 	GetIpPrefixName() string
 	GetIpPrefix() string
+	HasParent() bool
+	GetParentSelector() map[string]string
+	GetParentPrefixLength() uint32
+	GetAutoExpand() *IpamAutoExpand
 	GetPool() bool
 	GetAdminState() string
+	GetLifecycle() string
+	GetMigrate() bool
+	GetDeletionPolicy() string
 	GetDescription() string
 	GetTags() map[string]string
 	InitializeResource() error
@@ -70,6 +77,10 @@ type Ipp interface {
 	SetReason(string)
 	GetStatus() string
 	GetAllocatedPrefixes() uint32
+	GetCapacityThreshold() *IpamCapacityThreshold
+	SetCapacity(utilisation uint32, exhaustion string)
+	SetTenants(tenants []*NddrIpamIpamNetworkInstanceIpPrefixStateTenant)
+	SetExpansions(names []string)
 
 	SetOrganization(string)
 	SetDeployment(string)
@@ -78,6 +89,8 @@ type Ipp interface {
 	SetNetworkInstanceName(string)
 	SetIpPrefixName(string)
 	SetAddressFamily(string)
+	SetIpPrefix(string)
+	SetHierarchy(parent string, children []string)
 }
 
 // GetCondition of this Network Node.
@@ -114,13 +127,85 @@ func (x *IpamNetworkInstanceIpPrefix) GetIpPrefixName() string {
 	return odns.Name2OdnsRegistryNi(x.GetName()).GetResourceName()
 }
 
+// GetIpPrefix returns the prefix of the spec, or the prefix carved out of the
+// parent pool when the spec requests it from a parent
 func (x *IpamNetworkInstanceIpPrefix) GetIpPrefix() string {
 	if reflect.ValueOf(x.Spec.IpamNetworkInstanceIpPrefix.Prefix).IsZero() {
+		if x.Status.IpamNetworkInstanceIpPrefix != nil && x.Status.IpamNetworkInstanceIpPrefix.Prefix != nil {
+			return *x.Status.IpamNetworkInstanceIpPrefix.Prefix
+		}
 		return ""
 	}
 	return *x.Spec.IpamNetworkInstanceIpPrefix.Prefix
 }
 
+func (x *IpamNetworkInstanceIpPrefix) HasParent() bool {
+	return x.Spec.IpamNetworkInstanceIpPrefix != nil && x.Spec.IpamNetworkInstanceIpPrefix.Parent != nil
+}
+
+func (x *IpamNetworkInstanceIpPrefix) GetParentSelector() map[string]string {
+	s := make(map[string]string)
+	if !x.HasParent() {
+		return s
+	}
+	for _, tag := range x.Spec.IpamNetworkInstanceIpPrefix.Parent.Selector {
+		s[*tag.Key] = *tag.Value
+	}
+	return s
+}
+
+func (x *IpamNetworkInstanceIpPrefix) GetParentPrefixLength() uint32 {
+	if !x.HasParent() || x.Spec.IpamNetworkInstanceIpPrefix.Parent.PrefixLength == nil {
+		return 0
+	}
+	return *x.Spec.IpamNetworkInstanceIpPrefix.Parent.PrefixLength
+}
+
+// GetAutoExpand returns the auto-expand policy, nil indicates the ip prefix is
+// not expanded
+func (x *IpamNetworkInstanceIpPrefix) GetAutoExpand() *IpamAutoExpand {
+	if x.Spec.IpamNetworkInstanceIpPrefix == nil {
+		return nil
+	}
+	return x.Spec.IpamNetworkInstanceIpPrefix.AutoExpand
+}
+
+// default auto-expand policy
+const (
+	DefaultExpandThreshold = 90
+	DefaultMaxExpansions   = 4
+)
+
+// GetSelector returns the selector of the aggregate the expansions are carved
+// out of
+func (x *IpamAutoExpand) GetSelector() map[string]string {
+	s := make(map[string]string)
+	for _, tag := range x.Selector {
+		if tag.Key != nil && tag.Value != nil {
+			s[*tag.Key] = *tag.Value
+		}
+	}
+	return s
+}
+
+// GetThreshold returns the utilisation in percent from which the ip prefix is
+// expanded, falling back to the default
+func (x *IpamAutoExpand) GetThreshold() uint32 {
+	if x.Threshold == nil {
+		return DefaultExpandThreshold
+	}
+	return *x.Threshold
+}
+
+// GetMaxExpansions returns the maximum number of expansions of the ip prefix,
+// falling back to the default
+func (x *IpamAutoExpand) GetMaxExpansions() uint32 {
+	if x.MaxExpansions == nil {
+		return DefaultMaxExpansions
+	}
+	return *x.MaxExpansions
+}
+
 func (x *IpamNetworkInstanceIpPrefix) GetPool() bool {
 	if reflect.ValueOf(x.Spec.IpamNetworkInstanceIpPrefix.Pool).IsZero() {
 		return false
@@ -135,6 +220,27 @@ func (x *IpamNetworkInstanceIpPrefix) GetAdminState() string {
 	return *x.Spec.IpamNetworkInstanceIpPrefix.AdminState
 }
 
+func (x *IpamNetworkInstanceIpPrefix) GetLifecycle() string {
+	if reflect.ValueOf(x.Spec.IpamNetworkInstanceIpPrefix.Lifecycle).IsZero() {
+		return LifecycleActive
+	}
+	return *x.Spec.IpamNetworkInstanceIpPrefix.Lifecycle
+}
+
+func (x *IpamNetworkInstanceIpPrefix) GetMigrate() bool {
+	if reflect.ValueOf(x.Spec.IpamNetworkInstanceIpPrefix.Migrate).IsZero() {
+		return false
+	}
+	return *x.Spec.IpamNetworkInstanceIpPrefix.Migrate
+}
+
+func (x *IpamNetworkInstanceIpPrefix) GetDeletionPolicy() string {
+	if reflect.ValueOf(x.Spec.IpamNetworkInstanceIpPrefix.DeletionPolicy).IsZero() {
+		return DeletionPolicyBlock
+	}
+	return *x.Spec.IpamNetworkInstanceIpPrefix.DeletionPolicy
+}
+
 func (x *IpamNetworkInstanceIpPrefix) GetDescription() string {
 	if reflect.ValueOf(x.Spec.IpamNetworkInstanceIpPrefix.Description).IsZero() {
 		return ""
@@ -167,7 +273,10 @@ func (x *IpamNetworkInstanceIpPrefix) InitializeResource() error {
 		// copy the spec, but not the state
 		x.Status.IpamNetworkInstanceIpPrefix.AdminState = x.Spec.IpamNetworkInstanceIpPrefix.AdminState
 		x.Status.IpamNetworkInstanceIpPrefix.Description = x.Spec.IpamNetworkInstanceIpPrefix.Description
-		x.Status.IpamNetworkInstanceIpPrefix.Prefix = x.Spec.IpamNetworkInstanceIpPrefix.Prefix
+		// a prefix carved out of a parent pool is only known by the status
+		if !x.HasParent() {
+			x.Status.IpamNetworkInstanceIpPrefix.Prefix = x.Spec.IpamNetworkInstanceIpPrefix.Prefix
+		}
 		x.Status.IpamNetworkInstanceIpPrefix.Pool = x.Spec.IpamNetworkInstanceIpPrefix.Pool
 		x.Status.IpamNetworkInstanceIpPrefix.Tag = tags
 		return nil
@@ -213,6 +322,34 @@ func (x *IpamNetworkInstanceIpPrefix) GetAllocatedPrefixes() uint32 {
 	return 0
 }
 
+func (x *IpamNetworkInstanceIpPrefix) GetCapacityThreshold() *IpamCapacityThreshold {
+	if reflect.ValueOf(x.Spec.IpamNetworkInstanceIpPrefix.CapacityThreshold).IsZero() {
+		return &IpamCapacityThreshold{}
+	}
+	return x.Spec.IpamNetworkInstanceIpPrefix.CapacityThreshold
+}
+
+// SetCapacity sets the utilisation in percent and the projected exhaustion
+// time, an empty exhaustion indicates no exhaustion is projected
+func (x *IpamNetworkInstanceIpPrefix) SetCapacity(utilisation uint32, exhaustion string) {
+	x.Status.IpamNetworkInstanceIpPrefix.State.Utilisation = &utilisation
+	if exhaustion == "" {
+		x.Status.IpamNetworkInstanceIpPrefix.State.ProjectedExhaustion = nil
+		return
+	}
+	x.Status.IpamNetworkInstanceIpPrefix.State.ProjectedExhaustion = &exhaustion
+}
+
+func (x *IpamNetworkInstanceIpPrefix) SetTenants(tenants []*NddrIpamIpamNetworkInstanceIpPrefixStateTenant) {
+	x.Status.IpamNetworkInstanceIpPrefix.State.Tenants = tenants
+}
+
+// SetExpansions records the names of the ip prefixes carved out of the
+// aggregate of the auto-expand policy
+func (x *IpamNetworkInstanceIpPrefix) SetExpansions(names []string) {
+	x.Status.IpamNetworkInstanceIpPrefix.State.Expansions = names
+}
+
 func (x *IpamNetworkInstanceIpPrefix) SetOrganization(s string) {
 	x.Status.SetOrganization(s)
 }
@@ -237,6 +374,29 @@ func (x *IpamNetworkInstanceIpPrefix) SetIpPrefixName(s string) {
 	x.Status.IpPrefixName = &s
 }
 
+// SetIpPrefix records the prefix carved out of the parent pool
+func (x *IpamNetworkInstanceIpPrefix) SetIpPrefix(s string) {
+	x.Status.IpamNetworkInstanceIpPrefix.Prefix = &s
+}
+
+// SetHierarchy records the parent pool the prefix is part of and the pools
+// that are part of the prefix, an empty parent indicates a top level pool
+func (x *IpamNetworkInstanceIpPrefix) SetHierarchy(parent string, children []string) {
+	state := x.Status.IpamNetworkInstanceIpPrefix.State
+	state.Parent = &NddrIpamIpamNetworkInstanceIpPrefixStateParent{}
+	if parent != "" {
+		state.Parent.IpPrefix = []*NddrIpamIpamNetworkInstanceIpPrefixStateParentIpPrefix{
+			{Prefix: utils.StringPtr(parent)},
+		}
+	}
+	state.Child = &NddrIpamIpamNetworkInstanceIpPrefixStateChild{}
+	for _, child := range children {
+		state.Child.IpPrefix = append(state.Child.IpPrefix, &NddrIpamIpamNetworkInstanceIpPrefixStateChildIpPrefix{
+			Prefix: utils.StringPtr(child),
+		})
+	}
+}
+
 func (x *IpamNetworkInstanceIpPrefix) SetAddressFamily(s string) {
 	for _, tag := range x.Status.IpamNetworkInstanceIpPrefix.State.Tag {
 		if *tag.Key == KeyAddressFamily {
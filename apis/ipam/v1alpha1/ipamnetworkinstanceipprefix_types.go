@@ -45,9 +45,62 @@ type IpamIpamNetworkInstanceIpPrefix struct {
 	Pool        *bool   `json:"pool,omitempty"`
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:validation:Pattern=`(([0-9]|[1-9][0-9]|1[0-9][0-9]|2[0-4][0-9]|25[0-5])\.){3}([0-9]|[1-9][0-9]|1[0-9][0-9]|2[0-4][0-9]|25[0-5])/(([0-9])|([1-2][0-9])|(3[0-2]))|((:|[0-9a-fA-F]{0,4}):)([0-9a-fA-F]{0,4}:){0,5}((([0-9a-fA-F]{0,4}:)?(:|[0-9a-fA-F]{0,4}))|(((25[0-5]|2[0-4][0-9]|[01]?[0-9]?[0-9])\.){3}(25[0-5]|2[0-4][0-9]|[01]?[0-9]?[0-9])))(/(([0-9])|([0-9]{2})|(1[0-1][0-9])|(12[0-8])))`
-	Prefix *string `json:"prefix"`
+	Prefix *string `json:"prefix,omitempty"`
+	// Parent requests the prefix from a parent pool instead of providing it,
+	// the allocated prefix is reported in the status
+	Parent *IpamIpamNetworkInstanceIpPrefixParent `json:"parent,omitempty"`
+	// AutoExpand carves additional ip prefixes out of an aggregate when the
+	// ip prefix runs out of addresses
+	AutoExpand *IpamAutoExpand `json:"auto-expand,omitempty"`
 	//RirName *string                                 `json:"rir-name,omitempty"`
 	Tag []*nddov1.Tag `json:"tag,omitempty"`
+	// CapacityThreshold overwrites the default of the network instance
+	CapacityThreshold *IpamCapacityThreshold `json:"capacity-threshold,omitempty"`
+	// Lifecycle of the ip prefix, no new allocations are made from a draining
+	// ip prefix while its existing allocations remain valid
+	// +kubebuilder:validation:Enum=`active`;`draining`
+	// +kubebuilder:default:="active"
+	Lifecycle *string `json:"lifecycle,omitempty"`
+	// Migrate reallocates the registers of a draining ip prefix into the other
+	// ip prefixes matching their selector
+	Migrate *bool `json:"migrate,omitempty"`
+	// DeletionPolicy determines if the deletion of the ip prefix is blocked
+	// while it has allocations or releases its allocations
+	// +kubebuilder:validation:Enum=`block`;`cascade`
+	// +kubebuilder:default:="block"
+	DeletionPolicy *string `json:"deletion-policy,omitempty"`
+}
+
+// IpamIpamNetworkInstanceIpPrefixParent selects the parent pool the prefix is
+// carved out of
+type IpamIpamNetworkInstanceIpPrefixParent struct {
+	// Selector matches the tags of the parent pool, it includes the
+	// address-family
+	Selector []*nddov1.Tag `json:"selector,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=128
+	PrefixLength *uint32 `json:"prefix-length"`
+}
+
+// IpamAutoExpand defines when an ip prefix is expanded and the aggregate the
+// expansions are carved out of
+type IpamAutoExpand struct {
+	// Selector matches the tags of the aggregate, it includes the
+	// address-family
+	Selector []*nddov1.Tag `json:"selector,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=128
+	PrefixLength *uint32 `json:"prefix-length"`
+	// Threshold is the utilisation in percent from which the ip prefix is
+	// expanded
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default:=90
+	Threshold *uint32 `json:"threshold,omitempty"`
+	// MaxExpansions limits the number of expansions of the ip prefix
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=4
+	MaxExpansions *uint32 `json:"max-expansions,omitempty"`
 }
 
 // A IpamNetworkInstanceIpPrefixSpec defines the desired state of a IpamNetworkInstanceIpPrefix.
@@ -83,6 +136,7 @@ type IpamNetworkInstanceIpPrefixStatus struct {
 // +kubebuilder:printcolumn:name="AF",type="string",JSONPath=".status.ip-prefix.state.tag[?(@.key=='address-family')].value"
 // +kubebuilder:printcolumn:name="PURPOSE",type="string",JSONPath=".spec.ip-prefix.tag[?(@.key=='purpose')].value"
 // +kubebuilder:printcolumn:name="STATUS",type="string",JSONPath=".status.ip-prefix.state.status"
+// +kubebuilder:printcolumn:name="UTIL",type="integer",JSONPath=".status.ip-prefix.state.utilisation"
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 type IpamNetworkInstanceIpPrefix struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -0,0 +1,148 @@
+/*
+Copyright 2021 NDDO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"sort"
+
+	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
+	"github.com/yndd/ndd-runtime/pkg/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ PuList = &IpamPurposeList{}
+
+// +k8s:deepcopy-gen=false
+type PuList interface {
+	client.ObjectList
+
+	GetPurposes() []Pu
+}
+
+func (x *IpamPurposeList) GetPurposes() []Pu {
+	xs := make([]Pu, len(x.Items))
+	for i, r := range x.Items {
+		r := r // Pin range variable so we can take its address.
+		xs[i] = &r
+	}
+	return xs
+}
+
+var _ Pu = &IpamPurpose{}
+
+// +k8s:deepcopy-gen=false
+type Pu interface {
+	resource.Object
+	resource.Conditioned
+
+	GetCondition(ct nddv1.ConditionKind) nddv1.Condition
+	SetConditions(c ...nddv1.Condition)
+	GetPurposeName() string
+	GetAddressFamilies() []string
+	HasAddressFamily(af string) bool
+	GetDefaultPrefixLength(af string) *uint32
+	GetMinPrefixLength(af string) *uint32
+	GetMaxPrefixLength(af string) *uint32
+	GetAllocationStrategy() string
+	GetReusePolicy() string
+	GetDescription() string
+}
+
+// GetCondition of this Network Node.
+func (x *IpamPurpose) GetCondition(ct nddv1.ConditionKind) nddv1.Condition {
+	return x.Status.GetCondition(ct)
+}
+
+// SetConditions of the Network Node.
+func (x *IpamPurpose) SetConditions(c ...nddv1.Condition) {
+	x.Status.SetConditions(c...)
+}
+
+// GetPurposeName returns the purpose, which is the name of the resource
+func (x *IpamPurpose) GetPurposeName() string {
+	return x.GetName()
+}
+
+func (x *IpamPurpose) GetAddressFamilies() []string {
+	afs := make([]string, 0)
+	if reflect.ValueOf(x.Spec.Purpose).IsZero() {
+		return afs
+	}
+	for af := range x.Spec.Purpose.AddressFamily {
+		afs = append(afs, af)
+	}
+	sort.Strings(afs)
+	return afs
+}
+
+func (x *IpamPurpose) HasAddressFamily(af string) bool {
+	if reflect.ValueOf(x.Spec.Purpose).IsZero() {
+		return false
+	}
+	_, ok := x.Spec.Purpose.AddressFamily[af]
+	return ok
+}
+
+func (x *IpamPurpose) getPrefixLength(af string) *IpamIpamPurposePrefixLength {
+	if reflect.ValueOf(x.Spec.Purpose).IsZero() {
+		return nil
+	}
+	return x.Spec.Purpose.AddressFamily[af]
+}
+
+func (x *IpamPurpose) GetDefaultPrefixLength(af string) *uint32 {
+	if pl := x.getPrefixLength(af); pl != nil {
+		return pl.Default
+	}
+	return nil
+}
+
+func (x *IpamPurpose) GetMinPrefixLength(af string) *uint32 {
+	if pl := x.getPrefixLength(af); pl != nil {
+		return pl.Min
+	}
+	return nil
+}
+
+func (x *IpamPurpose) GetMaxPrefixLength(af string) *uint32 {
+	if pl := x.getPrefixLength(af); pl != nil {
+		return pl.Max
+	}
+	return nil
+}
+
+func (x *IpamPurpose) GetAllocationStrategy() string {
+	if reflect.ValueOf(x.Spec.Purpose).IsZero() || reflect.ValueOf(x.Spec.Purpose.AllocationStrategy).IsZero() {
+		return ""
+	}
+	return *x.Spec.Purpose.AllocationStrategy
+}
+
+func (x *IpamPurpose) GetReusePolicy() string {
+	if reflect.ValueOf(x.Spec.Purpose).IsZero() || reflect.ValueOf(x.Spec.Purpose.ReusePolicy).IsZero() {
+		return ReusePolicyQuarantine
+	}
+	return *x.Spec.Purpose.ReusePolicy
+}
+
+func (x *IpamPurpose) GetDescription() string {
+	if reflect.ValueOf(x.Spec.Purpose).IsZero() || reflect.ValueOf(x.Spec.Purpose.Description).IsZero() {
+		return ""
+	}
+	return *x.Spec.Purpose.Description
+}
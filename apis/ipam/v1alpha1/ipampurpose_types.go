@@ -0,0 +1,108 @@
+/*
+Copyright 2021 NDDO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+
+	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// IpamIpamPurpose defines how the prefixes of a purpose are allocated, the
+// purpose is referenced by the purpose tag of the ip prefixes and the purpose
+// selector of the registers
+type IpamIpamPurpose struct {
+	// AddressFamily defines the prefix lengths per address family, only the
+	// listed address families can be allocated for the purpose
+	AddressFamily map[string]*IpamIpamPurposePrefixLength `json:"address-family,omitempty"`
+	// AllocationStrategy overrides the allocation strategy of the network
+	// instance for the purpose
+	// +kubebuilder:validation:Enum=`first-available`;`deterministic`
+	AllocationStrategy *string `json:"allocation-strategy,omitempty"`
+	// ReusePolicy determines if a released prefix is held for the quarantine
+	// period of the network instance or reused immediately
+	// +kubebuilder:validation:Enum=`quarantine`;`immediate`
+	// +kubebuilder:default:="quarantine"
+	ReusePolicy *string `json:"reuse-policy,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+// IpamIpamPurposePrefixLength defines the prefix lengths of an address family,
+// the default is used when the network instance has no default prefix length
+// for the purpose
+type IpamIpamPurposePrefixLength struct {
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=128
+	Default *uint32 `json:"default,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=128
+	Min *uint32 `json:"min,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=128
+	Max *uint32 `json:"max,omitempty"`
+}
+
+// A IpamPurposeSpec defines the desired state of a IpamPurpose.
+type IpamPurposeSpec struct {
+	Purpose *IpamIpamPurpose `json:"purpose,omitempty"`
+}
+
+// A IpamPurposeStatus represents the observed state of a IpamPurpose.
+type IpamPurposeStatus struct {
+	nddv1.ConditionedStatus `json:",inline"`
+}
+
+// +kubebuilder:object:root=true
+
+// IpamPurpose is the Schema for the IpamPurpose API
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="SYNC",type="string",JSONPath=".status.conditions[?(@.kind=='Synced')].status"
+// +kubebuilder:printcolumn:name="STATUS",type="string",JSONPath=".status.conditions[?(@.kind=='Ready')].status"
+// +kubebuilder:printcolumn:name="STRATEGY",type="string",JSONPath=".spec.purpose.allocation-strategy"
+// +kubebuilder:printcolumn:name="REUSE",type="string",JSONPath=".spec.purpose.reuse-policy"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+type IpamPurpose struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IpamPurposeSpec   `json:"spec,omitempty"`
+	Status IpamPurposeStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IpamPurposeList contains a list of IpamPurposes
+type IpamPurposeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IpamPurpose `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IpamPurpose{}, &IpamPurposeList{})
+}
+
+// IpamPurpose type metadata.
+var (
+	IpamPurposeKindKind         = reflect.TypeOf(IpamPurpose{}).Name()
+	IpamPurposeGroupKind        = schema.GroupKind{Group: Group, Kind: IpamPurposeKindKind}.String()
+	IpamPurposeKindAPIVersion   = IpamPurposeKindKind + "." + GroupVersion.String()
+	IpamPurposeGroupVersionKind = GroupVersion.WithKind(IpamPurposeKindKind)
+)
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 NDDO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+
+	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
+	"github.com/yndd/ndd-runtime/pkg/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ QuList = &IpamQuotaList{}
+
+// +k8s:deepcopy-gen=false
+type QuList interface {
+	client.ObjectList
+
+	GetQuotas() []Qu
+}
+
+func (x *IpamQuotaList) GetQuotas() []Qu {
+	xs := make([]Qu, len(x.Items))
+	for i, r := range x.Items {
+		r := r // Pin range variable so we can take its address.
+		xs[i] = &r
+	}
+	return xs
+}
+
+var _ Qu = &IpamQuota{}
+
+// +k8s:deepcopy-gen=false
+type Qu interface {
+	resource.Object
+	resource.Conditioned
+
+	GetCondition(ct nddv1.ConditionKind) nddv1.Condition
+	SetConditions(c ...nddv1.Condition)
+	GetPurpose() string
+	GetSourceTag() map[string]string
+	GetMaxAllocations() *uint32
+	GetMaxAddresses() *uint64
+	GetDescription() string
+	SetUsed(allocations uint32, addresses uint64)
+}
+
+// GetCondition of this Network Node.
+func (x *IpamQuota) GetCondition(ct nddv1.ConditionKind) nddv1.Condition {
+	return x.Status.GetCondition(ct)
+}
+
+// SetConditions of the Network Node.
+func (x *IpamQuota) SetConditions(c ...nddv1.Condition) {
+	x.Status.SetConditions(c...)
+}
+
+func (x *IpamQuota) GetPurpose() string {
+	if reflect.ValueOf(x.Spec.Quota).IsZero() || reflect.ValueOf(x.Spec.Quota.Purpose).IsZero() {
+		return ""
+	}
+	return *x.Spec.Quota.Purpose
+}
+
+func (x *IpamQuota) GetSourceTag() map[string]string {
+	s := make(map[string]string)
+	if reflect.ValueOf(x.Spec.Quota).IsZero() {
+		return s
+	}
+	for _, tag := range x.Spec.Quota.SourceTag {
+		if tag.Key != nil && tag.Value != nil {
+			s[*tag.Key] = *tag.Value
+		}
+	}
+	return s
+}
+
+func (x *IpamQuota) GetMaxAllocations() *uint32 {
+	if reflect.ValueOf(x.Spec.Quota).IsZero() {
+		return nil
+	}
+	return x.Spec.Quota.MaxAllocations
+}
+
+func (x *IpamQuota) GetMaxAddresses() *uint64 {
+	if reflect.ValueOf(x.Spec.Quota).IsZero() {
+		return nil
+	}
+	return x.Spec.Quota.MaxAddresses
+}
+
+func (x *IpamQuota) GetDescription() string {
+	if reflect.ValueOf(x.Spec.Quota).IsZero() || reflect.ValueOf(x.Spec.Quota.Description).IsZero() {
+		return ""
+	}
+	return *x.Spec.Quota.Description
+}
+
+// SetUsed reports the number of allocations and addresses counted against
+// the quota
+func (x *IpamQuota) SetUsed(allocations uint32, addresses uint64) {
+	x.Status.Used = &IpamQuotaUsage{
+		Allocations: &allocations,
+		Addresses:   &addresses,
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2021 NDDO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+
+	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
+	nddov1 "github.com/yndd/nddo-runtime/apis/common/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// IpamIpamQuota limits the allocations of the registers in the namespace of
+// the quota, the purpose and the source-tag narrow the allocations the quota
+// applies to
+type IpamIpamQuota struct {
+	// Purpose limits the quota to the allocations of the purpose, the quota
+	// applies to all purposes when not provided
+	Purpose *string `json:"purpose,omitempty"`
+	// SourceTag limits the quota to the allocations with the source-tag
+	SourceTag []*nddov1.Tag `json:"source-tag,omitempty"`
+	// MaxAllocations limits the number of allocations
+	// +kubebuilder:validation:Minimum=0
+	MaxAllocations *uint32 `json:"max-allocations,omitempty"`
+	// MaxAddresses limits the total number of addresses of the allocations
+	// +kubebuilder:validation:Minimum=0
+	MaxAddresses *uint64 `json:"max-addresses,omitempty"`
+	Description  *string `json:"description,omitempty"`
+}
+
+// IpamQuotaUsage is the usage of a quota
+type IpamQuotaUsage struct {
+	Allocations *uint32 `json:"allocations,omitempty"`
+	Addresses   *uint64 `json:"addresses,omitempty"`
+}
+
+// A IpamQuotaSpec defines the desired state of a IpamQuota.
+type IpamQuotaSpec struct {
+	Quota *IpamIpamQuota `json:"quota,omitempty"`
+}
+
+// A IpamQuotaStatus represents the observed state of a IpamQuota.
+type IpamQuotaStatus struct {
+	nddv1.ConditionedStatus `json:",inline"`
+	// Used is the usage of the quota
+	Used *IpamQuotaUsage `json:"used,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IpamQuota is the Schema for the IpamQuota API
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="SYNC",type="string",JSONPath=".status.conditions[?(@.kind=='Synced')].status"
+// +kubebuilder:printcolumn:name="STATUS",type="string",JSONPath=".status.conditions[?(@.kind=='Ready')].status"
+// +kubebuilder:printcolumn:name="PURPOSE",type="string",JSONPath=".spec.quota.purpose"
+// +kubebuilder:printcolumn:name="ALLOCATIONS",type="integer",JSONPath=".status.used.allocations"
+// +kubebuilder:printcolumn:name="MAX-ALLOCATIONS",type="integer",JSONPath=".spec.quota.max-allocations"
+// +kubebuilder:printcolumn:name="ADDRESSES",type="integer",JSONPath=".status.used.addresses"
+// +kubebuilder:printcolumn:name="MAX-ADDRESSES",type="integer",JSONPath=".spec.quota.max-addresses"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+type IpamQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IpamQuotaSpec   `json:"spec,omitempty"`
+	Status IpamQuotaStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IpamQuotaList contains a list of IpamQuotas
+type IpamQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IpamQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IpamQuota{}, &IpamQuotaList{})
+}
+
+// IpamQuota type metadata.
+var (
+	IpamQuotaKindKind         = reflect.TypeOf(IpamQuota{}).Name()
+	IpamQuotaGroupKind        = schema.GroupKind{Group: Group, Kind: IpamQuotaKindKind}.String()
+	IpamQuotaKindAPIVersion   = IpamQuotaKindKind + "." + GroupVersion.String()
+	IpamQuotaGroupVersionKind = GroupVersion.WithKind(IpamQuotaKindKind)
+)
@@ -20,7 +20,9 @@ import (
 
 	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
 	"github.com/yndd/ndd-runtime/pkg/resource"
+	nddov1 "github.com/yndd/nddo-runtime/apis/common/v1"
 	"github.com/yndd/nddo-runtime/pkg/odns"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -57,12 +59,21 @@ type Rr interface {
 	GetIpamName() string
 	GetNetworkInstanceName() string
 	GetIpPrefix() string
+	GetConsumer() *ConsumerReference
 	//GetPrefixLength() *uint32
 	GetAddressFamily() string
 	GetSourceTag() map[string]string
 	GetSelector() map[string]string
+	GetAllocatedSelector() map[string]string
+	GetAllocatedSourceTag() map[string]string
+	GetMatchExpressions() []metav1.LabelSelectorRequirement
+	GetAllocatedMatchExpressions() []metav1.LabelSelectorRequirement
 	SetIpPrefix(p string)
 	HasIpPrefix() (string, bool)
+	GetMigratedFrom() string
+	SetMigratedFrom(p string)
+	GetRequestId() string
+	SetRequestId(id string)
 	SetOrganization(string)
 	SetDeployment(string)
 	SetAvailabilityZone(s string)
@@ -93,11 +104,23 @@ func (x *Register) GetAvailabilityZone() string {
 }
 
 func (x *Register) GetIpamName() string {
-	return odns.Name2OdnsRegistryNi(x.GetName()).GetRegistryName()
+	if reflect.ValueOf(x.Spec.RegistryName).IsZero() {
+		return odns.Name2OdnsRegistryNi(x.GetName()).GetRegistryName()
+	}
+	return *x.Spec.RegistryName
 }
 
 func (x *Register) GetNetworkInstanceName() string {
-	return odns.Name2OdnsRegistryNi(x.GetName()).GetNetworkInstanceName()
+	if reflect.ValueOf(x.Spec.NetworkInstanceName).IsZero() {
+		return odns.Name2OdnsRegistryNi(x.GetName()).GetNetworkInstanceName()
+	}
+	return *x.Spec.NetworkInstanceName
+}
+
+// GetConsumer returns the consumer of the register, nil when the register has
+// no consumer
+func (x *Register) GetConsumer() *ConsumerReference {
+	return x.Spec.Consumer
 }
 
 func (x *Register) GetIpPrefix() string {
@@ -136,16 +159,136 @@ func (x *Register) GetSelector() map[string]string {
 	return s
 }
 
+// GetAllocatedSelector returns the selector the ip prefix in the status was
+// allocated for
+func (x *Register) GetAllocatedSelector() map[string]string {
+	s := make(map[string]string)
+	if x.Status.Register == nil || x.Status.Register.State == nil {
+		return s
+	}
+	for _, tag := range x.Status.Register.State.Selector {
+		s[*tag.Key] = *tag.Value
+	}
+	return s
+}
+
+// GetAllocatedSourceTag returns the source-tag the ip prefix in the status was
+// allocated for
+func (x *Register) GetAllocatedSourceTag() map[string]string {
+	s := make(map[string]string)
+	if x.Status.Register == nil || x.Status.Register.State == nil {
+		return s
+	}
+	for _, tag := range x.Status.Register.State.SourceTag {
+		s[*tag.Key] = *tag.Value
+	}
+	return s
+}
+
+func (x *Register) GetMatchExpressions() []metav1.LabelSelectorRequirement {
+	if x.Spec.Register == nil {
+		return nil
+	}
+	return x.Spec.Register.MatchExpressions
+}
+
+// GetAllocatedMatchExpressions returns the match-expressions the ip prefix in
+// the status was allocated for
+func (x *Register) GetAllocatedMatchExpressions() []metav1.LabelSelectorRequirement {
+	if x.Status.Register == nil || x.Status.Register.State == nil {
+		return nil
+	}
+	return x.Status.Register.State.MatchExpressions
+}
+
+// SetIpPrefix records the allocated ip prefix in the status together with the
+// selector, source-tag and match-expressions of the spec it was allocated for
 func (x *Register) SetIpPrefix(p string) {
-	x.Status = RegisterStatus{
-		Register: &NddrIpamRegister{
-			State: &NddrRegisterState{
-				IpPrefix: &p,
-			},
+	var migratedFrom, requestId *string
+	if x.Status.Register != nil && x.Status.Register.State != nil {
+		migratedFrom = x.Status.Register.State.MigratedFrom
+		requestId = x.Status.Register.State.RequestId
+	}
+	x.Status.Register = &NddrIpamRegister{
+		State: &NddrRegisterState{
+			IpPrefix:         &p,
+			Selector:         copyTags(x.Spec.Register.Selector),
+			SourceTag:        copyTags(x.Spec.Register.SourceTag),
+			MatchExpressions: copyExpressions(x.Spec.Register.MatchExpressions),
+			MigratedFrom:     migratedFrom,
+			RequestId:        requestId,
 		},
 	}
 }
 
+func (x *Register) GetMigratedFrom() string {
+	if x.Status.Register != nil && x.Status.Register.State != nil && x.Status.Register.State.MigratedFrom != nil {
+		return *x.Status.Register.State.MigratedFrom
+	}
+	return ""
+}
+
+// SetMigratedFrom records the ip prefix the register was migrated from, it is
+// cleared with an empty prefix
+func (x *Register) SetMigratedFrom(p string) {
+	if x.Status.Register == nil || x.Status.Register.State == nil {
+		return
+	}
+	if p == "" {
+		x.Status.Register.State.MigratedFrom = nil
+		return
+	}
+	x.Status.Register.State.MigratedFrom = &p
+}
+
+// GetRequestId returns the idempotency key of the resource request the ip
+// prefix was allocated for, a register that is not allocated yet returns the
+// request id of its annotation
+func (x *Register) GetRequestId() string {
+	if x.Status.Register != nil && x.Status.Register.State != nil && x.Status.Register.State.RequestId != nil {
+		return *x.Status.Register.State.RequestId
+	}
+	return x.GetAnnotations()[AnnotationRequestId]
+}
+
+// SetRequestId records the idempotency key of the resource request in the
+// status, it is cleared with an empty request id
+func (x *Register) SetRequestId(id string) {
+	if x.Status.Register == nil || x.Status.Register.State == nil {
+		return
+	}
+	if id == "" {
+		x.Status.Register.State.RequestId = nil
+		return
+	}
+	x.Status.Register.State.RequestId = &id
+}
+
+func copyTags(tags []*nddov1.Tag) []*nddov1.Tag {
+	if len(tags) == 0 {
+		return nil
+	}
+	c := make([]*nddov1.Tag, 0, len(tags))
+	for _, tag := range tags {
+		c = append(c, &nddov1.Tag{
+			Key:   tag.Key,
+			Value: tag.Value,
+		})
+	}
+	return c
+}
+
+func copyExpressions(exprs []metav1.LabelSelectorRequirement) []metav1.LabelSelectorRequirement {
+	if len(exprs) == 0 {
+		return nil
+	}
+	c := make([]metav1.LabelSelectorRequirement, 0, len(exprs))
+	for _, expr := range exprs {
+		c = append(c, *expr.DeepCopy())
+	}
+	return c
+}
+
 func (x *Register) HasIpPrefix() (string, bool) {
 	if x.Status.Register != nil && x.Status.Register.State != nil && x.Status.Register.State.IpPrefix != nil {
 		return *x.Status.Register.State.IpPrefix, true
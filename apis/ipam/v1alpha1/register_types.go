@@ -34,6 +34,16 @@ type NddrIpamRegister struct {
 // NddrRegisterState struct
 type NddrRegisterState struct {
 	IpPrefix *string `json:"ip-prefix,omitempty"`
+	// the selector and source-tag the ip-prefix was allocated for
+	Selector         []*nddov1.Tag                     `json:"selector,omitempty"`
+	SourceTag        []*nddov1.Tag                     `json:"source-tag,omitempty"`
+	MatchExpressions []metav1.LabelSelectorRequirement `json:"match-expressions,omitempty"`
+	// MigratedFrom is the ip-prefix the register was migrated from when its
+	// ip prefix was drained
+	MigratedFrom *string `json:"migrated-from,omitempty"`
+	// RequestId is the idempotency key of the resource request the ip-prefix
+	// was allocated for
+	RequestId *string `json:"request-id,omitempty"`
 	//ExpiryTime *string `json:"expiry-time,omitempty"`
 }
 
@@ -48,14 +58,38 @@ type IpamRegister struct {
 	//PrefixLength *uint32       `json:"prefix-length,omitempty"`
 	Selector  []*nddov1.Tag `json:"selector,omitempty"`
 	SourceTag []*nddov1.Tag `json:"source-tag,omitempty"`
+	// MatchExpressions further restrict the pools the ip-prefix is allocated
+	// from, on top of the selector. The purpose and address-family can be
+	// selected with an In expression instead of the selector.
+	MatchExpressions []metav1.LabelSelectorRequirement `json:"match-expressions,omitempty"`
 }
 
 // A RegisterSpec defines the desired state of a Register.
 type RegisterSpec struct {
 	//nddov1.OdaInfo      `json:",inline"`
-	//RegistryName        *string       `json:"registry-name,omitempty"`
-	//NetworkInstanceName *string       `json:"network-instance-name,omitempty"`
-	Register *IpamRegister `json:"register,omitempty"`
+
+	// RegistryName and NetworkInstanceName reference the network instance the
+	// register allocates from, when not provided they are derived from the
+	// name of the register
+	RegistryName        *string       `json:"registry-name,omitempty"`
+	NetworkInstanceName *string       `json:"network-instance-name,omitempty"`
+	Register            *IpamRegister `json:"register,omitempty"`
+	// Consumer references the object the register allocates for, the prefix
+	// is released and the register deleted when the consumer is deleted
+	Consumer *ConsumerReference `json:"consumer,omitempty"`
+}
+
+// ConsumerReference references an object in the namespace of the register
+type ConsumerReference struct {
+	// +kubebuilder:validation:MinLength=1
+	ApiVersion *string `json:"api-version"`
+	// +kubebuilder:validation:MinLength=1
+	Kind *string `json:"kind"`
+	// +kubebuilder:validation:MinLength=1
+	Name *string `json:"name"`
+	// Uid of the consumer, when provided a consumer recreated with the same
+	// name is not the same consumer
+	Uid *string `json:"uid,omitempty"`
 }
 
 // A RegisterStatus represents the observed state of a Register.
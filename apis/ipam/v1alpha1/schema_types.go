@@ -90,7 +90,7 @@ type NddrIpamIpamNetworkInstanceIpPrefix struct {
 	AdminState  *string `json:"admin-state,omitempty"`
 	Description *string `json:"description,omitempty"`
 	Pool        *bool   `json:"pool,omitempty"`
-	Prefix      *string `json:"prefix"`
+	Prefix      *string `json:"prefix,omitempty"`
 	//RirName     *string                                   `json:"rir-name,omitempty"`
 	State *NddrIpamIpamNetworkInstanceIpPrefixState `json:"state,omitempty"`
 	Tag   []*nddov1.Tag                             `json:"tag,omitempty"`
@@ -106,6 +106,16 @@ type NddrIpamIpamNetworkInstanceIpPrefixState struct {
 	Reason *string                                         `json:"reason,omitempty"`
 	Status *string                                         `json:"status,omitempty"`
 	Tag    []*nddov1.Tag                                   `json:"tag,omitempty"`
+	// Utilisation of the ip prefix in percent
+	Utilisation *uint32 `json:"utilisation,omitempty"`
+	// ProjectedExhaustion is the time the ip prefix is exhausted at the
+	// recent allocation rate
+	ProjectedExhaustion *string `json:"projected-exhaustion,omitempty"`
+	// Tenants are the allocations remaining in a draining ip prefix
+	Tenants []*NddrIpamIpamNetworkInstanceIpPrefixStateTenant `json:"tenants,omitempty"`
+	// Expansions are the ip prefixes carved out of the aggregate of the
+	// auto-expand policy
+	Expansions []string `json:"expansions,omitempty"`
 }
 
 // NddrIpamIpamNetworkInstanceIpPrefixStateChild struct
@@ -128,6 +138,12 @@ type NddrIpamIpamNetworkInstanceIpPrefixStateParentIpPrefix struct {
 	Prefix *string `json:"prefix"`
 }
 
+// NddrIpamIpamNetworkInstanceIpPrefixStateTenant struct
+type NddrIpamIpamNetworkInstanceIpPrefixStateTenant struct {
+	IpPrefix *string       `json:"ip-prefix,omitempty"`
+	Tag      []*nddov1.Tag `json:"tag,omitempty"`
+}
+
 // NddrIpamIpamNetworkInstanceIpRange struct
 type NddrIpamIpamNetworkInstanceIpRange struct {
 	AdminState  *string                                  `json:"admin-state,omitempty"`
@@ -16,10 +16,75 @@ limitations under the License.
 
 package v1alpha1
 
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 const (
 	KeyPurpose       = "purpose"       // used in ipam for loopback, isl
 	KeyPrefixLength  = "prefix-length" // used in ipam
 	KeyAddressFamily = "address-family"
+	KeyRequestId     = "request-id" // idempotency key of a resource request
+	// explicit references of a resource request to the network instance, when
+	// not provided they are derived from the register name
+	KeyRegistryName        = "registry-name"
+	KeyNetworkInstanceName = "network-instance-name"
+	// consumer of a resource request, the allocation is released when the
+	// consumer is deleted
+	KeyConsumerApiVersion = "consumer-api-version"
+	KeyConsumerKind       = "consumer-kind"
+	KeyConsumerName       = "consumer-name"
+	KeyConsumerUid        = "consumer-uid"
+	// label selector restricting the pools of a resource request, in the
+	// kubernetes label selector syntax, e.g. "zone!=az2,rack"
+	KeyMatchExpressions = "match-expressions"
+)
+
+// SelectorValues returns the values a register selects for the key, the value
+// of the selector or else the values of an In match-expression, such that the
+// purpose and address-family can be one of several
+func SelectorValues(selector map[string]string, exprs []metav1.LabelSelectorRequirement, key string) []string {
+	if val, ok := selector[key]; ok {
+		return []string{val}
+	}
+	for _, expr := range exprs {
+		if expr.Key == key && expr.Operator == metav1.LabelSelectorOpIn {
+			return expr.Values
+		}
+	}
+	return nil
+}
+
+// AnnotationRequestId carries the idempotency key of the resource request a
+// register was created for to the register reconciler
+const AnnotationRequestId = "ipam.nddr.yndd.io/request-id"
+
+// admin states of the ipam, network instance and ip prefix
+const (
+	AdminStateEnable  = "enable"
+	AdminStateDisable = "disable"
+)
+
+// lifecycles of the ip prefix
+const (
+	LifecycleActive   = "active"
+	LifecycleDraining = "draining"
+)
+
+// deletion policies of the ip prefix
+const (
+	DeletionPolicyBlock   = "block"
+	DeletionPolicyCascade = "cascade"
+)
+
+// allocation strategies of the network instance and the purpose
+const (
+	AllocationStrategyFirstAvailable = "first-available"
+	AllocationStrategyDeterministic  = "deterministic"
+)
+
+// reuse policies of the purpose
+const (
+	ReusePolicyQuarantine = "quarantine"
+	ReusePolicyImmediate  = "immediate"
 )
 
 type AddressFamily string
@@ -23,9 +23,45 @@ package v1alpha1
 
 import (
 	"github.com/yndd/nddo-runtime/apis/common/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsumerReference) DeepCopyInto(out *ConsumerReference) {
+	*out = *in
+	if in.ApiVersion != nil {
+		in, out := &in.ApiVersion, &out.ApiVersion
+		*out = new(string)
+		**out = **in
+	}
+	if in.Kind != nil {
+		in, out := &in.Kind, &out.Kind
+		*out = new(string)
+		**out = **in
+	}
+	if in.Name != nil {
+		in, out := &in.Name, &out.Name
+		*out = new(string)
+		**out = **in
+	}
+	if in.Uid != nil {
+		in, out := &in.Uid, &out.Uid
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsumerReference.
+func (in *ConsumerReference) DeepCopy() *ConsumerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsumerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Ipam) DeepCopyInto(out *Ipam) {
 	*out = *in
@@ -53,6 +89,72 @@ func (in *Ipam) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamAutoExpand) DeepCopyInto(out *IpamAutoExpand) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = make([]*v1.Tag, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(v1.Tag)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.PrefixLength != nil {
+		in, out := &in.PrefixLength, &out.PrefixLength
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.Threshold != nil {
+		in, out := &in.Threshold, &out.Threshold
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.MaxExpansions != nil {
+		in, out := &in.MaxExpansions, &out.MaxExpansions
+		*out = new(uint32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamAutoExpand.
+func (in *IpamAutoExpand) DeepCopy() *IpamAutoExpand {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamAutoExpand)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamCapacityThreshold) DeepCopyInto(out *IpamCapacityThreshold) {
+	*out = *in
+	if in.Warning != nil {
+		in, out := &in.Warning, &out.Warning
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.Critical != nil {
+		in, out := &in.Critical, &out.Critical
+		*out = new(uint32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamCapacityThreshold.
+func (in *IpamCapacityThreshold) DeepCopy() *IpamCapacityThreshold {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamCapacityThreshold)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IpamIpam) DeepCopyInto(out *IpamIpam) {
 	*out = *in
@@ -106,6 +208,16 @@ func (in *IpamIpamNetworkInstance) DeepCopyInto(out *IpamIpamNetworkInstance) {
 			(*out)[key] = outVal
 		}
 	}
+	if in.CapacityThreshold != nil {
+		in, out := &in.CapacityThreshold, &out.CapacityThreshold
+		*out = new(IpamCapacityThreshold)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.QuarantinePeriod != nil {
+		in, out := &in.QuarantinePeriod, &out.QuarantinePeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 	if in.Description != nil {
 		in, out := &in.Description, &out.Description
 		*out = new(string)
@@ -192,6 +304,16 @@ func (in *IpamIpamNetworkInstanceIpPrefix) DeepCopyInto(out *IpamIpamNetworkInst
 		*out = new(string)
 		**out = **in
 	}
+	if in.Parent != nil {
+		in, out := &in.Parent, &out.Parent
+		*out = new(IpamIpamNetworkInstanceIpPrefixParent)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AutoExpand != nil {
+		in, out := &in.AutoExpand, &out.AutoExpand
+		*out = new(IpamAutoExpand)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Tag != nil {
 		in, out := &in.Tag, &out.Tag
 		*out = make([]*v1.Tag, len(*in))
@@ -203,6 +325,26 @@ func (in *IpamIpamNetworkInstanceIpPrefix) DeepCopyInto(out *IpamIpamNetworkInst
 			}
 		}
 	}
+	if in.CapacityThreshold != nil {
+		in, out := &in.CapacityThreshold, &out.CapacityThreshold
+		*out = new(IpamCapacityThreshold)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Lifecycle != nil {
+		in, out := &in.Lifecycle, &out.Lifecycle
+		*out = new(string)
+		**out = **in
+	}
+	if in.Migrate != nil {
+		in, out := &in.Migrate, &out.Migrate
+		*out = new(bool)
+		**out = **in
+	}
+	if in.DeletionPolicy != nil {
+		in, out := &in.DeletionPolicy, &out.DeletionPolicy
+		*out = new(string)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamIpamNetworkInstanceIpPrefix.
@@ -215,6 +357,158 @@ func (in *IpamIpamNetworkInstanceIpPrefix) DeepCopy() *IpamIpamNetworkInstanceIp
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamIpamNetworkInstanceIpPrefixParent) DeepCopyInto(out *IpamIpamNetworkInstanceIpPrefixParent) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = make([]*v1.Tag, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(v1.Tag)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.PrefixLength != nil {
+		in, out := &in.PrefixLength, &out.PrefixLength
+		*out = new(uint32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamIpamNetworkInstanceIpPrefixParent.
+func (in *IpamIpamNetworkInstanceIpPrefixParent) DeepCopy() *IpamIpamNetworkInstanceIpPrefixParent {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamIpamNetworkInstanceIpPrefixParent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamIpamPurpose) DeepCopyInto(out *IpamIpamPurpose) {
+	*out = *in
+	if in.AddressFamily != nil {
+		in, out := &in.AddressFamily, &out.AddressFamily
+		*out = make(map[string]*IpamIpamPurposePrefixLength, len(*in))
+		for key, val := range *in {
+			var outVal *IpamIpamPurposePrefixLength
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = new(IpamIpamPurposePrefixLength)
+				(*in).DeepCopyInto(*out)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.AllocationStrategy != nil {
+		in, out := &in.AllocationStrategy, &out.AllocationStrategy
+		*out = new(string)
+		**out = **in
+	}
+	if in.ReusePolicy != nil {
+		in, out := &in.ReusePolicy, &out.ReusePolicy
+		*out = new(string)
+		**out = **in
+	}
+	if in.Description != nil {
+		in, out := &in.Description, &out.Description
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamIpamPurpose.
+func (in *IpamIpamPurpose) DeepCopy() *IpamIpamPurpose {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamIpamPurpose)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamIpamPurposePrefixLength) DeepCopyInto(out *IpamIpamPurposePrefixLength) {
+	*out = *in
+	if in.Default != nil {
+		in, out := &in.Default, &out.Default
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.Min != nil {
+		in, out := &in.Min, &out.Min
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		*out = new(uint32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamIpamPurposePrefixLength.
+func (in *IpamIpamPurposePrefixLength) DeepCopy() *IpamIpamPurposePrefixLength {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamIpamPurposePrefixLength)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamIpamQuota) DeepCopyInto(out *IpamIpamQuota) {
+	*out = *in
+	if in.Purpose != nil {
+		in, out := &in.Purpose, &out.Purpose
+		*out = new(string)
+		**out = **in
+	}
+	if in.SourceTag != nil {
+		in, out := &in.SourceTag, &out.SourceTag
+		*out = make([]*v1.Tag, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(v1.Tag)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.MaxAllocations != nil {
+		in, out := &in.MaxAllocations, &out.MaxAllocations
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.MaxAddresses != nil {
+		in, out := &in.MaxAddresses, &out.MaxAddresses
+		*out = new(uint64)
+		**out = **in
+	}
+	if in.Description != nil {
+		in, out := &in.Description, &out.Description
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamIpamQuota.
+func (in *IpamIpamQuota) DeepCopy() *IpamIpamQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamIpamQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IpamList) DeepCopyInto(out *IpamList) {
 	*out = *in
@@ -474,6 +768,226 @@ func (in *IpamNetworkInstanceStatus) DeepCopy() *IpamNetworkInstanceStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamPurpose) DeepCopyInto(out *IpamPurpose) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamPurpose.
+func (in *IpamPurpose) DeepCopy() *IpamPurpose {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamPurpose)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IpamPurpose) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamPurposeList) DeepCopyInto(out *IpamPurposeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IpamPurpose, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamPurposeList.
+func (in *IpamPurposeList) DeepCopy() *IpamPurposeList {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamPurposeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IpamPurposeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamPurposeSpec) DeepCopyInto(out *IpamPurposeSpec) {
+	*out = *in
+	if in.Purpose != nil {
+		in, out := &in.Purpose, &out.Purpose
+		*out = new(IpamIpamPurpose)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamPurposeSpec.
+func (in *IpamPurposeSpec) DeepCopy() *IpamPurposeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamPurposeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamPurposeStatus) DeepCopyInto(out *IpamPurposeStatus) {
+	*out = *in
+	in.ConditionedStatus.DeepCopyInto(&out.ConditionedStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamPurposeStatus.
+func (in *IpamPurposeStatus) DeepCopy() *IpamPurposeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamPurposeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamQuota) DeepCopyInto(out *IpamQuota) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamQuota.
+func (in *IpamQuota) DeepCopy() *IpamQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IpamQuota) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamQuotaList) DeepCopyInto(out *IpamQuotaList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IpamQuota, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamQuotaList.
+func (in *IpamQuotaList) DeepCopy() *IpamQuotaList {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamQuotaList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IpamQuotaList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamQuotaSpec) DeepCopyInto(out *IpamQuotaSpec) {
+	*out = *in
+	if in.Quota != nil {
+		in, out := &in.Quota, &out.Quota
+		*out = new(IpamIpamQuota)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamQuotaSpec.
+func (in *IpamQuotaSpec) DeepCopy() *IpamQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamQuotaStatus) DeepCopyInto(out *IpamQuotaStatus) {
+	*out = *in
+	in.ConditionedStatus.DeepCopyInto(&out.ConditionedStatus)
+	if in.Used != nil {
+		in, out := &in.Used, &out.Used
+		*out = new(IpamQuotaUsage)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamQuotaStatus.
+func (in *IpamQuotaStatus) DeepCopy() *IpamQuotaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamQuotaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpamQuotaUsage) DeepCopyInto(out *IpamQuotaUsage) {
+	*out = *in
+	if in.Allocations != nil {
+		in, out := &in.Allocations, &out.Allocations
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = new(uint64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamQuotaUsage.
+func (in *IpamQuotaUsage) DeepCopy() *IpamQuotaUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(IpamQuotaUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IpamRegister) DeepCopyInto(out *IpamRegister) {
 	*out = *in
@@ -509,6 +1023,13 @@ func (in *IpamRegister) DeepCopyInto(out *IpamRegister) {
 			}
 		}
 	}
+	if in.MatchExpressions != nil {
+		in, out := &in.MatchExpressions, &out.MatchExpressions
+		*out = make([]metav1.LabelSelectorRequirement, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpamRegister.
@@ -983,6 +1504,32 @@ func (in *NddrIpamIpamNetworkInstanceIpPrefixState) DeepCopyInto(out *NddrIpamIp
 			}
 		}
 	}
+	if in.Utilisation != nil {
+		in, out := &in.Utilisation, &out.Utilisation
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.ProjectedExhaustion != nil {
+		in, out := &in.ProjectedExhaustion, &out.ProjectedExhaustion
+		*out = new(string)
+		**out = **in
+	}
+	if in.Tenants != nil {
+		in, out := &in.Tenants, &out.Tenants
+		*out = make([]*NddrIpamIpamNetworkInstanceIpPrefixStateTenant, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(NddrIpamIpamNetworkInstanceIpPrefixStateTenant)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.Expansions != nil {
+		in, out := &in.Expansions, &out.Expansions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NddrIpamIpamNetworkInstanceIpPrefixState.
@@ -1087,6 +1634,37 @@ func (in *NddrIpamIpamNetworkInstanceIpPrefixStateParentIpPrefix) DeepCopy() *Nd
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NddrIpamIpamNetworkInstanceIpPrefixStateTenant) DeepCopyInto(out *NddrIpamIpamNetworkInstanceIpPrefixStateTenant) {
+	*out = *in
+	if in.IpPrefix != nil {
+		in, out := &in.IpPrefix, &out.IpPrefix
+		*out = new(string)
+		**out = **in
+	}
+	if in.Tag != nil {
+		in, out := &in.Tag, &out.Tag
+		*out = make([]*v1.Tag, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(v1.Tag)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NddrIpamIpamNetworkInstanceIpPrefixStateTenant.
+func (in *NddrIpamIpamNetworkInstanceIpPrefixStateTenant) DeepCopy() *NddrIpamIpamNetworkInstanceIpPrefixStateTenant {
+	if in == nil {
+		return nil
+	}
+	out := new(NddrIpamIpamNetworkInstanceIpPrefixStateTenant)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NddrIpamIpamNetworkInstanceIpRange) DeepCopyInto(out *NddrIpamIpamNetworkInstanceIpRange) {
 	*out = *in
@@ -1331,6 +1909,45 @@ func (in *NddrRegisterState) DeepCopyInto(out *NddrRegisterState) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = make([]*v1.Tag, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(v1.Tag)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.SourceTag != nil {
+		in, out := &in.SourceTag, &out.SourceTag
+		*out = make([]*v1.Tag, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(v1.Tag)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.MatchExpressions != nil {
+		in, out := &in.MatchExpressions, &out.MatchExpressions
+		*out = make([]metav1.LabelSelectorRequirement, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MigratedFrom != nil {
+		in, out := &in.MigratedFrom, &out.MigratedFrom
+		*out = new(string)
+		**out = **in
+	}
+	if in.RequestId != nil {
+		in, out := &in.RequestId, &out.RequestId
+		*out = new(string)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NddrRegisterState.
@@ -1405,11 +2022,26 @@ func (in *RegisterList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RegisterSpec) DeepCopyInto(out *RegisterSpec) {
 	*out = *in
+	if in.RegistryName != nil {
+		in, out := &in.RegistryName, &out.RegistryName
+		*out = new(string)
+		**out = **in
+	}
+	if in.NetworkInstanceName != nil {
+		in, out := &in.NetworkInstanceName, &out.NetworkInstanceName
+		*out = new(string)
+		**out = **in
+	}
 	if in.Register != nil {
 		in, out := &in.Register, &out.Register
 		*out = new(IpamRegister)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Consumer != nil {
+		in, out := &in.Consumer, &out.Consumer
+		*out = new(ConsumerReference)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegisterSpec.
@@ -31,6 +31,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	"github.com/yndd/ndd-runtime/pkg/logging"
 	"github.com/yndd/ndd-runtime/pkg/ratelimiter"
@@ -39,6 +40,7 @@ import (
 	"github.com/yndd/nddr-ipam-registry/internal/grpcserver"
 	"github.com/yndd/nddr-ipam-registry/internal/handler"
 	"github.com/yndd/nddr-ipam-registry/internal/shared"
+	"github.com/yndd/nddr-ipam-registry/internal/webhook"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -52,6 +54,8 @@ var (
 	podname              string
 	grpcServerAddress    string
 	grpcQueryAddress     string
+	grpcReflection       bool
+	enableWebhooks       bool
 )
 
 // startCmd represents the start command for the network device driver
@@ -81,18 +85,19 @@ var startCmd = &cobra.Command{
 			return errors.Wrap(err, "Cannot create manager")
 		}
 
-		// assign gnmi address
-		var gnmiAddress string
-		if grpcQueryAddress != "" {
-			gnmiAddress = grpcQueryAddress
-		} else {
-			gnmiAddress = getGnmiServerAddress(podname)
+		// assign grpc server address, by default we bind to the gnmi server port
+		if grpcServerAddress == "" {
+			grpcServerAddress = ":" + strconv.Itoa(pkgmetav1.GnmiServerPort)
 		}
-		zlog.Info("gnmi address", "address", gnmiAddress)
+		zlog.Info("grpc address",
+			"address", grpcServerAddress,
+			"query address", grpcQueryAddress,
+			"service", getGnmiServerAddress(podname))
 
 		handler, err := handler.New(
 			handler.WithLogger(logging.NewLogrLogger(zlog.WithName("handler"))),
 			handler.WithClient(mgr.GetClient()),
+			handler.WithMetrics(metrics.Registry),
 		)
 		if err != nil {
 			return errors.Wrap(err, "cannot initialize the handler")
@@ -111,6 +116,13 @@ var startCmd = &cobra.Command{
 			return errors.Wrap(err, "Cannot add nddo controllers to manager")
 		}
 
+		// the webhooks require the serving certificates of the webhook server
+		if enableWebhooks {
+			if err := webhook.Setup(mgr, logging.NewLogrLogger(zlog.WithName("webhook"))); err != nil {
+				return errors.Wrap(err, "Cannot add webhooks to manager")
+			}
+		}
+
 		gs, err := grpcserver.New(
 			grpcserver.WithLogger(logging.NewLogrLogger(zlog.WithName("grpcserver"))),
 			grpcserver.WithClient(mgr.GetClient()),
@@ -118,9 +130,11 @@ var startCmd = &cobra.Command{
 			grpcserver.WithHandler(handler),
 			grpcserver.WithConfig(
 				grpcserver.Config{
-					Address:    ":" + strconv.Itoa(pkgmetav1.GnmiServerPort),
-					SkipVerify: true,
-					InSecure:   true,
+					Address:          grpcServerAddress,
+					QueryAddress:     grpcQueryAddress,
+					SkipVerify:       true,
+					InSecure:         true,
+					EnableReflection: grpcReflection,
 				},
 			),
 		)
@@ -159,8 +173,10 @@ func init() {
 	startCmd.Flags().DurationVarP(&pollInterval, "poll-interval", "", 1*time.Minute, "Poll interval controls how often an individual resource should be checked for drift.")
 	startCmd.Flags().StringVarP(&namespace, "namespace", "n", os.Getenv("POD_NAMESPACE"), "Namespace used to unpack and run packages.")
 	startCmd.Flags().StringVarP(&podname, "podname", "", os.Getenv("POD_NAME"), "Name from the pod")
-	startCmd.Flags().StringVarP(&grpcServerAddress, "grpc-server-address", "s", "", "The address of the grpc server binds to.")
-	startCmd.Flags().StringVarP(&grpcQueryAddress, "grpc-query-address", "", "", "Validation query address.")
+	startCmd.Flags().StringVarP(&grpcServerAddress, "grpc-server-address", "s", "", "The address the grpc server binds to, host:port or unix:///path (default :"+strconv.Itoa(pkgmetav1.GnmiServerPort)+").")
+	startCmd.Flags().StringVarP(&grpcQueryAddress, "grpc-query-address", "", "", "The address the read-only grpc query server binds to, host:port or unix:///path, disabled when empty.")
+	startCmd.Flags().BoolVarP(&grpcReflection, "grpc-reflection", "", false, "Enable the grpc server reflection service.")
+	startCmd.Flags().BoolVarP(&enableWebhooks, "enable-webhooks", "", false, "Enable the validating and defaulting webhooks of the ipam resources.")
 }
 
 func nddCtlrOptions(c int) controller.Options {
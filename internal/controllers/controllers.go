@@ -24,6 +24,8 @@ import (
 	"github.com/yndd/nddr-ipam-registry/internal/controllers/ipam"
 	"github.com/yndd/nddr-ipam-registry/internal/controllers/ipamnetworkinstance"
 	"github.com/yndd/nddr-ipam-registry/internal/controllers/ipamnetworkinstanceipprefix"
+	"github.com/yndd/nddr-ipam-registry/internal/controllers/ipampurpose"
+	"github.com/yndd/nddr-ipam-registry/internal/controllers/ipamquota"
 	"github.com/yndd/nddr-ipam-registry/internal/controllers/register"
 	"github.com/yndd/nddr-ipam-registry/internal/shared"
 )
@@ -35,6 +37,9 @@ func Setup(mgr ctrl.Manager, option controller.Options, nddcopts *shared.NddCont
 		ipam.Setup,
 		ipamnetworkinstance.Setup,
 		ipamnetworkinstanceipprefix.Setup,
+		ipampurpose.Setup,
+		ipamquota.Setup,
+		register.Setup,
 	} {
 		gvk, eventChan, err := setup(mgr, option, nddcopts)
 		if err != nil {
@@ -42,13 +47,6 @@ func Setup(mgr ctrl.Manager, option controller.Options, nddcopts *shared.NddCont
 		}
 		eventChans[gvk] = eventChan
 	}
-	for _, setup := range []func(ctrl.Manager, controller.Options, *shared.NddControllerOptions) error{
-		register.Setup,
-	} {
-		if err := setup(mgr, option, nddcopts); err != nil {
-			return nil, err
-		}
-	}
 
 	return eventChans, nil
 }
@@ -0,0 +1,219 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"github.com/yndd/nddr-ipam-registry/internal/handler"
+	"github.com/yndd/nddr-ipam-registry/internal/shared"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+const (
+	examplesDir = "../../examples"
+	crdsDir     = "../../package/crds"
+	// convergeTimeout is the time the registers of the examples get to be
+	// allocated
+	convergeTimeout = time.Minute
+)
+
+// startTestManager starts an api server with the crds of the package and a
+// manager running the controllers, both are stopped when the test ends. The
+// test is skipped when the api server binaries are not installed, unless it
+// runs in CI where the missing binaries fail the test.
+func startTestManager(t *testing.T) client.Client {
+	t.Helper()
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("KUBEBUILDER_ASSETS not set, run the tests with make test")
+		}
+		t.Skip("KUBEBUILDER_ASSETS not set, the envtest binaries are installed by make test")
+	}
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{crdsDir},
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := env.Start()
+	if err != nil {
+		t.Fatalf("cannot start envtest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Logf("cannot stop envtest: %v", err)
+		}
+	})
+
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipamv1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:                 s,
+		MetricsBindAddress:     "0",
+		HealthProbeBindAddress: "0",
+	})
+	if err != nil {
+		t.Fatalf("cannot create manager: %v", err)
+	}
+	h, err := handler.New(
+		handler.WithLogger(logging.NewNopLogger()),
+		handler.WithClient(mgr.GetClient()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Setup(mgr, controller.Options{MaxConcurrentReconciles: 1}, &shared.NddControllerOptions{
+		Logger:  logging.NewNopLogger(),
+		Poll:    time.Second,
+		Handler: h,
+	}); err != nil {
+		t.Fatalf("cannot setup controllers: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := mgr.Start(ctx); err != nil {
+			t.Errorf("cannot start manager: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	c, err := client.New(cfg, client.Options{Scheme: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// readExamples returns the ipam resources of the examples, the resources of
+// other groups like the package are skipped
+func readExamples(t *testing.T) []*unstructured.Unstructured {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(examplesDir, "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	objs := make([]*unstructured.Unstructured, 0, len(files))
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := &unstructured.Unstructured{}
+		err = yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(&u.Object)
+		f.Close()
+		if err != nil {
+			t.Fatalf("cannot decode %s: %v", file, err)
+		}
+		if u.GroupVersionKind().Group != ipamv1alpha1.Group {
+			continue
+		}
+		objs = append(objs, u)
+	}
+	return objs
+}
+
+// TestExamples applies the examples and checks every register is allocated a
+// prefix of its own
+func TestExamples(t *testing.T) {
+	c := startTestManager(t)
+	ctx := context.Background()
+
+	examples := readExamples(t)
+	var registers int
+	for _, u := range examples {
+		if err := c.Create(ctx, u); err != nil {
+			t.Fatalf("cannot create %s %s: %v", u.GetKind(), u.GetName(), err)
+		}
+		if u.GetKind() == ipamv1alpha1.RegisterKindKind {
+			registers++
+		}
+	}
+	if registers == 0 {
+		t.Fatal("no registers in the examples")
+	}
+
+	var list *ipamv1alpha1.RegisterList
+	err := wait.PollImmediate(250*time.Millisecond, convergeTimeout, func() (bool, error) {
+		list = &ipamv1alpha1.RegisterList{}
+		if err := c.List(ctx, list); err != nil {
+			return false, err
+		}
+		for i := range list.Items {
+			cr := &list.Items[i]
+			if _, ok := cr.HasIpPrefix(); !ok || cr.GetCondition(ipamv1alpha1.ConditionKindReady).Status != corev1.ConditionTrue {
+				return false, nil
+			}
+		}
+		return len(list.Items) == registers, nil
+	})
+	if err != nil {
+		for i := range list.Items {
+			cr := &list.Items[i]
+			p, _ := cr.HasIpPrefix()
+			t.Logf("register %s: prefix %q, ready %v", cr.GetName(), p, cr.GetCondition(ipamv1alpha1.ConditionKindReady))
+		}
+		t.Fatalf("registers did not converge: %v", err)
+	}
+
+	prefixes := make(map[string]string, len(list.Items))
+	for i := range list.Items {
+		cr := &list.Items[i]
+		p, _ := cr.HasIpPrefix()
+		if other, ok := prefixes[p]; ok {
+			t.Errorf("prefix %s allocated to %s and %s", p, other, cr.GetName())
+		}
+		prefixes[p] = cr.GetName()
+	}
+
+	// the ip prefix requesting a parent pool is carved out of the aggregate
+	ipps := &ipamv1alpha1.IpamNetworkInstanceIpPrefixList{}
+	if err := c.List(ctx, ipps); err != nil {
+		t.Fatal(err)
+	}
+	for i := range ipps.Items {
+		if ipp := &ipps.Items[i]; ipp.GetIpPrefix() == "" {
+			t.Errorf("ip prefix %s has no prefix", ipp.GetName())
+		}
+	}
+}
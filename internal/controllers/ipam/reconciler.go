@@ -38,8 +38,6 @@ import (
 const (
 	// timers
 	reconcileTimeout = 1 * time.Minute
-	shortWait        = 5 * time.Second
-	veryShortWait    = 1 * time.Second
 	// errors
 	errUnexpectedResource = "unexpected infrastructure object"
 	errGetK8sResource     = "cannot get infrastructure resource"
@@ -54,7 +52,6 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 	//rrlfn := func() ipamv1alpha1.RrList { return &ipamv1alpha1.RegisterList{} }
 
 	events := make(chan gevent.GenericEvent)
-	//speedy := make(map[string]int)
 
 	r := managed.NewReconciler(mgr,
 		resource.ManagedKind(ipamv1alpha1.IpamGroupVersionKind),
@@ -70,7 +67,6 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 			registry:    nddcopts.Registry,
 			handler:     nddcopts.Handler,
 		}),
-		//managed.WithSpeedy(speedy),
 		managed.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
 	)
 
@@ -130,20 +126,6 @@ func (r *application) FinalUpdate(ctx context.Context, mg resource.Managed) {
 }
 
 func (r *application) Timeout(ctx context.Context, mg resource.Managed) time.Duration {
-	cr, _ := mg.(*ipamv1alpha1.Ipam)
-	crName := getCrName(cr)
-	speedy := r.handler.GetSpeedy(crName)
-	if speedy <= 2 {
-		r.handler.IncrementSpeedy(crName)
-		r.log.Debug("Speedy incr", "number", r.handler.GetSpeedy(crName))
-		switch speedy {
-		case 0:
-			return veryShortWait
-		case 1, 2:
-			return shortWait
-		}
-
-	}
 	return reconcileTimeout
 }
 
@@ -169,7 +151,7 @@ func (r *application) handleAppLogic(ctx context.Context, cr ipamv1alpha1.Ip) (m
 
 	// we dont need to check for the hierarchy since the deployment is within a namespace that was created before
 
-	if cr.GetAdminState() == "disable" {
+	if cr.GetAdminState() == ipamv1alpha1.AdminStateDisable {
 		cr.SetStatus("down")
 		cr.SetReason("admin disable")
 	} else {
@@ -182,6 +164,5 @@ func (r *application) handleAppLogic(ctx context.Context, cr ipamv1alpha1.Ip) (m
 	cr.SetAvailabilityZone(cr.GetAvailabilityZone())
 	cr.SetIpamName(cr.GetIpamName())
 
-	// trick to use speedy for fast updates
-	return map[string]string{"dummy": "dummy"}, nil
+	return nil, nil
 }
@@ -33,16 +33,17 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	gevent "sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
 	// timers
 	reconcileTimeout = 1 * time.Minute
-	shortWait        = 5 * time.Second
-	veryShortWait    = 1 * time.Second
 	// errors
 	errUnexpectedResource = "unexpected infrastructure object"
 	errGetK8sResource     = "cannot get infrastructure resource"
@@ -54,11 +55,11 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 	ipfn := func() ipamv1alpha1.Ip { return &ipamv1alpha1.Ipam{} }
 	infn := func() ipamv1alpha1.In { return &ipamv1alpha1.IpamNetworkInstance{} }
 	inlfn := func() ipamv1alpha1.InList { return &ipamv1alpha1.IpamNetworkInstanceList{} }
+	ipplfn := func() ipamv1alpha1.IppList { return &ipamv1alpha1.IpamNetworkInstanceIpPrefixList{} }
 	//rrfn := func() ipamv1alpha1.Rr { return &ipamv1alpha1.Register{} }
 	//rrlfn := func() ipamv1alpha1.RrList { return &ipamv1alpha1.RegisterList{} }
 
 	events := make(chan gevent.GenericEvent)
-	//speedy := make(map[string]int)
 
 	r := managed.NewReconciler(mgr,
 		resource.ManagedKind(ipamv1alpha1.IpamNetworkInstanceGroupVersionKind),
@@ -72,10 +73,10 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 			newIpam:                    ipfn,
 			newIpamNetworkInstance:     infn,
 			newIpamNetworkInstanceList: inlfn,
+			newIpPrefixList:            ipplfn,
 			registry:                   nddcopts.Registry,
 			handler:                    nddcopts.Handler,
 		}),
-		//managed.WithSpeedy(speedy),
 		managed.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
 	)
 
@@ -98,11 +99,12 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 	return ipamv1alpha1.IpamNetworkInstanceGroupKind, events, ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		WithOptions(o).
-		For(&ipamv1alpha1.IpamNetworkInstance{}).
-		Owns(&ipamv1alpha1.IpamNetworkInstance{}).
-		WithEventFilter(resource.IgnoreUpdateWithoutGenerationChangePredicate()).
-		Watches(&source.Kind{Type: &ipamv1alpha1.Ipam{}}, ipamHandler).
-		Watches(&source.Kind{Type: &ipamv1alpha1.Register{}}, registerHandler).
+		For(&ipamv1alpha1.IpamNetworkInstance{}, builder.WithPredicates(resource.IgnoreUpdateWithoutGenerationChangePredicate())).
+		Owns(&ipamv1alpha1.IpamNetworkInstance{}, builder.WithPredicates(resource.IgnoreUpdateWithoutGenerationChangePredicate())).
+		// a network instance waiting for its ipam is reconciled when the ipam
+		// becomes ready, which does not change the generation of the ipam
+		Watches(&source.Kind{Type: &ipamv1alpha1.Ipam{}}, ipamHandler, builder.WithPredicates(predicate.Or(resource.IgnoreUpdateWithoutGenerationChangePredicate(), ipamReadyChanged()))).
+		Watches(&source.Kind{Type: &ipamv1alpha1.Register{}}, registerHandler, builder.WithPredicates(resource.IgnoreUpdateWithoutGenerationChangePredicate())).
 		Watches(&source.Channel{Source: events}, registerHandler).
 		Complete(r)
 
@@ -115,6 +117,7 @@ type application struct {
 	newIpam                    func() ipamv1alpha1.Ip
 	newIpamNetworkInstance     func() ipamv1alpha1.In
 	newIpamNetworkInstanceList func() ipamv1alpha1.InList
+	newIpPrefixList            func() ipamv1alpha1.IppList
 
 	registry registry.Registry
 	handler  handler.Handler
@@ -154,20 +157,6 @@ func (r *application) FinalUpdate(ctx context.Context, mg resource.Managed) {
 }
 
 func (r *application) Timeout(ctx context.Context, mg resource.Managed) time.Duration {
-	cr, _ := mg.(*ipamv1alpha1.IpamNetworkInstance)
-	crName := getCrName(cr)
-	speedy := r.handler.GetSpeedy(crName)
-	if speedy <= 2 {
-		r.handler.IncrementSpeedy(crName)
-		r.log.Debug("Speedy incr", "number", r.handler.GetSpeedy(crName))
-		switch speedy {
-		case 0:
-			return veryShortWait
-		case 1, 2:
-			return shortWait
-		}
-
-	}
 	return reconcileTimeout
 }
 
@@ -215,10 +204,32 @@ func (r *application) handleAppLogic(ctx context.Context, cr ipamv1alpha1.In) (m
 		return nil, errors.New("ipam not ready")
 	}
 
-	// initialize speedy
+	// initialize the iptree and load the ip prefixes of the network instance
 	crName := getCrName(cr)
-	r.handler.Init(crName)
-	// update status based on a scan of the pool
+	r.handler.Init(crName, types.NamespacedName{Namespace: cr.GetNamespace(), Name: cr.GetName()})
+	if r.handler.GetState(crName) == handler.StateInitializing {
+		ipps, err := r.getIpPrefixes(ctx, cr)
+		if err != nil {
+			return nil, err
+		}
+		r.handler.Load(crName, ipps)
+	}
+	// the periodic reconciliation expires the quarantined prefixes
+	r.handler.Quarantine(crName, cr.GetQuarantinePeriod())
+
+	// the iptree is kept when the network instance is disabled, such that the
+	// existing allocations can still be released
+	switch {
+	case ipam.GetAdminState() == ipamv1alpha1.AdminStateDisable:
+		cr.SetStatus("down")
+		cr.SetReason("ipam admin disable")
+	case cr.GetAdminState() == ipamv1alpha1.AdminStateDisable:
+		cr.SetStatus("down")
+		cr.SetReason("admin disable")
+	default:
+		cr.SetStatus("up")
+		cr.SetReason("")
+	}
 
 	cr.SetOrganization(cr.GetOrganization())
 	cr.SetDeployment(cr.GetDeployment())
@@ -226,6 +237,22 @@ func (r *application) handleAppLogic(ctx context.Context, cr ipamv1alpha1.In) (m
 	cr.SetIpamName(cr.GetIpamName())
 	cr.SetNetworkInstanceName(cr.GetNetworkInstanceName())
 
-	// trick to use speedy for fast updates
-	return map[string]string{"dummy": "dummy"}, nil
+	return nil, nil
+}
+
+// getIpPrefixes returns the ip prefixes of the network instance
+func (r *application) getIpPrefixes(ctx context.Context, cr ipamv1alpha1.In) ([]ipamv1alpha1.Ipp, error) {
+	l := r.newIpPrefixList()
+	if err := r.client.List(ctx, l, client.InNamespace(cr.GetNamespace())); err != nil {
+		return nil, errors.Wrap(err, "cannot list ip prefixes")
+	}
+	ipps := make([]ipamv1alpha1.Ipp, 0)
+	for _, ipp := range l.GetIpPrefixes() {
+		if ipp.GetIpamName() == cr.GetIpamName() &&
+			ipp.GetNetworkInstanceName() == cr.GetNetworkInstanceName() &&
+			ipp.GetDeletionTimestamp() == nil {
+			ipps = append(ipps, ipp)
+		}
+	}
+	return ipps, nil
 }
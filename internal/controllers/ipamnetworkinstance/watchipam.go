@@ -29,6 +29,7 @@ import (
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -79,12 +80,27 @@ func (e *EnqueueRequestForAllIpams) add(obj runtime.Object, queue adder) {
 	for _, ni := range d.GetNetworkInstances() {
 		// only enqueue if the org and/or deployment name match
 		if ni.GetIpamName() == dd.GetIpamName() {
-			crName := getCrName(ni)
-			e.handler.ResetSpeedy(crName)
-
 			queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{
 				Namespace: ni.GetNamespace(),
 				Name:      ni.GetName()}})
 		}
 	}
 }
+
+// ipamReadyChanged lets the updates of an ipam through of which the ready
+// condition changed
+func ipamReadyChanged() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			o, ok := e.ObjectOld.(*ipamv1alpha1.Ipam)
+			if !ok {
+				return false
+			}
+			n, ok := e.ObjectNew.(*ipamv1alpha1.Ipam)
+			if !ok {
+				return false
+			}
+			return o.GetCondition(ipamv1alpha1.ConditionKindReady).Status != n.GetCondition(ipamv1alpha1.ConditionKindReady).Status
+		},
+	}
+}
@@ -82,9 +82,6 @@ func (e *EnqueueRequestForAllRegisters) add(obj runtime.Object, queue adder) {
 	for _, ni := range d.GetNetworkInstances() {
 		// only enqueue if the org and/or deployment name match
 		if ni.GetNamespace() == dd.GetNamespace() {
-			crName := getCrName(ni)
-			e.handler.ResetSpeedy(crName)
-
 			queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{
 				Namespace: ni.GetNamespace(),
 				Name:      ni.GetName()}})
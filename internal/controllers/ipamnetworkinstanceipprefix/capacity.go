@@ -0,0 +1,145 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipamnetworkinstanceipprefix
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/event"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+)
+
+const (
+	// default capacity thresholds in percent
+	defaultWarningThreshold  = 80
+	defaultCriticalThreshold = 95
+	// allocation rate window
+	rateWindow = 1 * time.Hour
+	// event reasons
+	reasonCapacityLow       event.Reason = "CapacityLow"
+	reasonCapacityRecovered event.Reason = "CapacityRecovered"
+)
+
+type usageSample struct {
+	time time.Time
+	used float64
+}
+
+// capacityTracker keeps the recent utilisation of the ip prefixes to derive
+// the allocation rate
+type capacityTracker struct {
+	m       sync.Mutex
+	samples map[string][]usageSample
+}
+
+func newCapacityTracker() *capacityTracker {
+	return &capacityTracker{
+		samples: make(map[string][]usageSample),
+	}
+}
+
+// add records the utilisation of the ip prefix and returns the allocation
+// rate in addresses per second over the rate window
+func (c *capacityTracker) add(name string, used float64, now time.Time) float64 {
+	c.m.Lock()
+	defer c.m.Unlock()
+	samples := append(c.samples[name], usageSample{time: now, used: used})
+	for len(samples) > 1 && now.Sub(samples[0].time) > rateWindow {
+		samples = samples[1:]
+	}
+	c.samples[name] = samples
+
+	first := samples[0]
+	elapsed := now.Sub(first.time).Seconds()
+	if elapsed <= 0 || used <= first.used {
+		return 0
+	}
+	return (used - first.used) / elapsed
+}
+
+func (c *capacityTracker) delete(name string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.samples, name)
+}
+
+// getThresholds returns the capacity thresholds of the ip prefix, falling back
+// to the network instance and the defaults
+func getThresholds(cr ipamv1alpha1.Ipp, ni ipamv1alpha1.In) (uint32, uint32) {
+	warning, critical := uint32(defaultWarningThreshold), uint32(defaultCriticalThreshold)
+	for _, t := range []*ipamv1alpha1.IpamCapacityThreshold{ni.GetCapacityThreshold(), cr.GetCapacityThreshold()} {
+		if t.Warning != nil {
+			warning = *t.Warning
+		}
+		if t.Critical != nil {
+			critical = *t.Critical
+		}
+	}
+	return warning, critical
+}
+
+// handleCapacity reports the utilisation of the ip prefix in its status and
+// sets the CapacityLow condition, a warning event is emitted when the
+// utilisation crosses a threshold
+func (r *application) handleCapacity(cr ipamv1alpha1.Ipp, ni ipamv1alpha1.In, crName string) error {
+	usage, err := r.handler.GetPoolUsage(crName, cr.GetIpPrefix())
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	rate := r.capacity.add(cr.GetName(), usage.Used, now)
+
+	utilisation := uint32(0)
+	if usage.Size > 0 {
+		utilisation = uint32(usage.Used * 100 / usage.Size)
+	}
+	var exhaustion string
+	if rate > 0 {
+		exhaustion = now.Add(time.Duration((usage.Size - usage.Used) / rate * float64(time.Second))).UTC().Format(time.RFC3339)
+	}
+	cr.SetCapacity(utilisation, exhaustion)
+
+	warning, critical := getThresholds(cr, ni)
+	c := ipamv1alpha1.CapacityOk()
+	switch {
+	case utilisation >= critical:
+		c = ipamv1alpha1.CapacityCritical(fmt.Sprintf("utilisation above critical threshold %d%%", critical))
+	case utilisation >= warning:
+		c = ipamv1alpha1.CapacityWarning(fmt.Sprintf("utilisation above warning threshold %d%%", warning))
+	}
+
+	previous := cr.GetCondition(ipamv1alpha1.ConditionKindCapacityLow)
+	if previous.Reason != c.Reason {
+		switch c.Reason {
+		case ipamv1alpha1.ConditionReasonCapacityOk:
+			if previous.Reason != "" {
+				r.recorder.Event(cr, event.Normal(reasonCapacityRecovered, fmt.Sprintf("utilisation %d%%", utilisation)))
+			}
+		default:
+			kv := []string{"utilisation", fmt.Sprintf("%d%%", utilisation)}
+			if exhaustion != "" {
+				kv = append(kv, "projected-exhaustion", exhaustion)
+			}
+			r.recorder.Event(cr, event.Warning(reasonCapacityLow, errors.New(c.Message), kv...))
+		}
+	}
+	cr.SetConditions(c)
+	return nil
+}
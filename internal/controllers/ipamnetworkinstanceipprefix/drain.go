@@ -0,0 +1,59 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipamnetworkinstanceipprefix
+
+import (
+	"sort"
+
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	nddov1 "github.com/yndd/nddo-runtime/apis/common/v1"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+)
+
+// handleDrain lists the allocations remaining in a draining ip prefix in its
+// status, it returns the number of remaining allocations
+func (r *application) handleDrain(cr ipamv1alpha1.Ipp, crName string) (int, error) {
+	if cr.GetLifecycle() != ipamv1alpha1.LifecycleDraining {
+		cr.SetTenants(nil)
+		return 0, nil
+	}
+	tenants, err := r.handler.GetTenants(crName, cr.GetIpPrefix())
+	if err != nil {
+		return 0, err
+	}
+	s := make([]*ipamv1alpha1.NddrIpamIpamNetworkInstanceIpPrefixStateTenant, 0, len(tenants))
+	for _, tenant := range tenants {
+		keys := make([]string, 0, len(tenant.Labels))
+		for key := range tenant.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		tags := make([]*nddov1.Tag, 0, len(keys))
+		for _, key := range keys {
+			tags = append(tags, &nddov1.Tag{
+				Key:   utils.StringPtr(key),
+				Value: utils.StringPtr(tenant.Labels[key]),
+			})
+		}
+		s = append(s, &ipamv1alpha1.NddrIpamIpamNetworkInstanceIpPrefixStateTenant{
+			IpPrefix: utils.StringPtr(tenant.Prefix),
+			Tag:      tags,
+		})
+	}
+	cr.SetTenants(s)
+	return len(s), nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipamnetworkinstanceipprefix
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/event"
+	"github.com/yndd/ndd-runtime/pkg/meta"
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	nddov1 "github.com/yndd/nddo-runtime/apis/common/v1"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"github.com/yndd/nddr-ipam-registry/internal/handler"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// event reasons
+	reasonExpanded     event.Reason = "Expanded"
+	reasonCannotExpand event.Reason = "CannotExpand"
+)
+
+// handleAutoExpand records the pools the handler carved out of the aggregate
+// of the auto-expand policy while allocating from the full ip prefix, and
+// carves an additional ip prefix once the ip prefix and all its expansions
+// reach the threshold. An expansion is an ip prefix controlled by the ip prefix
+// with the same tags, the registers matching the ip prefix also match the
+// expansion.
+func (r *application) handleAutoExpand(ctx context.Context, cr ipamv1alpha1.Ipp, crName string) error {
+	expansions, err := r.getExpansions(ctx, cr)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(expansions))
+	for _, e := range expansions {
+		names[e.GetName()] = true
+	}
+	defer func() { cr.SetExpansions(sortedNames(names)) }()
+
+	ae := cr.GetAutoExpand()
+	if ae == nil {
+		return nil
+	}
+
+	// the handler expands the pool within the allocation that found no room,
+	// the expansion is recorded afterwards
+	var recorded bool
+	for _, name := range r.handler.GetExpansions(crName, cr.GetName()) {
+		if names[name] {
+			continue
+		}
+		if err := r.createExpansion(ctx, cr, newExpansion(cr, ae, name)); err != nil {
+			return err
+		}
+		names[name] = true
+		recorded = true
+	}
+	if recorded {
+		return nil
+	}
+
+	if uint32(len(names)) >= ae.GetMaxExpansions() || !r.full(crName, cr.GetIpPrefix(), ae.GetThreshold()) {
+		return nil
+	}
+	for _, e := range expansions {
+		// an expansion that is not carved yet is pending
+		if e.GetIpPrefix() == "" || !r.full(crName, e.GetIpPrefix(), ae.GetThreshold()) {
+			return nil
+		}
+	}
+
+	name := handler.ExpansionName(cr.GetName(), names)
+	if err := r.createExpansion(ctx, cr, newExpansion(cr, ae, name)); err != nil {
+		return err
+	}
+	names[name] = true
+	return nil
+}
+
+// createExpansion creates the expansion of the ip prefix
+func (r *application) createExpansion(ctx context.Context, cr ipamv1alpha1.Ipp, expansion *ipamv1alpha1.IpamNetworkInstanceIpPrefix) error {
+	if err := r.client.Create(ctx, expansion); err != nil {
+		// the cache may not have observed an expansion that was just created
+		if apierrors.IsAlreadyExists(err) {
+			return nil
+		}
+		r.recorder.Event(cr, event.Warning(reasonCannotExpand, err))
+		return errors.Wrap(err, "cannot create expansion")
+	}
+	r.recorder.Event(cr, event.Normal(reasonExpanded, fmt.Sprintf("expansion %s carved out of the aggregate", expansion.GetName())))
+	return nil
+}
+
+// full reports if the utilisation of the pool of the prefix reached the
+// threshold
+func (r *application) full(crName, prefix string, threshold uint32) bool {
+	usage, err := r.handler.GetPoolUsage(crName, prefix)
+	if err != nil || usage.Size == 0 {
+		return false
+	}
+	return uint32(usage.Used*100/usage.Size) >= threshold
+}
+
+// sortedNames returns the names ordered by name
+func sortedNames(names map[string]bool) []string {
+	s := make([]string, 0, len(names))
+	for name := range names {
+		s = append(s, name)
+	}
+	sort.Strings(s)
+	return s
+}
+
+// getExpansions returns the expansions of the ip prefix ordered by name
+func (r *application) getExpansions(ctx context.Context, cr ipamv1alpha1.Ipp) ([]ipamv1alpha1.Ipp, error) {
+	ipps := r.newIpamNetworkInstanceIpPrefixList()
+	if err := r.client.List(ctx, ipps, client.InNamespace(cr.GetNamespace())); err != nil {
+		return nil, errors.Wrap(err, "cannot list ip prefixes")
+	}
+	expansions := make([]ipamv1alpha1.Ipp, 0)
+	for _, ipp := range ipps.GetIpPrefixes() {
+		if metav1.IsControlledBy(ipp, cr) {
+			expansions = append(expansions, ipp)
+		}
+	}
+	sort.Slice(expansions, func(i, j int) bool { return expansions[i].GetName() < expansions[j].GetName() })
+	return expansions, nil
+}
+
+// newExpansion returns the expansion with the name carved out of the aggregate
+// of the auto-expand policy with the tags of the ip prefix
+func newExpansion(cr ipamv1alpha1.Ipp, ae *ipamv1alpha1.IpamAutoExpand, name string) *ipamv1alpha1.IpamNetworkInstanceIpPrefix {
+	tags := cr.GetTags()
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tag := make([]*nddov1.Tag, 0, len(keys))
+	for _, key := range keys {
+		tag = append(tag, &nddov1.Tag{Key: utils.StringPtr(key), Value: utils.StringPtr(tags[key])})
+	}
+
+	expansion := &ipamv1alpha1.IpamNetworkInstanceIpPrefix{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cr.GetNamespace(),
+		},
+		Spec: ipamv1alpha1.IpamNetworkInstanceIpPrefixSpec{
+			IpamNetworkInstanceIpPrefix: &ipamv1alpha1.IpamIpamNetworkInstanceIpPrefix{
+				AdminState:  utils.StringPtr(ipamv1alpha1.AdminStateEnable),
+				Description: utils.StringPtr(fmt.Sprintf("expansion of %s", cr.GetName())),
+				Parent: &ipamv1alpha1.IpamIpamNetworkInstanceIpPrefixParent{
+					Selector:     ae.DeepCopy().Selector,
+					PrefixLength: utils.Uint32Ptr(*ae.PrefixLength),
+				},
+				Tag:            tag,
+				DeletionPolicy: utils.StringPtr(cr.GetDeletionPolicy()),
+			},
+		},
+	}
+	meta.AddOwnerReference(expansion, meta.AsController(meta.TypedReferenceTo(cr, ipamv1alpha1.IpamNetworkInstanceIpPrefixGroupVersionKind)))
+	return expansion
+}
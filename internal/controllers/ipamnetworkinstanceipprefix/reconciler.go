@@ -18,6 +18,7 @@ package ipamnetworkinstanceipprefix
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"time"
 
@@ -42,8 +43,6 @@ import (
 const (
 	// timers
 	reconcileTimeout = 1 * time.Minute
-	shortWait        = 5 * time.Second
-	veryShortWait    = 1 * time.Second
 	// errors
 	errUnexpectedResource = "unexpected infrastructure object"
 	errGetK8sResource     = "cannot get infrastructure resource"
@@ -59,7 +58,8 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 	//rrlfn := func() ipamv1alpha1.RrList { return &ipamv1alpha1.RegisterList{} }
 
 	events := make(chan gevent.GenericEvent)
-	//speedy := make(map[string]int)
+	ready := make(chan gevent.GenericEvent)
+	recorder := event.NewAPIRecorder(mgr.GetEventRecorderFor(name))
 
 	r := managed.NewReconciler(mgr,
 		resource.ManagedKind(ipamv1alpha1.IpamNetworkInstanceIpPrefixGroupVersionKind),
@@ -75,9 +75,10 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 			newIpamNetworkInstanceIpPrefixList: ipplfn,
 			registry:                           nddcopts.Registry,
 			handler:                            nddcopts.Handler,
+			recorder:                           recorder,
+			capacity:                           newCapacityTracker(),
 		}),
-		//managed.WithSpeedy(speedy),
-		managed.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
+		managed.WithRecorder(recorder),
 	)
 
 	registerHandler := &EnqueueRequestForAllRegisters{
@@ -104,16 +105,25 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 		newIpamNetworkInstanceIpPrefixList: ipplfn,
 	}
 
+	// the ip prefixes are reconciled as soon as the iptree of their network
+	// instance is ready
+	nddcopts.Handler.AddStateFn(shared.NotifyReady(ready))
+	// and when an allocation expanded a pool such that the expansion is
+	// recorded as ip prefix
+	nddcopts.Handler.AddExpansionFn(shared.NotifyExpanded(ready))
+
 	return ipamv1alpha1.IpamNetworkInstanceIpPrefixGroupKind, events, ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		WithOptions(o).
 		For(&ipamv1alpha1.IpamNetworkInstanceIpPrefix{}).
 		Owns(&ipamv1alpha1.Ipam{}).
+		Owns(&ipamv1alpha1.IpamNetworkInstanceIpPrefix{}).
 		WithEventFilter(resource.IgnoreUpdateWithoutGenerationChangePredicate()).
 		Watches(&source.Kind{Type: &ipamv1alpha1.Ipam{}}, ipamHandler).
 		Watches(&source.Kind{Type: &ipamv1alpha1.IpamNetworkInstance{}}, ipamNiHandler).
 		Watches(&source.Kind{Type: &ipamv1alpha1.Register{}}, registerHandler).
 		Watches(&source.Channel{Source: events}, registerHandler).
+		Watches(&source.Channel{Source: ready}, ipamNiHandler).
 		Complete(r)
 
 }
@@ -128,6 +138,8 @@ type application struct {
 
 	registry registry.Registry
 	handler  handler.Handler
+	recorder event.Recorder
+	capacity *capacityTracker
 }
 
 func getCrName(cr ipamv1alpha1.Ipp) string {
@@ -164,20 +176,6 @@ func (r *application) FinalUpdate(ctx context.Context, mg resource.Managed) {
 }
 
 func (r *application) Timeout(ctx context.Context, mg resource.Managed) time.Duration {
-	cr, _ := mg.(*ipamv1alpha1.IpamNetworkInstanceIpPrefix)
-	crName := getCrName(cr)
-	speedy := r.handler.GetSpeedy(crName)
-	if speedy <= 2 {
-		r.handler.IncrementSpeedy(crName)
-		r.log.Debug("Speedy incr", "number", r.handler.GetSpeedy(crName))
-		switch speedy {
-		case 0:
-			return veryShortWait
-		case 1, 2:
-			return shortWait
-		}
-
-	}
 	return reconcileTimeout
 }
 
@@ -189,19 +187,16 @@ func (r *application) Delete(ctx context.Context, mg resource.Managed) (bool, er
 	log := r.log.WithValues("function", "handleAppLogic", "crname", cr.GetName())
 	log.Debug("handleDelete")
 
-	registerInfo := &handler.RegisterInfo{
-		Namespace:           cr.GetNamespace(),
-		RegistryName:        cr.GetIpamName(),
-		Name:                cr.GetName(),
-		NetworkInstanceName: cr.GetNetworkInstanceName(),
-		CrName:              getCrName(cr),
-		IpPrefix:            cr.GetIpPrefix(),
+	// an ip prefix requested from a parent pool that was never carved has
+	// nothing to release
+	if cr.GetIpPrefix() == "" {
+		return true, nil
 	}
 
-	log.Debug("resource dealloc", "registerInfo", registerInfo)
-
-	if err := r.handler.DeRegister(ctx, registerInfo); err != nil {
-		return true, err
+	// the pool is only deleted once all its allocations are released, a
+	// carved pool returns its prefix to the parent pool
+	if err := r.handler.DeleteIpPrefix(getCrName(cr), cr); err != nil {
+		return false, err
 	}
 
 	return true, nil
@@ -212,8 +207,9 @@ func (r *application) FinalDelete(ctx context.Context, mg resource.Managed) {
 	if !ok {
 		return
 	}
-	crName := getCrName(cr)
-	r.handler.Delete(crName)
+	// the iptree of the network instance is owned by the network instance
+	// reconciler, the ip prefix itself is removed from it in Delete
+	r.capacity.delete(cr.GetName())
 }
 
 func (r *application) handleAppLogic(ctx context.Context, cr ipamv1alpha1.Ipp) (map[string]string, error) {
@@ -238,18 +234,59 @@ func (r *application) handleAppLogic(ctx context.Context, cr ipamv1alpha1.Ipp) (
 		return nil, errors.New("ipam ni not ready")
 	}
 
+	if cr.HasParent() {
+		prefix, err := r.handler.CarveIpPrefix(getCrName(cr), cr)
+		if err != nil {
+			cr.SetStatus("down")
+			cr.SetReason("cannot carve ip prefix from parent")
+			return nil, errors.Wrap(err, "cannot carve ip prefix from parent")
+		}
+		cr.SetIpPrefix(prefix)
+	}
+
 	if err := r.handler.AddIpPrefix(getCrName(cr), cr); err != nil {
 		return nil, err
 	}
 
+	if h, err := r.handler.GetPoolHierarchy(getCrName(cr), cr.GetIpPrefix()); err != nil {
+		log.Debug("cannot determine hierarchy", "error", err)
+	} else {
+		cr.SetHierarchy(h.Parent, h.Children)
+	}
+
+	if err := r.handleCapacity(cr, ni, getCrName(cr)); err != nil {
+		log.Debug("cannot determine capacity", "error", err)
+	}
+
+	if err := r.handleAutoExpand(ctx, cr, getCrName(cr)); err != nil {
+		log.Debug("cannot expand", "error", err)
+	}
+
+	tenants, err := r.handleDrain(cr, getCrName(cr))
+	if err != nil {
+		log.Debug("cannot determine tenants", "error", err)
+	}
+
 	cr.SetOrganization(cr.GetOrganization())
 	cr.SetDeployment(cr.GetDeployment())
 	cr.SetAvailabilityZone(cr.GetAvailabilityZone())
 	cr.SetIpamName(cr.GetIpamName())
 	cr.SetNetworkInstanceName(cr.GetNetworkInstanceName())
-	cr.SetStatus("up")
-	cr.SetReason("")
+	// a disabled pool stays in the iptree to keep its allocations
+	switch {
+	case ni.GetStatus() == "down":
+		cr.SetStatus("down")
+		cr.SetReason("ipam ni " + ni.GetReason())
+	case cr.GetAdminState() == ipamv1alpha1.AdminStateDisable:
+		cr.SetStatus("down")
+		cr.SetReason("admin disable")
+	case cr.GetLifecycle() == ipamv1alpha1.LifecycleDraining:
+		cr.SetStatus("up")
+		cr.SetReason(fmt.Sprintf("draining, %d tenants remaining", tenants))
+	default:
+		cr.SetStatus("up")
+		cr.SetReason("")
+	}
 
-	// trick to use speedy for fast updates
-	return map[string]string{"dummy": "dummy"}, nil
+	return nil, nil
 }
@@ -79,9 +79,6 @@ func (e *EnqueueRequestForAllIpams) add(obj runtime.Object, queue adder) {
 	for _, ipp := range d.GetIpPrefixes() {
 		// only enqueue if the org and/or deployment name match
 		if ipp.GetIpamName() == dd.GetIpamName() {
-			crName := getCrName(ipp)
-			e.handler.ResetSpeedy(crName)
-
 			queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{
 				Namespace: ipp.GetNamespace(),
 				Name:      ipp.GetName()}})
@@ -82,9 +82,6 @@ func (e *EnqueueRequestForAllIpamNetworkInstances) add(obj runtime.Object, queue
 			ipp.GetDeployment() == dd.GetDeployment() &&
 			ipp.GetIpamName() == dd.GetIpamName() &&
 			ipp.GetNetworkInstanceName() == dd.GetNetworkInstanceName() {
-			crName := getCrName(ipp)
-			e.handler.ResetSpeedy(crName)
-
 			queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{
 				Namespace: ipp.GetNamespace(),
 				Name:      ipp.GetName()}})
@@ -85,10 +85,6 @@ func (e *EnqueueRequestForAllRegisters) add(obj runtime.Object, queue adder) {
 			ipp.GetDeployment() == dd.GetDeployment() &&
 			ipp.GetIpamName() == dd.GetIpamName() &&
 			ipp.GetNetworkInstanceName() == dd.GetNetworkInstanceName() {
-
-			crName := getCrName(ipp)
-			e.handler.ResetSpeedy(crName)
-
 			queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{
 				Namespace: ipp.GetNamespace(),
 				Name:      ipp.GetName()}})
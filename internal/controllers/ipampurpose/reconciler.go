@@ -0,0 +1,108 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipampurpose
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yndd/ndd-runtime/pkg/event"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/nddo-runtime/pkg/reconciler/managed"
+	"github.com/yndd/nddo-runtime/pkg/resource"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"github.com/yndd/nddr-ipam-registry/internal/handler"
+	"github.com/yndd/nddr-ipam-registry/internal/shared"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	gevent "sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	// timers
+	reconcileTimeout = 1 * time.Minute
+	// errors
+	errUnexpectedResource = "unexpected infrastructure object"
+)
+
+// Setup adds a controller that reconciles the purpose catalogue.
+func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControllerOptions) (string, chan gevent.GenericEvent, error) {
+	name := "nddo/" + strings.ToLower(ipamv1alpha1.IpamPurposeGroupKind)
+
+	events := make(chan gevent.GenericEvent)
+
+	r := managed.NewReconciler(mgr,
+		resource.ManagedKind(ipamv1alpha1.IpamPurposeGroupVersionKind),
+		managed.WithLogger(nddcopts.Logger.WithValues("controller", name)),
+		managed.WithApplication(&application{
+			log:     nddcopts.Logger.WithValues("applogic", name),
+			handler: nddcopts.Handler,
+		}),
+		managed.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
+	)
+
+	return ipamv1alpha1.IpamPurposeGroupKind, events, ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		WithOptions(o).
+		For(&ipamv1alpha1.IpamPurpose{}).
+		WithEventFilter(resource.IgnoreUpdateWithoutGenerationChangePredicate()).
+		Complete(r)
+}
+
+type application struct {
+	log     logging.Logger
+	handler handler.Handler
+}
+
+func (r *application) Initialize(ctx context.Context, mg resource.Managed) error {
+	return nil
+}
+
+func (r *application) Update(ctx context.Context, mg resource.Managed) (map[string]string, error) {
+	cr, ok := mg.(*ipamv1alpha1.IpamPurpose)
+	if !ok {
+		return nil, errors.New(errUnexpectedResource)
+	}
+	r.log.Debug("update purpose", "purpose", cr.GetPurposeName())
+
+	// the handler keeps a copy since the reconciler reuses the object
+	r.handler.SetPurpose(cr.DeepCopy())
+	return nil, nil
+}
+
+func (r *application) FinalUpdate(ctx context.Context, mg resource.Managed) {
+}
+
+func (r *application) Timeout(ctx context.Context, mg resource.Managed) time.Duration {
+	return reconcileTimeout
+}
+
+func (r *application) Delete(ctx context.Context, mg resource.Managed) (bool, error) {
+	cr, ok := mg.(*ipamv1alpha1.IpamPurpose)
+	if !ok {
+		return false, errors.New(errUnexpectedResource)
+	}
+	r.log.Debug("delete purpose", "purpose", cr.GetPurposeName())
+
+	r.handler.DeletePurpose(cr.GetPurposeName())
+	return true, nil
+}
+
+func (r *application) FinalDelete(ctx context.Context, mg resource.Managed) {
+}
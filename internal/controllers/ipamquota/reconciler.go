@@ -0,0 +1,122 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipamquota
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/yndd/ndd-runtime/pkg/event"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/nddo-runtime/pkg/reconciler/managed"
+	"github.com/yndd/nddo-runtime/pkg/resource"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"github.com/yndd/nddr-ipam-registry/internal/handler"
+	"github.com/yndd/nddr-ipam-registry/internal/shared"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	gevent "sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	// timers, the usage in the status is refreshed at this interval
+	reconcileTimeout = 1 * time.Minute
+	// errors
+	errUnexpectedResource = "unexpected infrastructure object"
+)
+
+// Setup adds a controller that reconciles the quota catalogue.
+func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControllerOptions) (string, chan gevent.GenericEvent, error) {
+	name := "nddo/" + strings.ToLower(ipamv1alpha1.IpamQuotaGroupKind)
+
+	events := make(chan gevent.GenericEvent)
+
+	r := managed.NewReconciler(mgr,
+		resource.ManagedKind(ipamv1alpha1.IpamQuotaGroupVersionKind),
+		managed.WithLogger(nddcopts.Logger.WithValues("controller", name)),
+		managed.WithApplication(&application{
+			log:     nddcopts.Logger.WithValues("applogic", name),
+			handler: nddcopts.Handler,
+		}),
+		managed.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
+	)
+
+	return ipamv1alpha1.IpamQuotaGroupKind, events, ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		WithOptions(o).
+		For(&ipamv1alpha1.IpamQuota{}).
+		WithEventFilter(resource.IgnoreUpdateWithoutGenerationChangePredicate()).
+		Complete(r)
+}
+
+type application struct {
+	log     logging.Logger
+	handler handler.Handler
+}
+
+func (r *application) Initialize(ctx context.Context, mg resource.Managed) error {
+	return nil
+}
+
+func (r *application) Update(ctx context.Context, mg resource.Managed) (map[string]string, error) {
+	cr, ok := mg.(*ipamv1alpha1.IpamQuota)
+	if !ok {
+		return nil, errors.New(errUnexpectedResource)
+	}
+	r.log.Debug("update quota", "namespace", cr.GetNamespace(), "quota", cr.GetName())
+
+	// the handler keeps a copy since the reconciler reuses the object
+	if err := r.handler.SetQuota(cr.DeepCopy()); err != nil {
+		return nil, err
+	}
+
+	usage, err := r.handler.GetQuotaUsage(cr.GetNamespace(), cr.GetName())
+	if err != nil {
+		return nil, err
+	}
+	// the addresses of ipv6 allocations can exceed the status field
+	addresses := uint64(math.MaxUint64)
+	if usage.Addresses < math.MaxUint64 {
+		addresses = uint64(usage.Addresses)
+	}
+	cr.SetUsed(usage.Allocations, addresses)
+	return nil, nil
+}
+
+func (r *application) FinalUpdate(ctx context.Context, mg resource.Managed) {
+}
+
+func (r *application) Timeout(ctx context.Context, mg resource.Managed) time.Duration {
+	return reconcileTimeout
+}
+
+func (r *application) Delete(ctx context.Context, mg resource.Managed) (bool, error) {
+	cr, ok := mg.(*ipamv1alpha1.IpamQuota)
+	if !ok {
+		return false, errors.New(errUnexpectedResource)
+	}
+	r.log.Debug("delete quota", "namespace", cr.GetNamespace(), "quota", cr.GetName())
+
+	r.handler.DeleteQuota(cr.GetNamespace(), cr.GetName())
+	return true, nil
+}
+
+func (r *application) FinalDelete(ctx context.Context, mg resource.Managed) {
+}
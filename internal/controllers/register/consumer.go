@@ -0,0 +1,185 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package register
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/event"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/nddo-runtime/pkg/resource"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"github.com/yndd/nddr-ipam-registry/internal/handler"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// errors
+	errGetConsumer     = "cannot get consumer"
+	errMapConsumer     = "cannot map consumer kind"
+	errOwnConsumer     = "cannot add the consumer as owner of the register"
+	errWatchConsumer   = "cannot watch consumer kind"
+	errDeleteRegister  = "cannot delete register"
+	errConsumerWatcher = "consumer watcher not started"
+)
+
+// handleConsumer reports if the consumer of the register is gone, a consumer
+// that is being deleted or was recreated with another uid is gone as well.
+// A consumer in the namespace of the register becomes its owner, such that the
+// garbage collector deletes the register with the consumer and the finalizer
+// of the register releases the prefix. The other consumers, which are cluster
+// scoped, are watched.
+func (r *application) handleConsumer(ctx context.Context, cr ipamv1alpha1.Rr) (bool, error) {
+	c := cr.GetConsumer()
+	if c == nil || c.ApiVersion == nil || c.Kind == nil || c.Name == nil {
+		return false, nil
+	}
+	gvk := schema.FromAPIVersionAndKind(*c.ApiVersion, *c.Kind)
+	mapping, err := r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return false, errors.Wrap(err, errMapConsumer)
+	}
+	namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+	if namespaced && ownedByConsumer(cr, c) {
+		return false, nil
+	}
+
+	// a namespaced consumer is read once before it becomes the owner, the
+	// cluster scoped consumers are read from the cache of their watch
+	reader := r.reader
+	key := types.NamespacedName{Name: *c.Name}
+	if namespaced {
+		key.Namespace = cr.GetNamespace()
+	} else {
+		if err := r.consumers.watch(gvk); err != nil {
+			return false, err
+		}
+		reader = r.consumers.cache
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	if err := reader.Get(ctx, key, u); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, errors.Wrap(err, errGetConsumer)
+	}
+	if c.Uid != nil && *c.Uid != "" && string(u.GetUID()) != *c.Uid {
+		return true, nil
+	}
+	if u.GetDeletionTimestamp() != nil {
+		return true, nil
+	}
+	if namespaced {
+		return false, r.ownConsumer(ctx, cr, u)
+	}
+	return false, nil
+}
+
+// ownedByConsumer reports if the consumer is an owner of the register
+func ownedByConsumer(cr ipamv1alpha1.Rr, c *ipamv1alpha1.ConsumerReference) bool {
+	for _, ref := range cr.GetOwnerReferences() {
+		if ref.APIVersion == *c.ApiVersion && ref.Kind == *c.Kind && ref.Name == *c.Name &&
+			(c.Uid == nil || *c.Uid == "" || string(ref.UID) == *c.Uid) {
+			return true
+		}
+	}
+	return false
+}
+
+// ownConsumer adds the consumer as owner of the register
+func (r *application) ownConsumer(ctx context.Context, cr ipamv1alpha1.Rr, u *unstructured.Unstructured) error {
+	patch := client.MergeFrom(cr.DeepCopyObject().(client.Object))
+	cr.SetOwnerReferences(append(cr.GetOwnerReferences(), metav1.OwnerReference{
+		APIVersion: u.GetAPIVersion(),
+		Kind:       u.GetKind(),
+		Name:       u.GetName(),
+		UID:        u.GetUID(),
+	}))
+	return errors.Wrap(r.client.Patch(ctx, cr, patch), errOwnConsumer)
+}
+
+// collect releases the prefix of a register of which the consumer is gone and
+// deletes the register, the finalizer of the register finds the prefix already
+// released
+func (r *application) collect(ctx context.Context, cr ipamv1alpha1.Rr) error {
+	c := cr.GetConsumer()
+	consumer := *c.Kind + "/" + *c.Name
+	if prefix, ok := cr.HasIpPrefix(); ok {
+		if err := r.handler.DeRegister(ctx, getAllocatedInfo(cr, prefix)); err != nil && !handler.IsNotFound(err) {
+			return err
+		}
+		r.recorder.Event(cr, event.Normal(reasonConsumerGone, "released the ip prefix of the deleted consumer", "consumer", consumer, "ip-prefix", prefix))
+	}
+	if err := r.client.Delete(ctx, cr); resource.IgnoreNotFound(err) != nil {
+		return errors.Wrap(err, errDeleteRegister)
+	}
+	r.recorder.Event(cr, event.Normal(reasonConsumerGone, "deleted the register of the deleted consumer", "consumer", consumer))
+	return nil
+}
+
+// consumerWatcher watches the kinds of the cluster scoped consumers, which
+// cannot own a register, the first time a register references them
+type consumerWatcher struct {
+	mu         sync.Mutex
+	controller controller.Controller
+	cache      client.Reader
+	handler    *EnqueueRequestForAllConsumers
+	watched    map[schema.GroupVersionKind]bool
+}
+
+func newConsumerWatcher(cache client.Reader, client client.Client, log logging.Logger, newRegisterList func() ipamv1alpha1.RrList) *consumerWatcher {
+	return &consumerWatcher{
+		cache: cache,
+		handler: &EnqueueRequestForAllConsumers{
+			client:          client,
+			log:             log,
+			ctx:             context.Background(),
+			newRegisterList: newRegisterList,
+		},
+		watched: make(map[schema.GroupVersionKind]bool),
+	}
+}
+
+// watch starts the watch of the consumer kind when it is not watched yet
+func (w *consumerWatcher) watch(gvk schema.GroupVersionKind) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watched[gvk] {
+		return nil
+	}
+	if w.controller == nil {
+		return errors.New(errConsumerWatcher)
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	if err := w.controller.Watch(&source.Kind{Type: u}, w.handler); err != nil {
+		return errors.Wrap(err, errWatchConsumer)
+	}
+	w.watched[gvk] = true
+	return nil
+}
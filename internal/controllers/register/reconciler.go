@@ -18,39 +18,53 @@ package register
 
 import (
 	"context"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/yndd/ndd-runtime/pkg/event"
 	"github.com/yndd/ndd-runtime/pkg/logging"
-	"github.com/yndd/nddo-runtime/pkg/odns"
 	"github.com/yndd/nddo-runtime/pkg/reconciler/managed"
 	"github.com/yndd/nddo-runtime/pkg/resource"
 	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
 	"github.com/yndd/nddr-ipam-registry/internal/handler"
 	"github.com/yndd/nddr-ipam-registry/internal/shared"
 	"github.com/yndd/nddr-org-registry/pkg/registry"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	gevent "sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
 	// timers
 	reconcileTimeout = 1 * time.Minute
-	veryShortWait    = 1 * time.Second
 	// errors
 	errUnexpectedResource = "unexpected infrastructure object"
 	errGetK8sResource     = "cannot get infrastructure resource"
+	errTargetNotProvided  = "registry-name or network-instance-name not provided and not derivable from the register name"
+	// event reasons
+	reasonMigrated      event.Reason = "Migrated"
+	reasonMigrateFailed event.Reason = "MigrateFailed"
+	reasonConsumerGone  event.Reason = "ConsumerGone"
 )
 
 // Setup adds a controller that reconciles infra.
-func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControllerOptions) error {
+func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControllerOptions) (string, chan gevent.GenericEvent, error) {
 	name := "nddo/" + strings.ToLower(ipamv1alpha1.RegisterGroupKind)
 	ipfn := func() ipamv1alpha1.Ip { return &ipamv1alpha1.Ipam{} }
 	//rglfn := func() ipamv1alpha1.RgList { return &ipamv1alpha1.RegistryList{} }
 	//rrfn := func() ipamv1alpha1.Rr { return &ipamv1alpha1.Register{} }
-	//rrlfn := func() ipamv1alpha1.RrList { return &ipamv1alpha1.RegisterList{} }
+	rrlfn := func() ipamv1alpha1.RrList { return &ipamv1alpha1.RegisterList{} }
+
+	events := make(chan gevent.GenericEvent)
+	recorder := event.NewAPIRecorder(mgr.GetEventRecorderFor(name))
+
+	consumers := newConsumerWatcher(mgr.GetCache(), mgr.GetClient(), nddcopts.Logger, rrlfn)
 
 	r := managed.NewReconciler(mgr,
 		resource.ManagedKind(ipamv1alpha1.RegisterGroupVersionKind),
@@ -60,38 +74,64 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 				Client:     mgr.GetClient(),
 				Applicator: resource.NewAPIPatchingApplicator(mgr.GetClient()),
 			},
-			log:      nddcopts.Logger.WithValues("applogic", name),
-			newIpam:  ipfn,
-			handler:  nddcopts.Handler,
-			registry: nddcopts.Registry,
+			reader:    mgr.GetAPIReader(),
+			mapper:    mgr.GetRESTMapper(),
+			consumers: consumers,
+			log:       nddcopts.Logger.WithValues("applogic", name),
+			newIpam:   ipfn,
+			handler:   nddcopts.Handler,
+			registry:  nddcopts.Registry,
+			recorder:  recorder,
 		}),
-		managed.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
+		managed.WithRecorder(recorder),
 	)
 
-	return ctrl.NewControllerManagedBy(mgr).
+	ipamNiHandler := &EnqueueRequestForAllIpamNetworkInstances{
+		client:          mgr.GetClient(),
+		log:             nddcopts.Logger,
+		ctx:             context.Background(),
+		newRegisterList: rrlfn,
+	}
+
+	// the registers are reconciled as soon as the iptree of their network
+	// instance is ready
+	nddcopts.Handler.AddStateFn(shared.NotifyReady(events))
+
+	c, err := ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		WithOptions(o).
 		For(&ipamv1alpha1.Register{}).
 		Owns(&ipamv1alpha1.Register{}).
 		WithEventFilter(resource.IgnoreUpdateWithoutGenerationChangePredicate()).
 		WithEventFilter(resource.IgnoreUpdateWithoutGenerationChangePredicate()).
-		Complete(r)
-
+		Watches(&source.Channel{Source: events}, ipamNiHandler).
+		Build(r)
+	if err != nil {
+		return "", nil, err
+	}
+	// the kinds of the consumers are only known once they are referenced
+	consumers.controller = c
+	return ipamv1alpha1.RegisterGroupKind, events, nil
 }
 
 type application struct {
 	client resource.ClientApplicator
-	log    logging.Logger
+	// reader gets the namespaced consumers uncached, since they can be of any
+	// kind, they are only read until they own the register
+	reader client.Reader
+	mapper meta.RESTMapper
+	// consumers watches the kinds of the cluster scoped consumers
+	consumers *consumerWatcher
+	log       logging.Logger
 
 	newIpam func() ipamv1alpha1.Ip
 
 	//pool    map[string]hash.HashTable
-	handler handler.Handler
-	//speedy   map[string]int
+	handler  handler.Handler
 	registry registry.Registry
+	recorder event.Recorder
 
 	//poolmutex sync.Mutex
-	//speedyMutex sync.Mutex
 }
 
 func getCrName(cr ipamv1alpha1.Rr) string {
@@ -118,18 +158,6 @@ func (r *application) FinalUpdate(ctx context.Context, mg resource.Managed) {
 }
 
 func (r *application) Timeout(ctx context.Context, mg resource.Managed) time.Duration {
-	/*
-		cr, _ := mg.(*ipamv1alpha1.Registry)
-		crName := getCrName(cr)
-		r.speedyMutex.Lock()
-		speedy := r.speedy[crName]
-		r.speedyMutex.Unlock()
-		if speedy <= 5 {
-			r.log.Debug("Speedy", "number", speedy)
-			speedy++
-			return veryShortWait
-		}
-	*/
 	return reconcileTimeout
 }
 
@@ -142,20 +170,13 @@ func (r *application) Delete(ctx context.Context, mg resource.Managed) (bool, er
 	log.Debug("handleDelete")
 
 	if prefix, ok := cr.HasIpPrefix(); ok {
-		registerInfo := &handler.RegisterInfo{
-			Namespace:           cr.GetNamespace(),
-			RegistryName:        cr.GetIpamName(),
-			Name:                cr.GetName(),
-			NetworkInstanceName: odns.GetParentResourceName(cr.GetName()),
-			CrName:              getCrName(cr),
-			IpPrefix:            prefix,
-			Selector:            cr.GetSelector(),
-			SourceTag:           cr.GetSourceTag(),
-		}
+		registerInfo := getAllocatedInfo(cr, prefix)
 
 		log.Debug("resource dealloc", "registerInfo", registerInfo)
 
-		if err := r.handler.DeRegister(ctx, registerInfo); err != nil {
+		// the prefix is already released when the register reflects an
+		// allocation that was released over grpc
+		if err := r.handler.DeRegister(ctx, registerInfo); err != nil && !handler.IsNotFound(err) {
 			return true, err
 		}
 	}
@@ -171,19 +192,33 @@ func (r *application) handleAppLogic(ctx context.Context, cr ipamv1alpha1.Rr) (m
 	log := r.log.WithValues("function", "handleAppLogic", "crname", cr.GetName())
 	log.Debug("handleAppLogic")
 
+	gone, err := r.handleConsumer(ctx, cr)
+	if err != nil {
+		return nil, err
+	}
+	if gone {
+		return nil, r.collect(ctx, cr)
+	}
+
+	// the purpose and address-family are in the selector or else selected
+	// with an In match-expression
 	selector := cr.GetSelector()
-	if _, ok := selector[ipamv1alpha1.KeyPurpose]; !ok {
+	if len(ipamv1alpha1.SelectorValues(selector, cr.GetMatchExpressions(), ipamv1alpha1.KeyPurpose)) == 0 {
 		return nil, errors.New("pupose not provided in resource request")
 	}
 
-	if _, ok := selector[ipamv1alpha1.KeyAddressFamily]; !ok {
+	if len(ipamv1alpha1.SelectorValues(selector, cr.GetMatchExpressions(), ipamv1alpha1.KeyAddressFamily)) == 0 {
 		return nil, errors.New("af not provided in resource request")
 	}
 
+	if cr.GetIpamName() == "" || cr.GetNetworkInstanceName() == "" {
+		return nil, errors.New(errTargetNotProvided)
+	}
+
 	registerInfo := &handler.RegisterInfo{
 		Namespace:           cr.GetNamespace(),
 		RegistryName:        cr.GetIpamName(),
-		NetworkInstanceName: odns.GetParentResourceName(cr.GetName()),
+		NetworkInstanceName: cr.GetNetworkInstanceName(),
 		Name:                cr.GetName(),
 		CrName:              getCrName(cr),
 		Purpose:             selector[ipamv1alpha1.KeyPurpose],
@@ -191,16 +226,53 @@ func (r *application) handleAppLogic(ctx context.Context, cr ipamv1alpha1.Rr) (m
 		IpPrefix:            cr.GetIpPrefix(),
 		Selector:            selector,
 		SourceTag:           cr.GetSourceTag(),
+		MatchExpressions:    cr.GetMatchExpressions(),
+		RequestId:           cr.GetRequestId(),
 	}
 
-	log.Debug("resource alloc", "registerInfo", registerInfo)
+	var ipPrefix *string
+	var migrated bool
+	prefix, allocated := cr.HasIpPrefix()
+	switch {
+	case allocated && allocationChanged(cr, prefix):
+		// the spec changed since the prefix was allocated, release the prefix
+		// and allocate a new one in a single transaction
+		from := getAllocatedInfo(cr, prefix)
+
+		log.Debug("resource realloc", "from", from, "registerInfo", registerInfo)
+
+		ipPrefix, err = r.handler.Reallocate(ctx, from, registerInfo)
+	case allocated && cr.GetIpPrefix() == "" && r.handler.Migrating(getCrName(cr), prefix):
+		// the prefix is allocated from a draining pool, migrate it to another
+		// pool; the allocation is kept when no other pool is available
+		from := getAllocatedInfo(cr, prefix)
+
+		log.Debug("resource migrate", "from", from, "registerInfo", registerInfo)
+
+		ipPrefix, err = r.handler.Reallocate(ctx, from, registerInfo)
+		if err != nil {
+			r.recorder.Event(cr, event.Warning(reasonMigrateFailed, err, "from", prefix))
+			ipPrefix, err = &prefix, nil
+		} else {
+			migrated = true
+		}
+	default:
+		log.Debug("resource alloc", "registerInfo", registerInfo)
 
-	ipPrefix, err := r.handler.Register(ctx, registerInfo)
+		ipPrefix, err = r.handler.Register(ctx, registerInfo)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	cr.SetIpPrefix(*ipPrefix)
+	cr.SetRequestId(registerInfo.RequestId)
+	if migrated {
+		cr.SetMigratedFrom(prefix)
+		r.recorder.Event(cr, event.Normal(reasonMigrated, "migrated from a draining ip prefix", "from", prefix, "to", *ipPrefix))
+	} else if allocated && prefix != *ipPrefix {
+		cr.SetMigratedFrom("")
+	}
 
 	cr.SetOrganization(cr.GetOrganization())
 	cr.SetDeployment(cr.GetDeployment())
@@ -210,3 +282,53 @@ func (r *application) handleAppLogic(ctx context.Context, cr ipamv1alpha1.Rr) (m
 
 	return nil, nil
 }
+
+// getAllocatedInfo returns the register info of the prefix allocated to the
+// register, registers allocated before the selector was recorded in the status
+// use the selector and source-tag of their spec
+func getAllocatedInfo(cr ipamv1alpha1.Rr, prefix string) *handler.RegisterInfo {
+	selector := cr.GetAllocatedSelector()
+	sourceTag := cr.GetAllocatedSourceTag()
+	exprs := cr.GetAllocatedMatchExpressions()
+	if len(selector) == 0 {
+		selector = cr.GetSelector()
+		sourceTag = cr.GetSourceTag()
+		exprs = cr.GetMatchExpressions()
+	}
+	return &handler.RegisterInfo{
+		Namespace:           cr.GetNamespace(),
+		RegistryName:        cr.GetIpamName(),
+		NetworkInstanceName: cr.GetNetworkInstanceName(),
+		Name:                cr.GetName(),
+		CrName:              getCrName(cr),
+		Purpose:             selector[ipamv1alpha1.KeyPurpose],
+		AddressFamily:       selector[ipamv1alpha1.KeyAddressFamily],
+		IpPrefix:            prefix,
+		Selector:            selector,
+		SourceTag:           sourceTag,
+		MatchExpressions:    exprs,
+	}
+}
+
+// allocationChanged reports if the spec of the register no longer matches the
+// allocated prefix, registers allocated before the selector was recorded in
+// the status are only compared on their ip prefix
+func allocationChanged(cr ipamv1alpha1.Rr, prefix string) bool {
+	if p := cr.GetIpPrefix(); p != "" && p != prefix {
+		return true
+	}
+	allocated := cr.GetAllocatedSelector()
+	if len(allocated) == 0 {
+		return false
+	}
+	return !reflect.DeepEqual(allocated, cr.GetSelector()) ||
+		!reflect.DeepEqual(cr.GetAllocatedSourceTag(), cr.GetSourceTag()) ||
+		!equalExpressions(cr.GetAllocatedMatchExpressions(), cr.GetMatchExpressions())
+}
+
+func equalExpressions(a, b []metav1.LabelSelectorRequirement) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package register
+
+import (
+	"context"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type adder interface {
+	Add(item interface{})
+}
+
+type EnqueueRequestForAllIpamNetworkInstances struct {
+	client client.Client
+	log    logging.Logger
+	ctx    context.Context
+
+	newRegisterList func() ipamv1alpha1.RrList
+}
+
+// Create enqueues a request for all registers of the network instance.
+func (e *EnqueueRequestForAllIpamNetworkInstances) Create(evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+	e.add(evt.Object, q)
+}
+
+// Update enqueues a request for all registers of the network instance.
+func (e *EnqueueRequestForAllIpamNetworkInstances) Update(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	e.add(evt.ObjectOld, q)
+	e.add(evt.ObjectNew, q)
+}
+
+// Delete enqueues a request for all registers of the network instance.
+func (e *EnqueueRequestForAllIpamNetworkInstances) Delete(evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	e.add(evt.Object, q)
+}
+
+// Generic enqueues a request for all registers of the network instance.
+func (e *EnqueueRequestForAllIpamNetworkInstances) Generic(evt event.GenericEvent, q workqueue.RateLimitingInterface) {
+	e.add(evt.Object, q)
+}
+
+func (e *EnqueueRequestForAllIpamNetworkInstances) add(obj runtime.Object, queue adder) {
+	dd, ok := obj.(*ipamv1alpha1.IpamNetworkInstance)
+	if !ok {
+		return
+	}
+	log := e.log.WithValues("function", "watch ipam ni", "name", dd.GetName())
+	log.Debug("handleEvent")
+
+	d := e.newRegisterList()
+	if err := e.client.List(e.ctx, d, client.InNamespace(dd.GetNamespace())); err != nil {
+		return
+	}
+
+	for _, rr := range d.GetRegisters() {
+		// only enqueue the registers that reference the network instance
+		if rr.GetIpamName() == dd.GetIpamName() &&
+			rr.GetNetworkInstanceName() == dd.GetNetworkInstanceName() {
+			queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: rr.GetNamespace(),
+				Name:      rr.GetName()}})
+		}
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2021 NDDO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcserver
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/yndd/nddo-grpc/resource/resourcepb"
+	"github.com/yndd/nddr-ipam-registry/internal/handler"
+	"github.com/yndd/nddr-ipam-registry/pkg/ipampb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/client-go/util/retry"
+)
+
+// keySyncError is set in the data of the reply of a committed bulk item of
+// which the register object could not be synced
+const keySyncError = "sync-error"
+
+type bulkFn func(context.Context, []*handler.RegisterInfo) ([]*handler.RegisterResult, error)
+
+// syncFn reflects the result of a bulk item in its register object
+type syncFn func(context.Context, *resourcepb.Request) error
+
+// bulkStream is the stream of the BulkRequest and BulkRelease rpcs
+type bulkStream interface {
+	Send(*resourcepb.Reply) error
+	Recv() (*resourcepb.Request, error)
+	Context() context.Context
+}
+
+func (r *server) BulkRequest(stream ipampb.Ipam_BulkRequestServer) error {
+	validate := func(req *resourcepb.Request) error {
+		if err := validateRequest(req); err != nil {
+			return err
+		}
+		return r.checkRegister(stream.Context(), req)
+	}
+	return r.bulk(stream, "bulk alloc", validate, r.handler.RegisterBulk, r.applyRegister)
+}
+
+func (r *server) BulkRelease(stream ipampb.Ipam_BulkReleaseServer) error {
+	return r.bulk(stream, "bulk dealloc", validateRelease, r.handler.DeRegisterBulk, r.deleteRegister)
+}
+
+// bulk receives all items of the stream before handing them to the handler in
+// one operation, afterwards the register objects of the items are synced and a
+// reply is sent for every item in the same order. The items are committed by
+// the handler, so an item of which the register object cannot be synced is
+// still reported ready, with the sync error in its data.
+func (r *server) bulk(stream bulkStream, op string, validate func(*resourcepb.Request) error, fn bulkFn, sync syncFn) error {
+	log := r.log.WithValues("operation", op)
+
+	reqs := make([]*resourcepb.Request, 0)
+	infos := make([]*handler.RegisterInfo, 0)
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if validate != nil {
+			if err := validate(req); err != nil {
+				return status.Errorf(codes.InvalidArgument, "bulk item %d: %s", len(infos), err)
+			}
+		}
+		reqs = append(reqs, req)
+		infos = append(infos, getRegisterInfo(req))
+	}
+	log.Debug(op, "items", len(infos))
+
+	results, err := fn(stream.Context(), infos)
+	syncErrs := make([]error, len(results))
+	if err == nil {
+		for i := range results {
+			// the api server can be briefly unavailable, the sync is retried
+			// before the item is reported as not reflected
+			syncErrs[i] = retry.OnError(retry.DefaultBackoff, func(error) bool { return true }, func() error {
+				return sync(stream.Context(), reqs[i])
+			})
+			if syncErrs[i] != nil {
+				log.Debug(op, "item", i, "error", syncErrs[i])
+			}
+		}
+	}
+	for i, result := range results {
+		reply := &resourcepb.Reply{
+			Ready:     result.Err == nil,
+			Timestamp: time.Now().UnixNano(),
+			Data:      map[string]*resourcepb.TypedValue{},
+		}
+		if result.Prefix != nil {
+			reply.Data["ip-prefix"] = &resourcepb.TypedValue{Value: &resourcepb.TypedValue_StringVal{StringVal: *result.Prefix}}
+		}
+		if result.Err != nil {
+			reply.Data["error"] = &resourcepb.TypedValue{Value: &resourcepb.TypedValue_StringVal{StringVal: result.Err.Error()}}
+		}
+		// a retry of the item syncs its register object again
+		if syncErrs[i] != nil {
+			reply.Data[keySyncError] = &resourcepb.TypedValue{Value: &resourcepb.TypedValue_StringVal{StringVal: syncErrs[i].Error()}}
+		}
+		if err := stream.Send(reply); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		log.Debug(op, "error", err)
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	"github.com/yndd/nddo-grpc/resource/resourcepb"
+	nddov1 "github.com/yndd/nddo-runtime/apis/common/v1"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// labelOrigin is set on the register objects created for a resource
+	// request received over grpc
+	labelOrigin = "ipam.nddr.yndd.io/origin"
+	originGrpc  = "grpc"
+
+	// errors
+	errGetRegister    = "cannot get register"
+	errCreateRegister = "cannot create register"
+	errDeleteRegister = "cannot delete register"
+)
+
+// checkRegister verifies the register object of the request, when it exists,
+// allocates for the same network instance, selector and source-tag as the
+// request such that it can be adopted
+func (r *server) checkRegister(ctx context.Context, req *resourcepb.Request) error {
+	cr := &ipamv1alpha1.Register{}
+	if err := r.client.Get(ctx, registerKey(req), cr); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, errGetRegister)
+	}
+	if cr.GetDeletionTimestamp() != nil {
+		return fmt.Errorf("register %s is being deleted", cr.GetName())
+	}
+	registryName, networkInstanceName := getTarget(req)
+	exprs, err := getMatchExpressions(req)
+	if err != nil {
+		return err
+	}
+	if cr.Spec.Register == nil ||
+		cr.GetIpamName() != registryName ||
+		cr.GetNetworkInstanceName() != networkInstanceName ||
+		!equalTags(cr.GetSelector(), req.GetRequest().GetSelector()) ||
+		!equalTags(cr.GetSourceTag(), req.GetRequest().GetSourceTag()) ||
+		!equalExpressions(cr.GetMatchExpressions(), exprs) {
+		return fmt.Errorf("register %s exists for another allocation", cr.GetName())
+	}
+	return nil
+}
+
+// applyRegister creates the register object reflecting the allocation of the
+// request, an existing register object is adopted as is since checkRegister
+// verified it allocates the same prefix
+func (r *server) applyRegister(ctx context.Context, req *resourcepb.Request) error {
+	registryName, networkInstanceName := getTarget(req)
+	exprs, err := getMatchExpressions(req)
+	if err != nil {
+		return err
+	}
+	cr := &ipamv1alpha1.Register{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      req.GetRegisterName(),
+			Namespace: req.GetNamespace(),
+			Labels:    map[string]string{labelOrigin: originGrpc},
+		},
+		Spec: ipamv1alpha1.RegisterSpec{
+			RegistryName:        utils.StringPtr(registryName),
+			NetworkInstanceName: utils.StringPtr(networkInstanceName),
+			Register: &ipamv1alpha1.IpamRegister{
+				Selector:         toTags(req.GetRequest().GetSelector()),
+				SourceTag:        toTags(req.GetRequest().GetSourceTag()),
+				MatchExpressions: exprs,
+			},
+		},
+	}
+	if afs := ipamv1alpha1.SelectorValues(req.GetRequest().GetSelector(), exprs, ipamv1alpha1.KeyAddressFamily); len(afs) == 1 {
+		cr.Spec.Register.AddressFamily = utils.StringPtr(afs[0])
+	}
+	if p := req.GetRequest().GetIpPrefix(); p != "" {
+		cr.Spec.Register.IpPrefix = utils.StringPtr(p)
+	}
+	if id := req.GetRequest().GetData()[ipamv1alpha1.KeyRequestId].GetStringVal(); id != "" {
+		cr.SetAnnotations(map[string]string{ipamv1alpha1.AnnotationRequestId: id})
+	}
+	cr.Spec.Consumer = getConsumer(req)
+	if err := r.client.Create(ctx, cr); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrap(err, errCreateRegister)
+	}
+	return nil
+}
+
+// deleteRegister deletes the register object of the released request
+func (r *server) deleteRegister(ctx context.Context, req *resourcepb.Request) error {
+	cr := &ipamv1alpha1.Register{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      req.GetRegisterName(),
+			Namespace: req.GetNamespace(),
+		},
+	}
+	if err := r.client.Delete(ctx, cr); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, errDeleteRegister)
+	}
+	return nil
+}
+
+// getConsumer returns the consumer referenced in the data of the request, nil
+// when the request has no consumer
+func getConsumer(req *resourcepb.Request) *ipamv1alpha1.ConsumerReference {
+	data := req.GetRequest().GetData()
+	apiVersion := data[ipamv1alpha1.KeyConsumerApiVersion].GetStringVal()
+	kind := data[ipamv1alpha1.KeyConsumerKind].GetStringVal()
+	name := data[ipamv1alpha1.KeyConsumerName].GetStringVal()
+	if apiVersion == "" || kind == "" || name == "" {
+		return nil
+	}
+	c := &ipamv1alpha1.ConsumerReference{
+		ApiVersion: utils.StringPtr(apiVersion),
+		Kind:       utils.StringPtr(kind),
+		Name:       utils.StringPtr(name),
+	}
+	if uid := data[ipamv1alpha1.KeyConsumerUid].GetStringVal(); uid != "" {
+		c.Uid = utils.StringPtr(uid)
+	}
+	return c
+}
+
+func registerKey(req *resourcepb.Request) types.NamespacedName {
+	return types.NamespacedName{Namespace: req.GetNamespace(), Name: req.GetRegisterName()}
+}
+
+// toTags converts the tags of a request in the tags of a register, sorted by
+// key
+func toTags(m map[string]string) []*nddov1.Tag {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tags := make([]*nddov1.Tag, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, &nddov1.Tag{Key: utils.StringPtr(key), Value: utils.StringPtr(m[key])})
+	}
+	return tags
+}
+
+func equalTags(a, b map[string]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func equalExpressions(a, b []metav1.LabelSelectorRequirement) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
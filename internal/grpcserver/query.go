@@ -0,0 +1,64 @@
+/*
+Copyright 2021 NDDO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/yndd/nddo-grpc/resource/resourcepb"
+	"github.com/yndd/nddr-ipam-registry/pkg/ipampb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// errors
+	errReadOnly = "query endpoint is read-only, use the grpc server address for allocations"
+)
+
+// queryServer serves the read-only part of the resource service on the query
+// listener, such that query and validation load cannot starve allocations
+type queryServer struct {
+	resourcepb.UnimplementedResourceServer
+	ipampb.UnimplementedIpamServer
+
+	server *server
+}
+
+func (q *queryServer) ResourceGet(ctx context.Context, req *resourcepb.Request) (*resourcepb.Reply, error) {
+	return q.server.ResourceGet(ctx, req)
+}
+
+func (q *queryServer) ResourceRequest(ctx context.Context, req *resourcepb.Request) (*resourcepb.Reply, error) {
+	return nil, status.Error(codes.PermissionDenied, errReadOnly)
+}
+
+func (q *queryServer) ResourceRelease(ctx context.Context, req *resourcepb.Request) (*resourcepb.Reply, error) {
+	return nil, status.Error(codes.PermissionDenied, errReadOnly)
+}
+
+func (q *queryServer) BulkRequest(stream ipampb.Ipam_BulkRequestServer) error {
+	return status.Error(codes.PermissionDenied, errReadOnly)
+}
+
+func (q *queryServer) BulkRelease(stream ipampb.Ipam_BulkReleaseServer) error {
+	return status.Error(codes.PermissionDenied, errReadOnly)
+}
+
+func (q *queryServer) Watch(req *resourcepb.Request, stream ipampb.Ipam_WatchServer) error {
+	return q.server.Watch(req, stream)
+}
@@ -18,6 +18,7 @@ package grpcserver
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"time"
 
@@ -26,42 +27,52 @@ import (
 	"github.com/yndd/nddo-runtime/pkg/odns"
 	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
 	"github.com/yndd/nddr-ipam-registry/internal/handler"
+	"inet.af/netaddr"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"sigs.k8s.io/controller-runtime/pkg/event"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 )
 
 func (r *server) ResourceGet(ctx context.Context, req *resourcepb.Request) (*resourcepb.Reply, error) {
 	log := r.log.WithValues("Request", req)
 	log.Debug("ResourceGet...")
 
-	return &resourcepb.Reply{Ready: true}, nil
+	if err := validateGet(req); err != nil {
+		return nil, err
+	}
+
+	registerInfo := getRegisterInfo(req)
+
+	prefix, err := r.handler.Get(ctx, registerInfo)
+	if err != nil {
+		// a request without allocation is not ready
+		if handler.IsNotFound(err) {
+			return &resourcepb.Reply{Ready: false}, nil
+		}
+		return &resourcepb.Reply{Ready: false}, err
+	}
+
+	return &resourcepb.Reply{
+		Ready:     true,
+		Timestamp: time.Now().UnixNano(),
+		Data: map[string]*resourcepb.TypedValue{
+			"ip-prefix": {Value: &resourcepb.TypedValue_StringVal{StringVal: *prefix}},
+		},
+	}, nil
 }
 
 func (r *server) ResourceRequest(ctx context.Context, req *resourcepb.Request) (*resourcepb.Reply, error) {
 	log := r.log.WithValues("Request", req)
 
-	if _, ok := req.GetRequest().GetSelector()[ipamv1alpha1.KeyPurpose]; !ok {
-		return nil, errors.New("pupose not provided in resource request")
+	if err := validateRequest(req); err != nil {
+		return nil, err
 	}
 
-	if _, ok := req.GetRequest().GetSelector()[ipamv1alpha1.KeyAddressFamily]; !ok {
-		return nil, errors.New("af not provided in resource request")
+	if err := r.checkRegister(ctx, req); err != nil {
+		return &resourcepb.Reply{Ready: false}, err
 	}
 
-	odnsRegisteryNi := odns.Name2OdnsRegistryNi(req.RegisterName)
-
-	registerInfo := &handler.RegisterInfo{
-		Namespace:           req.GetNamespace(),
-		RegistryName:        odnsRegisteryNi.GetRegistryName(),
-		NetworkInstanceName: odns.GetParentResourceName(req.GetRegisterName()),
-		Name:                req.GetRegisterName(),
-		CrName:              strings.Join([]string{req.GetNamespace(), odnsRegisteryNi.GetRegistryName(), odnsRegisteryNi.GetNetworkInstanceName()}, "."),
-		IpPrefix:            req.GetRequest().GetIpPrefix(),
-		Purpose:             req.GetRequest().GetSelector()[ipamv1alpha1.KeyPurpose],
-		AddressFamily:       req.GetRequest().GetSelector()[ipamv1alpha1.KeyAddressFamily],
-		Selector:            req.GetRequest().GetSelector(),
-		SourceTag:           req.GetRequest().GetSourceTag(),
-	}
+	registerInfo := getRegisterInfo(req)
 
 	log.Debug("resource alloc", "registerInfo", registerInfo)
 
@@ -71,15 +82,12 @@ func (r *server) ResourceRequest(ctx context.Context, req *resourcepb.Request) (
 		return &resourcepb.Reply{Ready: false}, err
 	}
 
-	// send a generic event to trigger a registry reconciliation based on a new allocation
-	// to update the status
-	/*
-		r.eventChs[ipamv1alpha1.IpamGroupKind] <- event.GenericEvent{
-			Object: &ipamv1alpha1.Register{
-				ObjectMeta: metav1.ObjectMeta{Name: req.GetName(), Namespace: req.GetNamespace()},
-			},
-		}
-	*/
+	// reflect the allocation as a register object, the allocation is kept when
+	// this fails since a retry of the request returns the same prefix
+	if err := r.applyRegister(ctx, req); err != nil {
+		log.Debug("resource alloc", "error", err)
+		return &resourcepb.Reply{Ready: false}, err
+	}
 
 	return &resourcepb.Reply{
 		Ready:      true,
@@ -95,33 +103,163 @@ func (r *server) ResourceRelease(ctx context.Context, req *resourcepb.Request) (
 	log := r.log.WithValues("Request", req)
 	log.Debug("ResourceDeAlloc...")
 
-	odnsRegisteryNi := odns.Name2OdnsRegistryNi(req.RegisterName)
+	if err := validateRelease(req); err != nil {
+		return nil, err
+	}
+
+	registerInfo := getRegisterInfo(req)
+
+	log.Debug("resource dealloc", "registerInfo", registerInfo)
+
+	if err := r.handler.DeRegister(ctx, registerInfo); err != nil {
+		return &resourcepb.Reply{Ready: false}, err
+	}
+
+	// the register object reflecting the allocation is removed as well, its
+	// finalizer finds the prefix already released
+	if err := r.deleteRegister(ctx, req); err != nil {
+		log.Debug("resource dealloc", "error", err)
+		return &resourcepb.Reply{Ready: false}, err
+	}
+
+	return &resourcepb.Reply{Ready: true}, nil
+}
 
-	registerInfo := &handler.RegisterInfo{
+// validateRequest checks the selector keys that are required for an allocation
+func validateRequest(req *resourcepb.Request) error {
+	exprs, err := getMatchExpressions(req)
+	if err != nil {
+		return err
+	}
+
+	// the purpose and address-family are in the selector or else selected
+	// with an In match-expression
+	if len(ipamv1alpha1.SelectorValues(req.GetRequest().GetSelector(), exprs, ipamv1alpha1.KeyPurpose)) == 0 {
+		return errors.New("pupose not provided in resource request")
+	}
+
+	if len(ipamv1alpha1.SelectorValues(req.GetRequest().GetSelector(), exprs, ipamv1alpha1.KeyAddressFamily)) == 0 {
+		return errors.New("af not provided in resource request")
+	}
+
+	if len(req.GetRequest().GetSourceTag()) == 0 {
+		return errors.New("source-tag not provided in resource request")
+	}
+
+	if registryName, networkInstanceName := getTarget(req); registryName == "" || networkInstanceName == "" {
+		return errors.New("registry-name or network-instance-name not provided and not derivable from the register name")
+	}
+	return nil
+}
+
+// validateRelease checks the prefix and the owner of the allocation to release
+// are provided
+func validateRelease(req *resourcepb.Request) error {
+	if _, err := netaddr.ParseIPPrefix(req.GetRequest().GetIpPrefix()); err != nil {
+		return errors.Wrap(err, "ip-prefix not provided in resource release")
+	}
+
+	if len(req.GetRequest().GetSourceTag()) == 0 {
+		return errors.New("source-tag not provided in resource release")
+	}
+
+	if registryName, networkInstanceName := getTarget(req); registryName == "" || networkInstanceName == "" {
+		return errors.New("registry-name or network-instance-name not provided and not derivable from the register name")
+	}
+	return nil
+}
+
+// validateGet checks the owner of the allocation to look up is provided, the
+// prefix is optional
+func validateGet(req *resourcepb.Request) error {
+	if p := req.GetRequest().GetIpPrefix(); p != "" {
+		if _, err := netaddr.ParseIPPrefix(p); err != nil {
+			return errors.Wrap(err, "invalid ip-prefix in resource get")
+		}
+	}
+
+	if len(req.GetRequest().GetSourceTag()) == 0 {
+		return errors.New("source-tag not provided in resource get")
+	}
+
+	if registryName, networkInstanceName := getTarget(req); registryName == "" || networkInstanceName == "" {
+		return errors.New("registry-name or network-instance-name not provided and not derivable from the register name")
+	}
+	return nil
+}
+
+// getRegisterInfo derives the register info for the handler from the resource request
+func getRegisterInfo(req *resourcepb.Request) *handler.RegisterInfo {
+	registryName, networkInstanceName := getTarget(req)
+	// the match-expressions are checked by validateRequest, they only matter
+	// for an allocation
+	matchExpressions, _ := getMatchExpressions(req)
+
+	return &handler.RegisterInfo{
 		Namespace:           req.GetNamespace(),
-		RegistryName:        odnsRegisteryNi.GetRegistryName(),
-		NetworkInstanceName: odns.GetParentResourceName(req.GetRegisterName()),
+		RegistryName:        registryName,
+		NetworkInstanceName: networkInstanceName,
 		Name:                req.GetRegisterName(),
-		CrName:              strings.Join([]string{req.GetNamespace(), odnsRegisteryNi.GetRegistryName(), odnsRegisteryNi.GetNetworkInstanceName()}, "."),
+		CrName:              strings.Join([]string{req.GetNamespace(), registryName, networkInstanceName}, "."),
 		IpPrefix:            req.GetRequest().GetIpPrefix(),
 		Purpose:             req.GetRequest().GetSelector()[ipamv1alpha1.KeyPurpose],
 		AddressFamily:       req.GetRequest().GetSelector()[ipamv1alpha1.KeyAddressFamily],
 		Selector:            req.GetRequest().GetSelector(),
 		SourceTag:           req.GetRequest().GetSourceTag(),
+		MatchExpressions:    matchExpressions,
+		RequestId:           req.GetRequest().GetData()[ipamv1alpha1.KeyRequestId].GetStringVal(),
 	}
+}
 
-	log.Debug("resource dealloc", "registerInfo", registerInfo)
+// getTarget returns the registry and network instance of the resource
+// request, the references in the data of the request take precedence over
+// the ones derived from the register name
+func getTarget(req *resourcepb.Request) (string, string) {
+	odnsRegisteryNi := odns.Name2OdnsRegistryNi(req.GetRegisterName())
+	registryName := odnsRegisteryNi.GetRegistryName()
+	networkInstanceName := odnsRegisteryNi.GetNetworkInstanceName()
 
-	if err := r.handler.DeRegister(ctx, registerInfo); err != nil {
-		return &resourcepb.Reply{Ready: false}, err
+	data := req.GetRequest().GetData()
+	if v := data[ipamv1alpha1.KeyRegistryName].GetStringVal(); v != "" {
+		registryName = v
 	}
-
-	// send a generic event to trigger a registry reconciliation based on a new DeAllocation
-	r.eventChs[ipamv1alpha1.IpamGroupKind] <- event.GenericEvent{
-		Object: &ipamv1alpha1.Register{
-			ObjectMeta: metav1.ObjectMeta{Name: req.GetRegisterName(), Namespace: req.GetNamespace()},
-		},
+	if v := data[ipamv1alpha1.KeyNetworkInstanceName].GetStringVal(); v != "" {
+		networkInstanceName = v
 	}
+	return registryName, networkInstanceName
+}
 
-	return &resourcepb.Reply{Ready: true}, nil
+// getMatchExpressions parses the match-expressions in the data of the resource
+// request, which use the kubernetes label selector syntax
+func getMatchExpressions(req *resourcepb.Request) ([]metav1.LabelSelectorRequirement, error) {
+	s := req.GetRequest().GetData()[ipamv1alpha1.KeyMatchExpressions].GetStringVal()
+	if s == "" {
+		return nil, nil
+	}
+	reqs, err := labels.ParseToRequirements(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse match-expressions")
+	}
+	exprs := make([]metav1.LabelSelectorRequirement, 0, len(reqs))
+	for _, r := range reqs {
+		var op metav1.LabelSelectorOperator
+		switch r.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			op = metav1.LabelSelectorOpIn
+		case selection.NotEquals, selection.NotIn:
+			op = metav1.LabelSelectorOpNotIn
+		case selection.Exists:
+			op = metav1.LabelSelectorOpExists
+		case selection.DoesNotExist:
+			op = metav1.LabelSelectorOpDoesNotExist
+		default:
+			return nil, fmt.Errorf("match-expressions operator %q not supported, key: %s", r.Operator(), r.Key())
+		}
+		exprs = append(exprs, metav1.LabelSelectorRequirement{
+			Key:      r.Key(),
+			Operator: op,
+			Values:   r.Values().List(),
+		})
+	}
+	return exprs, nil
 }
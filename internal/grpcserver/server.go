@@ -19,25 +19,37 @@ package grpcserver
 import (
 	"context"
 	"net"
+	"os"
+	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/yndd/ndd-runtime/pkg/logging"
 	"github.com/yndd/nddo-grpc/resource/resourcepb"
 	"github.com/yndd/nddr-ipam-registry/internal/handler"
+	"github.com/yndd/nddr-ipam-registry/pkg/ipampb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
 const (
+	unixPrefix = "unix://"
 	// errors
-	errStartGRPCServer   = "cannot start GRPC server"
-	errCreateTcpListener = "cannot create TCP listener"
-	errGrpcServer        = "cannot serve GRPC server"
+	errStartGRPCServer      = "cannot start GRPC server"
+	errStartGRPCQueryServer = "cannot start GRPC query server"
+	errCreateTcpListener    = "cannot create TCP listener"
+	errCreateUnixListener   = "cannot create unix socket listener"
+	errGrpcServer           = "cannot serve GRPC server"
 )
 
 type server struct {
 	resourcepb.UnimplementedResourceServer
+	ipampb.UnimplementedIpamServer
 
 	cfg Config
 
@@ -50,6 +62,11 @@ type server struct {
 	//pool    map[string]hash.HashTable
 	log     logging.Logger
 	handler handler.Handler
+	// health reports the overall status on the empty service name and the
+	// status per network instance on the network instance crName
+	healthMutex sync.Mutex
+	health      *health.Server
+	ready       map[string]bool
 
 	//newRegistry func() niregv1alpha1.Rg
 
@@ -58,7 +75,10 @@ type server struct {
 }
 
 func New(opts ...Option) (Server, error) {
-	s := &server{}
+	s := &server{
+		health: health.NewServer(),
+		ready:  make(map[string]bool),
+	}
 
 	for _, opt := range opts {
 		opt(s)
@@ -88,30 +108,37 @@ func (s *server) WithHandler(h handler.Handler) {
 }
 
 func (s *server) Run(ctx context.Context) error {
-	log := s.log.WithValues("grpcServerAddress", s.cfg.Address)
+	log := s.log.WithValues("grpcServerAddress", s.cfg.Address, "grpcQueryAddress", s.cfg.QueryAddress)
 	log.Debug("grpc server run...")
 	s.ctx = ctx
-	errChannel := make(chan error)
-	go func() {
-		if err := s.start(); err != nil {
-			errChannel <- errors.Wrap(err, errStartGRPCServer)
+
+	// the allocator is not serving until the trees are initialized
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	s.handler.AddStateFn(s.updateHealth)
+
+	// create the listeners upfront so a wrong address is reported to the caller
+	l, err := listen(s.cfg.Address)
+	if err != nil {
+		return errors.Wrap(err, errStartGRPCServer)
+	}
+	go s.start(l, s)
+
+	if s.cfg.QueryAddress != "" {
+		ql, err := listen(s.cfg.QueryAddress)
+		if err != nil {
+			l.Close()
+			return errors.Wrap(err, errStartGRPCQueryServer)
 		}
-		errChannel <- nil
-	}()
+		go s.start(ql, &queryServer{server: s})
+	}
 	return nil
 }
 
 // Start GRPC Server
-func (s *server) start() error {
-	log := s.log.WithValues("grpcServerAddress", s.cfg.Address)
+func (s *server) start(l net.Listener, srv resourcepb.ResourceServer) {
+	log := s.log.WithValues("address", l.Addr().String())
 	log.Debug("grpc server start...")
 
-	// create a listener on a specific address:port
-	l, err := net.Listen("tcp", s.cfg.Address)
-	if err != nil {
-		return errors.Wrap(err, errCreateTcpListener)
-	}
-
 	// TODO, proper handling of the certificates with CERT Manager
 	/*
 		opts, err := s.serverOpts()
@@ -122,14 +149,61 @@ func (s *server) start() error {
 	// create a gRPC server object
 	grpcServer := grpc.NewServer()
 
-	// attach the gRPC service to the server
-	resourcepb.RegisterResourceServer(grpcServer, s)
+	// attach the gRPC services to the server
+	resourcepb.RegisterResourceServer(grpcServer, srv)
+	healthpb.RegisterHealthServer(grpcServer, s.health)
+	if ipamSrv, ok := srv.(ipampb.IpamServer); ok {
+		ipampb.RegisterIpamServer(grpcServer, ipamSrv)
+	}
+	if s.cfg.EnableReflection {
+		reflection.Register(grpcServer)
+	}
 
 	// start the server
 	log.Debug("grpc server serve...")
 	if err := grpcServer.Serve(l); err != nil {
-		s.log.Debug("Errors", "error", err)
-		return errors.Wrap(err, errGrpcServer)
+		log.Debug(errGrpcServer, "error", err)
 	}
-	return nil
+}
+
+// updateHealth reflects the iptree state of a network instance in the health
+// service, the overall status is serving as long as one network instance is ready
+func (s *server) updateHealth(crName string, ni types.NamespacedName, state handler.State) {
+	s.log.Debug("health update", "crName", crName, "state", state)
+	s.healthMutex.Lock()
+	defer s.healthMutex.Unlock()
+	if state == handler.StateReady {
+		s.ready[crName] = true
+		s.health.SetServingStatus(crName, healthpb.HealthCheckResponse_SERVING)
+	} else {
+		delete(s.ready, crName)
+		s.health.SetServingStatus(crName, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+	if len(s.ready) > 0 {
+		s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	} else {
+		s.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// listen creates a listener for the address, addresses with the unix:// prefix
+// are served on a unix domain socket, all others on tcp
+func listen(address string) (net.Listener, error) {
+	if strings.HasPrefix(address, unixPrefix) {
+		path := strings.TrimPrefix(address, unixPrefix)
+		// remove a stale socket left behind by a previous run
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, errCreateUnixListener)
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, errors.Wrap(err, errCreateUnixListener)
+		}
+		return l, nil
+	}
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errors.Wrap(err, errCreateTcpListener)
+	}
+	return l, nil
 }
@@ -26,8 +26,10 @@ import (
 )
 
 type Config struct {
-	// Address
+	// Address the allocation server binds to, either host:port or unix:///path
 	Address string
+	// QueryAddress the read-only query server binds to, disabled when empty
+	QueryAddress string
 	// Generic
 	MaxSubscriptions int64
 	MaxUnaryRPC      int64
@@ -38,8 +40,9 @@ type Config struct {
 	CertFile   string
 	KeyFile    string
 	// observability
-	EnableMetrics bool
-	Debug         bool
+	EnableMetrics    bool
+	EnableReflection bool
+	Debug            bool
 }
 
 // Option can be used to manipulate Options.
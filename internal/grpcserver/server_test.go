@@ -0,0 +1,548 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	"github.com/yndd/nddo-grpc/resource/resourcepb"
+	nddov1 "github.com/yndd/nddo-runtime/apis/common/v1"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"github.com/yndd/nddr-ipam-registry/internal/handler"
+	"github.com/yndd/nddr-ipam-registry/pkg/ipampb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	testNamespace       = "default"
+	testRegistry        = "nokia"
+	testNetworkInstance = "default"
+	testPool            = "10.0.0.0/24"
+)
+
+// testServer is a grpc server serving the resource service of a handler with
+// a ready network instance on an in-memory connection
+type testServer struct {
+	client   client.Client
+	resource resourcepb.ResourceClient
+	ipam     ipampb.IpamClient
+}
+
+// newTestServer starts the grpc server on a bufconn listener and returns a
+// client connected to it, the server is stopped when the test ends
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerWithClient(t, nil)
+}
+
+// newTestServerWithClient starts the grpc server like newTestServer, the
+// client of the server is wrapped by the wrap function when it is set
+func newTestServerWithClient(t *testing.T, wrap func(client.Client) client.Client) *testServer {
+	t.Helper()
+	s := runtime.NewScheme()
+	if err := ipamv1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	ni := &ipamv1alpha1.IpamNetworkInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: testNetworkInstance, Namespace: testNamespace},
+		Spec: ipamv1alpha1.IpamNetworkInstanceSpec{
+			IpamNetworkInstance: &ipamv1alpha1.IpamIpamNetworkInstance{
+				AdminState: utils.StringPtr(ipamv1alpha1.AdminStateEnable),
+				DefaultPrefixLength: map[string]*ipamv1alpha1.IpamIpamNetworkInstanceDefaultPrefixLength{
+					"isl": {AddressFamily: map[string]*uint32{"ipv4": utils.Uint32Ptr(31)}},
+				},
+			},
+		},
+	}
+	ni.SetConditions(ipamv1alpha1.Ready())
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(ni).Build()
+
+	h, err := handler.New(handler.WithLogger(logging.NewNopLogger()), handler.WithClient(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crName := testNamespace + "." + testRegistry + "." + testNetworkInstance
+	h.Init(crName, types.NamespacedName{Namespace: testNamespace, Name: testNetworkInstance})
+	h.Load(crName, []ipamv1alpha1.Ipp{newTestPool(testPool)})
+
+	eventChs := map[string]chan event.GenericEvent{
+		ipamv1alpha1.IpamGroupKind: make(chan event.GenericEvent, 16),
+	}
+	sc := client.Client(c)
+	if wrap != nil {
+		sc = wrap(c)
+	}
+	srv, err := New(WithLogger(logging.NewNopLogger()), WithClient(sc), WithHandler(h), WithEventChannels(eventChs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := bufconn.Listen(1 << 20)
+	go srv.(*server).start(l, srv.(*server))
+	t.Cleanup(func() { l.Close() })
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testServer{client: c, resource: resourcepb.NewResourceClient(conn), ipam: ipampb.NewIpamClient(conn)}
+}
+
+// newTestPool returns a pool of the isl purpose
+func newTestPool(prefix string) *ipamv1alpha1.IpamNetworkInstanceIpPrefix {
+	return &ipamv1alpha1.IpamNetworkInstanceIpPrefix{
+		ObjectMeta: metav1.ObjectMeta{Name: "isl", Namespace: testNamespace},
+		Spec: ipamv1alpha1.IpamNetworkInstanceIpPrefixSpec{
+			IpamNetworkInstanceIpPrefix: &ipamv1alpha1.IpamIpamNetworkInstanceIpPrefix{
+				Prefix: utils.StringPtr(prefix),
+				Tag:    []*nddov1.Tag{{Key: utils.StringPtr(ipamv1alpha1.KeyPurpose), Value: utils.StringPtr("isl")}},
+			},
+		},
+		Status: ipamv1alpha1.IpamNetworkInstanceIpPrefixStatus{
+			IpamNetworkInstanceIpPrefix: &ipamv1alpha1.NddrIpamIpamNetworkInstanceIpPrefix{
+				State: &ipamv1alpha1.NddrIpamIpamNetworkInstanceIpPrefixState{},
+			},
+		},
+	}
+}
+
+// newTestRequest returns a request of an isl allocation owned by the link
+func newTestRequest(name, link string) *resourcepb.Request {
+	return &resourcepb.Request{
+		Namespace:    testNamespace,
+		RegisterName: name,
+		Request: &resourcepb.Req{
+			Selector: map[string]string{
+				ipamv1alpha1.KeyPurpose:       "isl",
+				ipamv1alpha1.KeyAddressFamily: "ipv4",
+			},
+			SourceTag: map[string]string{"link": link},
+			Data: map[string]*resourcepb.TypedValue{
+				ipamv1alpha1.KeyRegistryName:        {Value: &resourcepb.TypedValue_StringVal{StringVal: testRegistry}},
+				ipamv1alpha1.KeyNetworkInstanceName: {Value: &resourcepb.TypedValue_StringVal{StringVal: testNetworkInstance}},
+			},
+		},
+	}
+}
+
+func getIpPrefix(reply *resourcepb.Reply) string {
+	return reply.GetData()["ip-prefix"].GetStringVal()
+}
+
+func TestResourceRequest(t *testing.T) {
+	noSourceTag := newTestRequest("isl-1", "")
+	noSourceTag.Request.SourceTag = nil
+	noPurpose := newTestRequest("isl-1", "lag-1")
+	delete(noPurpose.Request.Selector, ipamv1alpha1.KeyPurpose)
+	explicit := newTestRequest("isl-1", "lag-1")
+	explicit.Request.IpPrefix = "10.0.0.8/31"
+	unknown := newTestRequest("isl-1", "lag-1")
+	unknown.Request.Data[ipamv1alpha1.KeyNetworkInstanceName] = &resourcepb.TypedValue{Value: &resourcepb.TypedValue_StringVal{StringVal: "unknown"}}
+	noTarget := newTestRequest("isl-1", "lag-1")
+	noTarget.Request.Data = nil
+	purposeIn := newTestRequest("isl-1", "lag-1")
+	delete(purposeIn.Request.Selector, ipamv1alpha1.KeyPurpose)
+	purposeIn.Request.Data[ipamv1alpha1.KeyMatchExpressions] = &resourcepb.TypedValue{Value: &resourcepb.TypedValue_StringVal{StringVal: "purpose in (isl,p2p)"}}
+
+	tests := []struct {
+		name    string
+		prior   []*resourcepb.Request
+		req     *resourcepb.Request
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "allocation from the pool",
+			req:  newTestRequest("isl-1", "lag-1"),
+			want: "10.0.0.0/31",
+		},
+		{
+			name:  "next allocation",
+			prior: []*resourcepb.Request{newTestRequest("isl-1", "lag-1")},
+			req:   newTestRequest("isl-2", "lag-2"),
+			want:  "10.0.0.2/31",
+		},
+		{
+			name:  "retried request",
+			prior: []*resourcepb.Request{newTestRequest("isl-1", "lag-1"), newTestRequest("isl-2", "lag-2")},
+			req:   newTestRequest("isl-1", "lag-1"),
+			want:  "10.0.0.0/31",
+		},
+		{
+			name: "explicit prefix",
+			req:  explicit,
+			want: "10.0.0.8/31",
+		},
+		{
+			name:    "register of another allocation",
+			prior:   []*resourcepb.Request{newTestRequest("isl-1", "lag-1")},
+			req:     newTestRequest("isl-1", "lag-2"),
+			wantErr: true,
+		},
+		{
+			name:    "no source-tag",
+			req:     noSourceTag,
+			wantErr: true,
+		},
+		{
+			name:    "no purpose",
+			req:     noPurpose,
+			wantErr: true,
+		},
+		{
+			name: "purpose as match-expression",
+			req:  purposeIn,
+			want: "10.0.0.0/31",
+		},
+		{
+			name:    "unknown network instance",
+			req:     unknown,
+			wantErr: true,
+		},
+		{
+			name:    "no network instance",
+			req:     noTarget,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			ctx := context.Background()
+			for _, req := range tc.prior {
+				if _, err := s.resource.ResourceRequest(ctx, req); err != nil {
+					t.Fatalf("cannot request %s: %v", req.GetRegisterName(), err)
+				}
+			}
+
+			reply, err := s.resource.ResourceRequest(ctx, tc.req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("error: want %t, got %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reply.GetReady() || getIpPrefix(reply) != tc.want {
+				t.Fatalf("reply: want ready with %s, got %v", tc.want, reply)
+			}
+			// the allocation is reflected as register object
+			cr := &ipamv1alpha1.Register{}
+			if err := s.client.Get(ctx, registerKey(tc.req), cr); err != nil {
+				t.Fatalf("register %s: %v", tc.req.GetRegisterName(), err)
+			}
+		})
+	}
+}
+
+func TestResourceGet(t *testing.T) {
+	withIpPrefix := func(req *resourcepb.Request, prefix string) *resourcepb.Request {
+		req.Request.IpPrefix = prefix
+		return req
+	}
+	noSourceTag := newTestRequest("isl-1", "")
+	noSourceTag.Request.SourceTag = nil
+
+	tests := []struct {
+		name     string
+		prior    []*resourcepb.Request
+		released []*resourcepb.Request
+		req      *resourcepb.Request
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:  "allocation of the owner",
+			prior: []*resourcepb.Request{newTestRequest("isl-1", "lag-1"), newTestRequest("isl-2", "lag-2")},
+			req:   newTestRequest("isl-2", "lag-2"),
+			want:  "10.0.0.2/31",
+		},
+		{
+			name:  "prefix of the owner",
+			prior: []*resourcepb.Request{newTestRequest("isl-1", "lag-1")},
+			req:   withIpPrefix(newTestRequest("isl-1", "lag-1"), "10.0.0.0/31"),
+			want:  "10.0.0.0/31",
+		},
+		{
+			name:  "prefix of another owner",
+			prior: []*resourcepb.Request{newTestRequest("isl-1", "lag-1")},
+			req:   withIpPrefix(newTestRequest("isl-2", "lag-2"), "10.0.0.0/31"),
+		},
+		{
+			name: "not allocated",
+			req:  newTestRequest("isl-1", "lag-1"),
+		},
+		{
+			name:     "released",
+			prior:    []*resourcepb.Request{newTestRequest("isl-1", "lag-1")},
+			released: []*resourcepb.Request{withIpPrefix(newTestRequest("isl-1", "lag-1"), "10.0.0.0/31")},
+			req:      newTestRequest("isl-1", "lag-1"),
+		},
+		{
+			name:    "no source-tag",
+			req:     noSourceTag,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			ctx := context.Background()
+			for _, req := range tc.prior {
+				if _, err := s.resource.ResourceRequest(ctx, req); err != nil {
+					t.Fatalf("cannot request %s: %v", req.GetRegisterName(), err)
+				}
+			}
+			for _, req := range tc.released {
+				if _, err := s.resource.ResourceRelease(ctx, req); err != nil {
+					t.Fatalf("cannot release %s: %v", req.GetRegisterName(), err)
+				}
+			}
+
+			reply, err := s.resource.ResourceGet(ctx, tc.req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("error: want %t, got %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if reply.GetReady() != (tc.want != "") || getIpPrefix(reply) != tc.want {
+				t.Fatalf("reply: want %q, got %v", tc.want, reply)
+			}
+		})
+	}
+}
+
+func TestResourceRelease(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *resourcepb.Request
+		prefix  string
+		wantErr bool
+	}{
+		{
+			name:   "own allocation",
+			req:    newTestRequest("isl-1", "lag-1"),
+			prefix: "10.0.0.0/31",
+		},
+		{
+			name:    "allocation of another owner",
+			req:     newTestRequest("isl-1", "lag-2"),
+			prefix:  "10.0.0.0/31",
+			wantErr: true,
+		},
+		{
+			name:    "prefix not allocated",
+			req:     newTestRequest("isl-2", "lag-2"),
+			prefix:  "10.0.0.2/31",
+			wantErr: true,
+		},
+		{
+			name:    "invalid prefix",
+			req:     newTestRequest("isl-1", "lag-1"),
+			prefix:  "10.0.0.0/33",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			ctx := context.Background()
+			if _, err := s.resource.ResourceRequest(ctx, newTestRequest("isl-1", "lag-1")); err != nil {
+				t.Fatalf("cannot request: %v", err)
+			}
+
+			tc.req.Request.IpPrefix = tc.prefix
+			_, err := s.resource.ResourceRelease(ctx, tc.req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("error: want %t, got %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			// the register object reflecting the allocation is removed
+			cr := &ipamv1alpha1.Register{}
+			if err := s.client.Get(ctx, registerKey(tc.req), cr); !apierrors.IsNotFound(err) {
+				t.Fatalf("register %s: want not found, got %v", tc.req.GetRegisterName(), err)
+			}
+			// a released prefix is allocated again
+			reply, err := s.resource.ResourceRequest(ctx, newTestRequest("isl-3", "lag-3"))
+			if err != nil || getIpPrefix(reply) != "10.0.0.0/31" {
+				t.Fatalf("reallocation: want 10.0.0.0/31, got %v, %v", reply, err)
+			}
+		})
+	}
+}
+
+// failingCreate is a client of which the creation of objects fails
+type failingCreate struct {
+	client.Client
+}
+
+func (c *failingCreate) Create(context.Context, client.Object, ...client.CreateOption) error {
+	return errors.New("api server unavailable")
+}
+
+// bulkClientStream is the client stream of the BulkRequest and BulkRelease rpcs
+type bulkClientStream interface {
+	Send(*resourcepb.Request) error
+	Recv() (*resourcepb.Reply, error)
+	CloseSend() error
+}
+
+// sendBulk sends the requests on the stream and returns the replies and the
+// status of the rpc
+func sendBulk(t *testing.T, stream bulkClientStream, reqs ...*resourcepb.Request) ([]*resourcepb.Reply, error) {
+	t.Helper()
+	for _, req := range reqs {
+		if err := stream.Send(req); err != nil {
+			t.Fatalf("cannot send %s: %v", req.GetRegisterName(), err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	replies := make([]*resourcepb.Reply, 0, len(reqs))
+	for {
+		reply, err := stream.Recv()
+		if err == io.EOF {
+			return replies, nil
+		}
+		if err != nil {
+			return replies, err
+		}
+		replies = append(replies, reply)
+	}
+}
+
+func TestBulkRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		wrap func(client.Client) client.Client
+		reqs []*resourcepb.Request
+		// synced is set when the register objects are expected to be created
+		synced bool
+	}{
+		{
+			name:   "items allocated",
+			reqs:   []*resourcepb.Request{newTestRequest("isl-1", "lag-1"), newTestRequest("isl-2", "lag-2")},
+			synced: true,
+		},
+		{
+			name: "committed items of which the sync fails",
+			wrap: func(c client.Client) client.Client { return &failingCreate{Client: c} },
+			reqs: []*resourcepb.Request{newTestRequest("isl-1", "lag-1"), newTestRequest("isl-2", "lag-2")},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServerWithClient(t, tc.wrap)
+			ctx := context.Background()
+			stream, err := s.ipam.BulkRequest(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			replies, err := sendBulk(t, stream, tc.reqs...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(replies) != len(tc.reqs) {
+				t.Fatalf("replies: want %d, got %d", len(tc.reqs), len(replies))
+			}
+			for i, reply := range replies {
+				// the allocation is committed regardless of the sync
+				if !reply.GetReady() || getIpPrefix(reply) == "" {
+					t.Errorf("item %d: want ready with a prefix, got %v", i, reply)
+				}
+				_, syncErr := reply.GetData()[keySyncError]
+				if syncErr == tc.synced {
+					t.Errorf("item %d: sync error %t, got %v", i, !tc.synced, reply)
+				}
+				cr := &ipamv1alpha1.Register{}
+				if err := s.client.Get(ctx, registerKey(tc.reqs[i]), cr); (err == nil) != tc.synced {
+					t.Errorf("register %s: synced %t, got %v", tc.reqs[i].GetRegisterName(), tc.synced, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkRelease(t *testing.T) {
+	noPrefix := newTestRequest("isl-1", "lag-1")
+	noSourceTag := newTestRequest("isl-1", "lag-1")
+	noSourceTag.Request.IpPrefix = "10.0.0.0/31"
+	noSourceTag.Request.SourceTag = nil
+	own := newTestRequest("isl-1", "lag-1")
+	own.Request.IpPrefix = "10.0.0.0/31"
+
+	tests := []struct {
+		name string
+		req  *resourcepb.Request
+		code codes.Code
+	}{
+		{
+			name: "own allocation",
+			req:  own,
+			code: codes.OK,
+		},
+		{
+			name: "no prefix",
+			req:  noPrefix,
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "no source-tag",
+			req:  noSourceTag,
+			code: codes.InvalidArgument,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			ctx := context.Background()
+			if _, err := s.resource.ResourceRequest(ctx, newTestRequest("isl-1", "lag-1")); err != nil {
+				t.Fatalf("cannot request: %v", err)
+			}
+			stream, err := s.ipam.BulkRelease(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = sendBulk(t, stream, tc.req)
+			if code := status.Code(err); code != tc.code {
+				t.Fatalf("status: want %s, got %v", tc.code, err)
+			}
+		})
+	}
+}
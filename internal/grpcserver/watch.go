@@ -0,0 +1,91 @@
+/*
+Copyright 2021 NDDO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcserver
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/yndd/nddo-grpc/resource/resourcepb"
+	"github.com/yndd/nddo-runtime/pkg/odns"
+	"github.com/yndd/nddr-ipam-registry/internal/handler"
+	"github.com/yndd/nddr-ipam-registry/pkg/ipampb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (r *server) Watch(req *resourcepb.Request, stream ipampb.Ipam_WatchServer) error {
+	log := r.log.WithValues("Request", req)
+	log.Debug("Watch...")
+
+	if req.GetNamespace() == "" {
+		return status.Error(codes.InvalidArgument, "namespace not provided in watch request")
+	}
+	filter := &handler.WatchFilter{Namespace: req.GetNamespace()}
+	if niName := req.GetRequest().GetData()[ipampb.KeyNetworkInstance].GetStringVal(); niName != "" {
+		odnsRegistry := odns.Name2OdnsRegistry(niName)
+		filter.CrName = strings.Join([]string{req.GetNamespace(), odnsRegistry.GetRegistryName(), odnsRegistry.GetResourceName()}, ".")
+	}
+	resumeToken := req.GetRequest().GetData()[ipampb.KeyResumeToken].GetStringVal()
+
+	events, ch, err := r.handler.Watch(stream.Context(), filter, resumeToken)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	for _, e := range events {
+		if err := stream.Send(getWatchReply(e)); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-ch:
+			if !ok {
+				// the watch fell behind, the client resumes with its last token
+				return status.Error(codes.ResourceExhausted, "watch fell behind, resume from the last resume token")
+			}
+			if err := stream.Send(getWatchReply(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func getWatchReply(e *handler.Event) *resourcepb.Reply {
+	reply := &resourcepb.Reply{
+		Ready:     true,
+		Timestamp: e.Timestamp.UnixNano(),
+		Data: map[string]*resourcepb.TypedValue{
+			ipampb.KeyEvent:       {Value: &resourcepb.TypedValue_StringVal{StringVal: string(e.Kind)}},
+			ipampb.KeyResumeToken: {Value: &resourcepb.TypedValue_StringVal{StringVal: e.ResumeToken}},
+		},
+	}
+	if e.Prefix != "" {
+		reply.Data[ipampb.KeyIpPrefix] = &resourcepb.TypedValue{Value: &resourcepb.TypedValue_StringVal{StringVal: e.Prefix}}
+	}
+	if e.CrName != "" {
+		reply.Data[ipampb.KeyNetworkInstance] = &resourcepb.TypedValue{Value: &resourcepb.TypedValue_StringVal{StringVal: e.CrName}}
+	}
+	if len(e.Labels) > 0 {
+		if b, err := json.Marshal(e.Labels); err == nil {
+			reply.Data[ipampb.KeyLabels] = &resourcepb.TypedValue{Value: &resourcepb.TypedValue_JsonVal{JsonVal: b}}
+		}
+	}
+	return reply
+}
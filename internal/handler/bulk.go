@@ -0,0 +1,214 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hansthienpondt/goipam/pkg/table"
+	"github.com/pkg/errors"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"inet.af/netaddr"
+)
+
+const (
+	// errors
+	errBulkAborted = "aborted, another item of the bulk operation failed"
+)
+
+// RegisterResult is the result of a single item of a bulk operation
+type RegisterResult struct {
+	Prefix *string
+	Err    error
+}
+
+// bulkAllocation is an allocation added by a bulk operation, which is undone
+// when the bulk operation is rolled back
+type bulkAllocation struct {
+	*allocation
+	info *RegisterInfo
+}
+
+// bulkTarget is a network instance validated for a bulk operation
+type bulkTarget struct {
+	ni   ipamv1alpha1.In
+	tree *ipTree
+}
+
+// RegisterBulk allocates the prefixes of all infos with all-or-nothing
+// semantics; when one item fails the allocations of the other items are rolled
+// back and the returned error identifies the failing item.
+func (r *handler) RegisterBulk(ctx context.Context, infos []*RegisterInfo) ([]*RegisterResult, error) {
+	results := newBulkResults(len(infos))
+	targets, err := r.validateBulk(ctx, infos, results)
+	if err != nil {
+		return results, err
+	}
+	for i, info := range infos {
+		if err := checkAdminState(targets[info.CrName].ni); err != nil {
+			results[i].Err = err
+			return results, errors.Wrapf(err, "bulk item %d", i)
+		}
+	}
+
+	scope := r.getQuotaScope(infos...)
+	defer r.lockTrees(opBulk, scope.merge(bulkTrees(targets)))()
+
+	added := make([]*bulkAllocation, 0, len(infos))
+	for i, info := range infos {
+		t := targets[info.CrName]
+		a, err := r.register(info, t.ni, t.tree, scope)
+		if err != nil {
+			r.metrics.failures.WithLabelValues(info.CrName, opRegister, reasonOf(err)).Inc()
+			results[i].Err = err
+			r.rollbackBulk(added, targets)
+			return results, errors.Wrapf(err, "bulk item %d", i)
+		}
+		if a.added {
+			added = append(added, &bulkAllocation{
+				info:       &RegisterInfo{Namespace: info.Namespace, CrName: info.CrName, Purpose: info.Purpose, AddressFamily: info.AddressFamily, IpPrefix: a.prefix},
+				allocation: a,
+			})
+		}
+		p := a.prefix
+		results[i].Prefix = &p
+	}
+	for _, result := range results {
+		result.Err = nil
+	}
+	// the expansions are only notified once the bulk operation is committed
+	for _, ba := range added {
+		if ba.expansion != nil {
+			r.notifyExpansion(ba.info.CrName, targets[ba.info.CrName].ni)
+		}
+	}
+	for _, ba := range added {
+		r.metrics.allocations.WithLabelValues(ba.info.CrName, ba.info.Purpose, ba.info.AddressFamily).Inc()
+		r.publish(EventAllocate, ba.info, ba.prefix, routeLabels(targets[ba.info.CrName].tree.routes, ba.prefix))
+	}
+	return results, nil
+}
+
+// DeRegisterBulk releases the prefixes of all infos with all-or-nothing
+// semantics; nothing is released unless all prefixes are found.
+func (r *handler) DeRegisterBulk(ctx context.Context, infos []*RegisterInfo) ([]*RegisterResult, error) {
+	results := newBulkResults(len(infos))
+	targets, err := r.validateBulk(ctx, infos, results)
+	if err != nil {
+		return results, err
+	}
+
+	defer r.lockTrees(opBulk, bulkTrees(targets))()
+
+	// verify all items are owned before releasing anything
+	routes := make([]*table.Route, len(infos))
+	seen := make(map[string]int, len(infos))
+	for i, info := range infos {
+		route, err := r.checkRelease(info, targets[info.CrName].tree.routes)
+		if err != nil {
+			results[i].Err = err
+			return results, errors.Wrapf(err, "bulk item %d", i)
+		}
+		// a prefix released twice would fail halfway through the release
+		key := info.CrName + "/" + route.String()
+		if j, ok := seen[key]; ok {
+			results[i].Err = withReason(reasonInvalid, fmt.Errorf("prefix %s is released by bulk item %d too", route.String(), j))
+			return results, errors.Wrapf(results[i].Err, "bulk item %d", i)
+		}
+		seen[key] = i
+		routes[i] = route
+	}
+	for i, info := range infos {
+		t := targets[info.CrName].tree
+		l := routeLabels(t.routes, info.IpPrefix)
+		if err := r.release(info, routes[i], t.routes); err != nil {
+			// cannot happen since the prefixes were verified under the same lock
+			results[i].Err = err
+			return results, errors.Wrapf(err, "bulk item %d", i)
+		}
+		r.quarantine(t, info.IpPrefix, l)
+		r.metrics.releases.WithLabelValues(info.CrName).Inc()
+		r.publish(EventRelease, info, info.IpPrefix, l)
+		p := info.IpPrefix
+		results[i].Prefix = &p
+		results[i].Err = nil
+	}
+	return results, nil
+}
+
+// validateBulk validates every network instance referenced by the infos once
+func (r *handler) validateBulk(ctx context.Context, infos []*RegisterInfo, results []*RegisterResult) (map[string]*bulkTarget, error) {
+	targets := make(map[string]*bulkTarget)
+	for i, info := range infos {
+		if _, ok := targets[info.CrName]; ok {
+			continue
+		}
+		ni, t, err := r.validateRegister(ctx, info)
+		if err != nil {
+			results[i].Err = err
+			return nil, errors.Wrapf(err, "bulk item %d", i)
+		}
+		targets[info.CrName] = &bulkTarget{ni: ni, tree: t}
+	}
+	return targets, nil
+}
+
+// rollbackBulk undoes the allocations that were added by a failed bulk
+// operation in reverse order; revived prefixes are quarantined again with their
+// original tombstone and the pools expanded for the allocations are discarded
+func (r *handler) rollbackBulk(added []*bulkAllocation, targets map[string]*bulkTarget) {
+	for i := len(added) - 1; i >= 0; i-- {
+		ba := added[i]
+		t := targets[ba.info.CrName].tree
+		p, err := netaddr.ParseIPPrefix(ba.prefix)
+		if err != nil {
+			continue
+		}
+		route, ok, _ := t.routes.Get(p)
+		if !ok {
+			continue
+		}
+		// the routes were added by the bulk operation, so no owner check
+		if err := r.release(ba.info, route, t.routes); err != nil {
+			r.log.Debug("bulk rollback failed", "crName", ba.info.CrName, "prefix", ba.prefix, "error", err)
+			continue
+		}
+		if ba.tombstone != nil {
+			r.requarantine(t, ba.prefix, ba.tombstone)
+		}
+		if ba.expansion != nil {
+			r.discard(t, ba.expansion)
+		}
+	}
+}
+
+func bulkTrees(targets map[string]*bulkTarget) map[string]*ipTree {
+	trees := make(map[string]*ipTree, len(targets))
+	for crName, t := range targets {
+		trees[crName] = t.tree
+	}
+	return trees
+}
+
+func newBulkResults(n int) []*RegisterResult {
+	results := make([]*RegisterResult, n)
+	for i := range results {
+		results[i] = &RegisterResult{Err: errors.New(errBulkAborted)}
+	}
+	return results
+}
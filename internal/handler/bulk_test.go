@@ -0,0 +1,147 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"inet.af/netaddr"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRegisterBulk(t *testing.T) {
+	tests := []struct {
+		name  string
+		ipps  []*ipamv1alpha1.IpamNetworkInstanceIpPrefix
+		prior []*RegisterInfo
+		// released are the prior allocations that are released before the
+		// bulk operation
+		released []*RegisterInfo
+		infos    []*RegisterInfo
+		want     []string
+		// routes are the kinds of the routes of the prefixes afterwards, an
+		// empty kind expects the prefix is not in the iptree
+		routes     map[string]string
+		expansions int
+		reason     string
+	}{
+		{
+			name:   "all items allocated",
+			ipps:   []*ipamv1alpha1.IpamNetworkInstanceIpPrefix{newTestIpPrefix("isl", "10.0.0.0/24")},
+			infos:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			want:   []string{"10.0.0.0/31", "10.0.0.2/31"},
+			routes: map[string]string{"10.0.0.0/31": kindAllocation, "10.0.0.2/31": kindAllocation},
+		},
+		{
+			name:   "failed item rolls back the added items",
+			ipps:   []*ipamv1alpha1.IpamNetworkInstanceIpPrefix{newTestIpPrefix("isl", "10.0.0.0/24")},
+			infos:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv6, "b")},
+			routes: map[string]string{"10.0.0.0/31": ""},
+			reason: reasonExhausted,
+		},
+		{
+			name:   "existing allocation is kept",
+			ipps:   []*ipamv1alpha1.IpamNetworkInstanceIpPrefix{newTestIpPrefix("isl", "10.0.0.0/24")},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			infos:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv6, "b")},
+			routes: map[string]string{"10.0.0.0/31": kindAllocation},
+			reason: reasonExhausted,
+		},
+		{
+			name:     "revived prefix is quarantined again",
+			ipps:     []*ipamv1alpha1.IpamNetworkInstanceIpPrefix{newTestIpPrefix("isl", "10.0.0.0/24")},
+			prior:    []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			released: []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			infos:    []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv6, "b")},
+			routes:   map[string]string{"10.0.0.0/31": kindQuarantine},
+			reason:   reasonExhausted,
+		},
+		{
+			name: "expansion is notified",
+			ipps: []*ipamv1alpha1.IpamNetworkInstanceIpPrefix{
+				newTestAggregate("10.1.0.0/16"),
+				withAutoExpand(newTestIpPrefix("isl", "10.0.0.0/30"), 30, 1),
+			},
+			prior:      []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			infos:      []*RegisterInfo{newTestInfo("ni-a", ipv4, "c")},
+			want:       []string{"10.1.0.0/31"},
+			routes:     map[string]string{"10.1.0.0/30": kindPool, "10.1.0.0/31": kindAllocation},
+			expansions: 1,
+		},
+		{
+			name: "expansion is discarded",
+			ipps: []*ipamv1alpha1.IpamNetworkInstanceIpPrefix{
+				newTestAggregate("10.1.0.0/16"),
+				withAutoExpand(newTestIpPrefix("isl", "10.0.0.0/30"), 30, 1),
+			},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			infos:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "c"), newTestInfo("ni-a", ipv6, "d")},
+			routes: map[string]string{"10.1.0.0/30": "", "10.1.0.0/31": ""},
+			reason: reasonExhausted,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestHandler(t, "ni-a")
+			r.Quarantine(testCrName("ni-a"), time.Hour)
+			var expansions int
+			r.AddExpansionFn(func(string, types.NamespacedName) { expansions++ })
+			addTestIpPrefixes(t, r, "ni-a", tc.ipps...)
+			registerTest(t, r, tc.prior...)
+			releaseTest(t, r, tc.released...)
+			tr, _ := r.lookupTree(testCrName("ni-a"))
+			before := make(map[string]map[string]string)
+			for prefix := range tc.routes {
+				if route, ok, _ := tr.routes.Get(netaddr.MustParseIPPrefix(prefix)); ok {
+					before[prefix] = copyLabels(route)
+				}
+			}
+
+			results, err := r.RegisterBulk(context.Background(), tc.infos)
+			checkReason(t, err, tc.reason)
+			if len(results) != len(tc.infos) {
+				t.Fatalf("results: want %d, got %d", len(tc.infos), len(results))
+			}
+			for i, want := range tc.want {
+				if results[i].Prefix == nil || *results[i].Prefix != want {
+					t.Errorf("item %d: want %s, got %v", i, want, results[i].Prefix)
+				}
+			}
+			for prefix, kind := range tc.routes {
+				if got := routeKind(t, r, "ni-a", prefix); got != kind {
+					t.Errorf("route of %s: want %q, got %q", prefix, kind, got)
+				}
+			}
+			// a rolled back tombstone keeps its original expiry
+			for prefix, l := range before {
+				if l[labelKind] != kindQuarantine {
+					continue
+				}
+				route, _, _ := tr.routes.Get(netaddr.MustParseIPPrefix(prefix))
+				if got := route.Get(labelExpires); got != l[labelExpires] {
+					t.Errorf("expiry of %s: want %s, got %s", prefix, l[labelExpires], got)
+				}
+			}
+			if expansions != tc.expansions {
+				t.Errorf("expansions notified: want %d, got %d", tc.expansions, expansions)
+			}
+		})
+	}
+}
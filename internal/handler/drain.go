@@ -0,0 +1,90 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"inet.af/netaddr"
+)
+
+// labelPrefix is the prefix of the labels the handler sets on the routes
+const labelPrefix = "ipam.nddr.yndd.io/"
+
+// Tenant is an allocation in a pool
+type Tenant struct {
+	Prefix string
+	// Labels are the selector and source-tag of the allocation
+	Labels map[string]string
+}
+
+// GetTenants returns the allocations of the pool of the prefix in the iptree
+// of the network instance, sorted by prefix
+func (r *handler) GetTenants(crName, prefix string) ([]*Tenant, error) {
+	p, err := netaddr.ParseIPPrefix(prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseIPPrefix failed")
+	}
+	t, ok := r.lookupTree(crName)
+	if !ok {
+		return nil, withReason(reasonNotReady, fmt.Errorf("pool/tree not ready, crName: %s", crName))
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	tenants := make([]*Tenant, 0)
+	for _, child := range t.routes.Children(p) {
+		if child.Get(labelKind) != kindAllocation {
+			continue
+		}
+		l := make(map[string]string)
+		for key, val := range *child.GetLabels() {
+			if !strings.HasPrefix(key, labelPrefix) {
+				l[key] = val
+			}
+		}
+		tenants = append(tenants, &Tenant{Prefix: child.String(), Labels: l})
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Prefix < tenants[j].Prefix })
+	return tenants, nil
+}
+
+// Migrating reports if the allocation of the prefix is in a draining pool of
+// which the allocations are migrated to the other pools
+func (r *handler) Migrating(crName, prefix string) bool {
+	p, err := netaddr.ParseIPPrefix(prefix)
+	if err != nil {
+		return false
+	}
+	t, ok := r.lookupTree(crName)
+	if !ok {
+		return false
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	for _, parent := range t.routes.Parents(p) {
+		if parent.Get(labelKind) == kindPool && parent.Get(labelLifecycle) == ipamv1alpha1.LifecycleDraining && parent.Get(labelMigrate) == "true" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hansthienpondt/goipam/pkg/table"
+	"github.com/pkg/errors"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"inet.af/netaddr"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// labelExpansionOf is set on a pool carved out of an aggregate to expand a
+// pool, it holds the name of the ip prefix of the expanded pool
+const labelExpansionOf = "ipam.nddr.yndd.io/expansion-of"
+
+// ExpansionFn is called when an allocation expanded a pool of a network
+// instance, the crName identifies the iptree and ni the network instance
+// resource it belongs to
+type ExpansionFn func(crName string, ni types.NamespacedName)
+
+// expandPolicy is the auto-expand policy of a pool
+type expandPolicy struct {
+	// name is the name of the ip prefix of the pool
+	name string
+	// labels are the labels of the pools carved to expand the pool
+	labels map[string]string
+	// selector matches the aggregate the expansions are carved out of
+	selector      map[string]string
+	prefixLength  uint32
+	maxExpansions uint32
+}
+
+// AddExpansionFn registers a function that is called when an allocation
+// expanded a pool
+func (r *handler) AddExpansionFn(fn ExpansionFn) {
+	r.stateFnMutex.Lock()
+	defer r.stateFnMutex.Unlock()
+	r.expansionFns = append(r.expansionFns, fn)
+}
+
+// GetExpansions returns the names of the ip prefixes carved out of the
+// aggregate to expand the pool of the ip prefix, ordered by name
+func (r *handler) GetExpansions(crName, name string) []string {
+	t, ok := r.lookupTree(crName)
+	if !ok {
+		return nil
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	expansions := t.expansions(name)
+	names := make([]string, 0, len(expansions))
+	for n := range expansions {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExpansionName returns the name of the next expansion of the ip prefix that
+// is not one of the names, the name extends the name of the ip prefix such
+// that the expansion belongs to the same network instance
+func ExpansionName(name string, names map[string]bool) string {
+	for i := 1; ; i++ {
+		n := fmt.Sprintf("%s-expand-%d", name, i)
+		if !names[n] {
+			return n
+		}
+	}
+}
+
+// setExpandPolicy records the auto-expand policy of the pool of the ip
+// prefix, a pool without auto-expand policy is never expanded. The lock of the
+// iptree is held by the caller.
+func (t *ipTree) setExpandPolicy(p netaddr.IPPrefix, cr ipamv1alpha1.Ipp, af string) {
+	ae := cr.GetAutoExpand()
+	if ae == nil || ae.PrefixLength == nil {
+		delete(t.expandPolicies, p.String())
+		return
+	}
+	// the expansions have the tags of the pool such that the allocations
+	// matching the pool also match its expansions
+	l := cr.GetTags()
+	l[ipamv1alpha1.KeyAddressFamily] = af
+	l[labelKind] = kindPool
+	l[labelAdminState] = ipamv1alpha1.AdminStateEnable
+	l[labelLifecycle] = ipamv1alpha1.LifecycleActive
+	l[labelExpansionOf] = cr.GetName()
+	t.expandPolicies[p.String()] = &expandPolicy{
+		name:          cr.GetName(),
+		labels:        l,
+		selector:      ae.GetSelector(),
+		prefixLength:  *ae.PrefixLength,
+		maxExpansions: ae.GetMaxExpansions(),
+	}
+}
+
+// expand carves a pool out of the aggregate of the auto-expand policy of the
+// first pool that can still be expanded, such that the allocation of a prefix
+// with the bits that found no room in the pools is made from the expansion.
+// The expansion is recorded as ip prefix once the expansion fns are notified.
+// The lock of the iptree is held by the caller.
+func (r *handler) expand(t *ipTree, pools table.Routes, bits uint8) (*table.Route, bool) {
+	for _, pool := range pools {
+		policy, ok := t.expandPolicies[pool.IPPrefix().String()]
+		if !ok || policy.prefixLength >= uint32(bits) {
+			continue
+		}
+		names := t.expansions(policy.name)
+		if uint32(len(names)) >= policy.maxExpansions {
+			continue
+		}
+		p, err := carve(t.routes, policy.selector, policy.prefixLength)
+		if err != nil {
+			r.log.Debug("cannot expand pool", "pool", pool.IPPrefix(), "error", err)
+			continue
+		}
+		l := make(map[string]string, len(policy.labels)+1)
+		for key, val := range policy.labels {
+			l[key] = val
+		}
+		l[labelCarvedFor] = ExpansionName(policy.name, names)
+		route := table.NewRoute(p)
+		route.UpdateLabel(l)
+		if err := t.routes.Add(route); err != nil {
+			r.log.Debug("cannot expand pool", "pool", pool.IPPrefix(), "error", err)
+			continue
+		}
+		r.log.Debug("expanded pool", "pool", pool.IPPrefix(), "expansion", p, "name", l[labelCarvedFor])
+		return route, true
+	}
+	return nil, false
+}
+
+// discard removes an expansion the allocation was not made from
+func (r *handler) discard(t *ipTree, expansion *table.Route) {
+	if _, _, err := t.routes.Delete(expansion); err != nil {
+		r.log.Debug("cannot discard expansion", "expansion", expansion.IPPrefix(), "error", errors.Wrap(err, "route deletion failed"))
+	}
+}
+
+// expansions returns the names of the pools carved to expand the pool of the
+// ip prefix with the name
+func (t *ipTree) expansions(name string) map[string]bool {
+	names := make(map[string]bool)
+	for _, route := range t.routes.GetTable() {
+		if route.Get(labelKind) == kindPool && route.Get(labelExpansionOf) == name {
+			names[route.Get(labelCarvedFor)] = true
+		}
+	}
+	return names
+}
+
+// notifyExpansion calls the expansion fns for the network instance
+func (r *handler) notifyExpansion(crName string, ni ipamv1alpha1.In) {
+	r.stateFnMutex.Lock()
+	defer r.stateFnMutex.Unlock()
+	for _, fn := range r.expansionFns {
+		fn(crName, types.NamespacedName{Namespace: ni.GetNamespace(), Name: ni.GetName()})
+	}
+}
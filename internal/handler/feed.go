@@ -0,0 +1,296 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// feedSize is the number of events kept to resume a watch
+	feedSize = 1024
+	// subscriberSize is the number of events buffered per watch, a watch that
+	// falls further behind is closed and needs to resume
+	subscriberSize = 256
+)
+
+type EventKind string
+
+const (
+	EventAllocate EventKind = "allocate"
+	EventRelease  EventKind = "release"
+	EventExpire   EventKind = "expire"
+	// EventSynced marks the end of the initial snapshot or replay of a watch
+	EventSynced EventKind = "synced"
+)
+
+// Event is a change of an allocation in the iptree of a network instance
+type Event struct {
+	Kind      EventKind
+	Namespace string
+	CrName    string
+	Prefix    string
+	Labels    map[string]string
+	Timestamp time.Time
+	// ResumeToken allows to resume a watch after this event
+	ResumeToken string
+}
+
+// WatchFilter selects the events of a watch, an empty CrName selects all
+// network instances of the namespace
+type WatchFilter struct {
+	Namespace string
+	CrName    string
+}
+
+func (f *WatchFilter) matches(e *Event) bool {
+	if e.Kind == EventSynced {
+		return true
+	}
+	if f.Namespace != "" && f.Namespace != e.Namespace {
+		return false
+	}
+	return f.CrName == "" || f.CrName == e.CrName
+}
+
+type subscriber struct {
+	filter *WatchFilter
+	ch     chan *Event
+}
+
+// feed is the change feed of the allocations, every event gets a sequence
+// number that is used in the resume token together with the epoch of the feed.
+// The feed keeps the allocations resulting from its events per network
+// instance, such that watches and queries are served without the locks of the
+// iptrees.
+type feed struct {
+	m           sync.RWMutex
+	epoch       int64
+	seq         uint64
+	events      []*feedEvent
+	subscribers map[*subscriber]struct{}
+	// allocations are the labels of the allocations indexed by the crName of
+	// the network instance and the prefix
+	allocations map[string]map[string]map[string]string
+}
+
+type feedEvent struct {
+	seq   uint64
+	event *Event
+}
+
+func newFeed() *feed {
+	return &feed{
+		epoch:       time.Now().UnixNano(),
+		events:      make([]*feedEvent, 0, feedSize),
+		subscribers: make(map[*subscriber]struct{}),
+		allocations: make(map[string]map[string]map[string]string),
+	}
+}
+
+func (f *feed) token(seq uint64) string {
+	return fmt.Sprintf("%d.%d", f.epoch, seq)
+}
+
+// parseToken returns the sequence number of a token of this feed
+func (f *feed) parseToken(token string) (uint64, bool) {
+	var epoch int64
+	var seq uint64
+	if _, err := fmt.Sscanf(token, "%d.%d", &epoch, &seq); err != nil || epoch != f.epoch {
+		return 0, false
+	}
+	return seq, true
+}
+
+func (f *feed) publish(e *Event) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.seq++
+	e.Timestamp = time.Now()
+	e.ResumeToken = f.token(f.seq)
+	if len(f.events) == feedSize {
+		f.events = f.events[1:]
+	}
+	f.events = append(f.events, &feedEvent{seq: f.seq, event: e})
+	f.apply(e)
+
+	for s := range f.subscribers {
+		if !s.filter.matches(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			// the subscriber is too slow, it has to resume from its last token
+			delete(f.subscribers, s)
+			close(s.ch)
+		}
+	}
+}
+
+// apply updates the allocations with the event, the expiry of a quarantined
+// prefix does not change the allocations
+func (f *feed) apply(e *Event) {
+	switch e.Kind {
+	case EventAllocate:
+		if _, ok := f.allocations[e.CrName]; !ok {
+			f.allocations[e.CrName] = make(map[string]map[string]string)
+		}
+		l := make(map[string]string, len(e.Labels))
+		for key, val := range e.Labels {
+			l[key] = val
+		}
+		f.allocations[e.CrName][e.Prefix] = l
+	case EventRelease:
+		delete(f.allocations[e.CrName], e.Prefix)
+	}
+}
+
+// drop removes the allocations of the deleted iptree of the network instance
+func (f *feed) drop(crName string) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	delete(f.allocations, crName)
+}
+
+// replay returns the events after the sequence number if they are all still
+// available in the feed
+func (f *feed) replay(seq uint64, filter *WatchFilter) ([]*Event, bool) {
+	if seq > f.seq || (len(f.events) > 0 && f.events[0].seq > seq+1) || (len(f.events) == 0 && seq != f.seq) {
+		return nil, false
+	}
+	events := make([]*Event, 0)
+	for _, fe := range f.events {
+		if fe.seq > seq && filter.matches(fe.event) {
+			events = append(events, fe.event)
+		}
+	}
+	return events, true
+}
+
+func (f *feed) subscribe(ctx context.Context, filter *WatchFilter) chan *Event {
+	s := &subscriber{filter: filter, ch: make(chan *Event, subscriberSize)}
+	f.subscribers[s] = struct{}{}
+	go func() {
+		<-ctx.Done()
+		f.m.Lock()
+		defer f.m.Unlock()
+		if _, ok := f.subscribers[s]; ok {
+			delete(f.subscribers, s)
+			close(s.ch)
+		}
+	}()
+	return s.ch
+}
+
+// Watch returns the initial events of the watch and a channel with the
+// subsequent events, the channel is closed when the context is done or the
+// watcher falls behind. A valid resume token replays the events after it,
+// otherwise the initial events are a snapshot of the current allocations.
+// The initial events always end with a synced event.
+func (r *handler) Watch(ctx context.Context, filter *WatchFilter, resumeToken string) ([]*Event, <-chan *Event, error) {
+	// the snapshot and the subscription are taken under the lock of the feed,
+	// such that no event is published in between
+	r.feed.m.Lock()
+	defer r.feed.m.Unlock()
+
+	var events []*Event
+	ok := false
+	if seq, valid := r.feed.parseToken(resumeToken); valid {
+		events, ok = r.feed.replay(seq, filter)
+	}
+	if !ok {
+		events = r.feed.snapshot(filter)
+	}
+	events = append(events, &Event{
+		Kind:        EventSynced,
+		Timestamp:   time.Now(),
+		ResumeToken: r.feed.token(r.feed.seq),
+	})
+	return events, r.feed.subscribe(ctx, filter), nil
+}
+
+// snapshot returns an allocate event for every allocation selected by the
+// filter
+func (f *feed) snapshot(filter *WatchFilter) []*Event {
+	events := make([]*Event, 0)
+	for crName, allocations := range f.allocations {
+		namespace := strings.SplitN(crName, ".", 2)[0]
+		if (filter.CrName != "" && filter.CrName != crName) || (filter.Namespace != "" && filter.Namespace != namespace) {
+			continue
+		}
+		for prefix, l := range allocations {
+			events = append(events, &Event{
+				Kind:        EventAllocate,
+				Namespace:   namespace,
+				CrName:      crName,
+				Prefix:      prefix,
+				Labels:      l,
+				Timestamp:   time.Now(),
+				ResumeToken: f.token(f.seq),
+			})
+		}
+	}
+	return events
+}
+
+// Get returns the prefix allocated to the owner of the info, the allocation
+// is looked up in the feed such that a query does not wait for the iptree
+func (r *handler) Get(ctx context.Context, info *RegisterInfo) (*string, error) {
+	if len(info.SourceTag) == 0 {
+		return nil, withReason(reasonInvalid, errors.New("source-tag not provided, it identifies the owner of the allocation"))
+	}
+	r.feed.m.RLock()
+	defer r.feed.m.RUnlock()
+	allocations := r.feed.allocations[info.CrName]
+	if info.IpPrefix != "" {
+		if l, ok := allocations[info.IpPrefix]; ok && ownsLabels(info, l) {
+			return &info.IpPrefix, nil
+		}
+		return nil, withReason(reasonNotFound, fmt.Errorf("allocation not found, prefix: %s", info.IpPrefix))
+	}
+	prefixes := make([]string, 0)
+	for prefix, l := range allocations {
+		if ownsLabels(info, l) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil, withReason(reasonNotFound, fmt.Errorf("allocation not found, crName: %s", info.CrName))
+	}
+	// the labels provide uniqueness, the lowest prefix is returned otherwise
+	sort.Strings(prefixes)
+	return &prefixes[0], nil
+}
+
+// publish adds a change of an allocation to the change feed
+func (r *handler) publish(kind EventKind, info *RegisterInfo, prefix string, l map[string]string) {
+	r.feed.publish(&Event{
+		Kind:      kind,
+		Namespace: info.Namespace,
+		CrName:    info.CrName,
+		Prefix:    prefix,
+		Labels:    l,
+	})
+}
@@ -5,26 +5,50 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hansthienpondt/goipam/pkg/table"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/yndd/ndd-runtime/pkg/logging"
 	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
 	"inet.af/netaddr"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
-	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// labelKind is set by the handler on every route in the iptree to
+	// distinguish the pools from the allocations
+	labelKind      = "ipam.nddr.yndd.io/kind"
+	kindPool       = "pool"
+	kindAllocation = "allocation"
+	// labelAdminState and labelLifecycle are set on the pools, a disabled or
+	// draining pool keeps its allocations but no new allocations are made
+	// from it
+	labelAdminState = "ipam.nddr.yndd.io/admin-state"
+	labelLifecycle  = "ipam.nddr.yndd.io/lifecycle"
+	// labelMigrate is set on a draining pool of which the allocations are
+	// migrated to the other pools
+	labelMigrate = "ipam.nddr.yndd.io/migrate"
+)
+
 func New(opts ...Option) (Handler, error) {
 	ipamNifn := func() ipamv1alpha1.In { return &ipamv1alpha1.IpamNetworkInstance{} }
 	s := &handler{
-		iptree:                 make(map[string]*table.RouteTable),
-		speedy:                 make(map[string]int),
+		iptree:                 make(map[string]*ipTree),
+		states:                 make(map[string]*treeState),
+		purposes:               make(map[string]ipamv1alpha1.Pu),
+		quotas:                 make(map[string]*quota),
+		requests:               make(map[string]map[string]*request),
+		feed:                   newFeed(),
 		newIpamNetworkInstance: ipamNifn,
 	}
+	s.metrics = newMetrics(s)
 
 	for _, opt := range opts {
 		opt(s)
@@ -41,17 +65,24 @@ func (r *handler) WithClient(c client.Client) {
 	r.client = c
 }
 
+func (r *handler) WithMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(r.metrics.collectors()...)
+}
+
 type RegisterInfo struct {
 	Namespace           string
 	Name                string
 	RegistryName        string
-	NetworkInstanceName string // only used in ipam
+	NetworkInstanceName string
 	CrName              string
 	IpPrefix            string
 	Purpose             string
 	AddressFamily       string
 	Selector            map[string]string
 	SourceTag           map[string]string
+	// MatchExpressions further restrict the pools a prefix is allocated from
+	MatchExpressions []metav1.LabelSelectorRequirement
+	RequestId        string // optional idempotency key
 }
 
 type handler struct {
@@ -61,97 +92,91 @@ type handler struct {
 
 	newIpamNetworkInstance func() ipamv1alpha1.In
 	iptreeMutex            sync.Mutex
-	iptree                 map[string]*table.RouteTable
-	speedyMutex            sync.Mutex
-	speedy                 map[string]int
+	iptree                 map[string]*ipTree
+	states                 map[string]*treeState
+	stateFnMutex           sync.Mutex
+	stateFns               []StateFn
+	expansionFns           []ExpansionFn
+	requestMutex           sync.Mutex
+	requests               map[string]map[string]*request
+	// purposes is the catalogue of the purposes, a purpose that is not in the
+	// catalogue uses the defaults of the network instance
+	purposeMutex sync.Mutex
+	purposes     map[string]ipamv1alpha1.Pu
+	// quotas is the catalogue of the quotas indexed by namespace and name
+	quotaMutex sync.Mutex
+	quotas     map[string]*quota
+	// feed is the change feed of the allocations
+	feed *feed
+	// metrics are only exported when registered using WithMetrics
+	metrics *metrics
 }
 
-func (r *handler) Init(crName string) {
-	r.iptreeMutex.Lock()
-	defer r.iptreeMutex.Unlock()
-	if _, ok := r.iptree[crName]; !ok {
-		r.iptree[crName] = table.NewRouteTable()
-	}
+func (r *handler) Register(ctx context.Context, info *RegisterInfo) (prefix *string, err error) {
+	start := time.Now()
+	var added bool
+	defer func() { r.metrics.observeRegister(info, start, added, err) }()
 
-	r.speedyMutex.Lock()
-	defer r.speedyMutex.Unlock()
-	if _, ok := r.speedy[crName]; !ok {
-		r.speedy[crName] = 0
+	ni, t, err := r.validateRegister(ctx, info)
+	if err != nil {
+		return nil, err
 	}
-}
-
-func (r *handler) Delete(crName string) {
-	r.iptreeMutex.Lock()
-	defer r.iptreeMutex.Unlock()
-	delete(r.iptree, crName)
-
-	r.speedyMutex.Lock()
-	defer r.speedyMutex.Unlock()
-	delete(r.speedy, crName)
-}
-
-func (r *handler) CheckAllocation(crName string, cr ipamv1alpha1.Rr) (bool, error) {
-	// check if allocations exists
-	if _, ok := r.iptree[crName]; ok {
-		if prefix, ok := cr.HasIpPrefix(); ok {
-			p, err := netaddr.ParseIPPrefix(prefix)
-			if err != nil {
-				return false, err
-			}
-			/*
-				routes := r.iptree[treename].Children(p)
-			*/
-			/*
-				if len(routes) > 0 {
-					// We cannot delete the prefix yet due to existing allocations
-					record.Event(cr, event.Warning(reasonCannotDeleteDueToAllocations, err))
-					log.Debug("Cannot delete prefix due to existing allocations", "error", err)
-					return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.client.Status().Update(ctx, cr), errUpdateStatus)
-				}
-			*/
-
-			route := table.NewRoute(p)
-			// TODO do we need to add the labels or not
-			//route.UpdateLabel(cr.GetTags())
-
-			if _, _, err := r.iptree[crName].Delete(route); err != nil {
-				return false, err
-			}
-		}
+	if err := checkAdminState(ni); err != nil {
+		return nil, err
 	}
-	return false, nil
-}
 
-func (r *handler) ResetSpeedy(crName string) {
-	r.speedyMutex.Lock()
-	defer r.speedyMutex.Unlock()
-	if _, ok := r.speedy[crName]; ok {
-		r.speedy[crName] = 0
+	// the allocations counted against the quotas of the info can be in the
+	// other iptrees of its namespace
+	scope := r.getQuotaScope(info)
+	defer r.lockTrees(opRegister, scope.merge(map[string]*ipTree{info.CrName: t}))()
+	a, err := r.register(info, ni, t, scope)
+	if err != nil {
+		return nil, err
 	}
-}
-
-func (r *handler) GetSpeedy(crName string) int {
-	r.speedyMutex.Lock()
-	defer r.speedyMutex.Unlock()
-	if _, ok := r.speedy[crName]; ok {
-		return r.speedy[crName]
+	added = a.added
+	if a.expansion != nil {
+		r.notifyExpansion(info.CrName, ni)
+	}
+	if added {
+		r.publish(EventAllocate, info, a.prefix, routeLabels(t.routes, a.prefix))
 	}
-	return 9999
+	return &a.prefix, nil
 }
 
-func (r *handler) IncrementSpeedy(crName string) {
-	r.speedyMutex.Lock()
-	defer r.speedyMutex.Unlock()
-	if _, ok := r.speedy[crName]; ok {
-		r.speedy[crName]++
-	}
+// allocation is the outcome of registering an info in the iptree
+type allocation struct {
+	prefix string
+	// added is set when a new route was added to the iptree, rather than an
+	// existing allocation being returned
+	added bool
+	// tombstone are the labels, including the expiry, of the quarantine
+	// tombstone the allocation revived
+	tombstone map[string]string
+	// expansion is the pool carved out of an aggregate for the allocation
+	expansion *table.Route
 }
 
-func (r *handler) Register(ctx context.Context, info *RegisterInfo) (*string, error) {
-	ni, iptree, err := r.validateRegister(ctx, info)
+// register allocates the prefix of the info in the iptree, it reports if a
+// new route was added to the iptree or an existing allocation was returned. A
+// pool with an auto-expand policy is expanded when the pools have no room
+// left, the caller notifies the expansion once the allocation is committed.
+func (r *handler) register(info *RegisterInfo, ni ipamv1alpha1.In, t *ipTree, scope quotaScope) (*allocation, error) {
+	iptree := t.routes
+	// a retried request returns the prefix allocated for its request id
+	allocated, ok, err := r.getRequest(info, iptree)
 	if err != nil {
 		return nil, err
 	}
+	if ok {
+		return &allocation{prefix: allocated}, nil
+	}
+
+	if len(info.SourceTag) == 0 {
+		return nil, withReason(reasonInvalid, errors.New("source-tag not provided, it identifies the owner of the allocation"))
+	}
+	if err := r.checkPurpose(info); err != nil {
+		return nil, err
+	}
 
 	// the selector is used in the tree to find the entry in the tree
 	// we use all the keys in the source-tag and selector for the search
@@ -161,7 +186,7 @@ func (r *handler) Register(ctx context.Context, info *RegisterInfo) (*string, er
 		req, err := labels.NewRequirement(key, selection.In, []string{val})
 		if err != nil {
 			r.log.Debug("wrong object", "Error", err)
-			return nil, err
+			return nil, withReason(reasonInvalid, err)
 		}
 		fullselector = fullselector.Add(*req)
 		l[key] = val
@@ -170,11 +195,14 @@ func (r *handler) Register(ctx context.Context, info *RegisterInfo) (*string, er
 		req, err := labels.NewRequirement(key, selection.In, []string{val})
 		if err != nil {
 			r.log.Debug("wrong object", "Error", err)
-			return nil, err
+			return nil, withReason(reasonInvalid, err)
 		}
 		fullselector = fullselector.Add(*req)
 		l[key] = val
 	}
+	l[labelKind] = kindAllocation
+	requestLabels(info, l)
+	alloc := &allocation{}
 	prefix := info.IpPrefix
 	if prefix != "" {
 		r.log.Debug("alloc has prefix", "prefix", prefix)
@@ -185,7 +213,7 @@ func (r *handler) Register(ctx context.Context, info *RegisterInfo) (*string, er
 			req, err := labels.NewRequirement(key, selection.In, []string{val})
 			if err != nil {
 				r.log.Debug("wrong object", "Error", err)
-				return nil, err
+				return nil, withReason(reasonInvalid, err)
 			}
 			selector = selector.Add(*req)
 		}
@@ -193,22 +221,68 @@ func (r *handler) Register(ctx context.Context, info *RegisterInfo) (*string, er
 		a, err := netaddr.ParseIPPrefix(prefix)
 		if err != nil {
 			r.log.Debug("Cannot parse ip prefix", "error", err)
-			return nil, errors.Wrap(err, "Cannot parse ip prefix")
+			return nil, withReason(reasonInvalid, errors.Wrap(err, "Cannot parse ip prefix"))
+		}
+		// a purpose or address-family selected with a match-expression is the
+		// one of the pool of the prefix
+		pi := info
+		if pool := parentPool(iptree, a); pool != nil {
+			pi = poolInfo(info, pool)
+		}
+		for key, val := range pi.Selector {
+			l[key] = val
+		}
+		if pu, ok := r.getPurpose(pi.Purpose); ok {
+			if err := checkPrefixLength(pu, pi.AddressFamily, uint32(a.Bits())); err != nil {
+				return nil, withReason(reasonInvalid, err)
+			}
+		}
+		existing, ok, _ := iptree.Get(a)
+		if !ok {
+			if err := checkParentPools(iptree, a); err != nil {
+				return nil, err
+			}
+		}
+		if !ok || existing.Get(labelKind) == kindQuarantine {
+			if err := r.checkQuota(pi, a, scope); err != nil {
+				return nil, err
+			}
 		}
 		route := table.NewRoute(a)
 		route.UpdateLabel(l)
 
+		alloc.added = true
 		if err := iptree.Add(route); err != nil {
 			r.log.Debug("route insertion failed")
 			if !strings.Contains(err.Error(), "already exists") {
-				return nil, errors.Wrap(err, "route insertion failed")
+				return nil, withReason(reasonInsert, errors.Wrap(err, "route insertion failed"))
+			}
+			alloc.added = false
+			existing, ok, _ := iptree.Get(a)
+			switch {
+			case !ok:
+				return nil, withReason(reasonInsert, errors.Wrap(err, "route insertion failed"))
+			case existing.Get(labelKind) == kindQuarantine:
+				tombstone := copyLabels(existing)
+				if err := revive(iptree, existing, l); err != nil {
+					return nil, err
+				}
+				alloc.added = true
+				alloc.tombstone = tombstone
+			case existing.Get(labelKind) != kindAllocation:
+				return nil, withReason(reasonConflict, fmt.Errorf("prefix is not an allocation, prefix: %s", prefix))
+			default:
+				// the prefix is only returned to the owner of the allocation
+				if err := owns(info, existing); err != nil {
+					return nil, err
+				}
 			}
 		}
 		prefix = route.String()
 	} else {
 		// alloc has no prefix assigned, try to assign prefix
 		// check if the prefix already exists
-		routes := iptree.GetByLabel(fullselector)
+		routes := owned(info, iptree.GetByLabel(fullselector))
 		if len(routes) == 0 {
 			// allocate prefix
 			r.log.Debug("Query not found, allocate a prefix")
@@ -219,10 +293,16 @@ func (r *handler) Register(ctx context.Context, info *RegisterInfo) (*string, er
 				req, err := labels.NewRequirement(key, selection.In, []string{val})
 				if err != nil {
 					r.log.Debug("wrong object", "Error", err)
-					return nil, errors.Wrap(err, "wrong object")
+					return nil, withReason(reasonInvalid, errors.Wrap(err, "wrong object"))
 				}
 				selector = selector.Add(*req)
 			}
+			reqs, err := matchRequirements(info.MatchExpressions)
+			if err != nil {
+				r.log.Debug("wrong object", "Error", err)
+				return nil, withReason(reasonInvalid, errors.Wrap(err, "wrong object"))
+			}
+			selector = selector.Add(reqs...)
 
 			routes := iptree.GetByLabel(selector)
 
@@ -230,27 +310,76 @@ func (r *handler) Register(ctx context.Context, info *RegisterInfo) (*string, er
 			// we break and the reconciliation will take care
 			if len(routes) == 0 {
 				r.log.Debug("no available routes")
-				return nil, errors.New("no available routes")
+				return nil, withReason(reasonExhausted, errors.New("no available routes"))
 			}
-
-			// TBD we take the first prefix
-			prefixLength, err := getPrefixLength(info, ni)
-			if err != nil {
-				return nil, errors.Wrap(err, "prefix Length not properly configured")
+			routes = availablePools(routes)
+			if len(routes) == 0 {
+				r.log.Debug("no available pools")
+				return nil, withReason(reasonDisabled, errors.New("no available pools, the matching pools are disabled or draining"))
 			}
 
-			a, ok := iptree.FindFreePrefix(routes[0].IPPrefix(), uint8(prefixLength))
+			// the pools are tried in order, such that the expansions of a
+			// pool are used once the pool is full; a purpose or
+			// address-family selected with a match-expression is the one of
+			// the pool
+			var a netaddr.IPPrefix
+			var ok bool
+			var pi *RegisterInfo
+			var prefixLength uint32
+			for _, pool := range routes {
+				p := poolInfo(info, pool)
+				if p != info && r.checkPurpose(p) != nil {
+					continue
+				}
+				pi = p
+				prefixLength, err = r.getPrefixLength(pi, ni)
+				if err != nil {
+					return nil, withReason(reasonConfig, errors.Wrap(err, "prefix Length not properly configured"))
+				}
+				if a, ok = r.findFreePrefix(iptree, pool.IPPrefix(), uint8(prefixLength), pi, ni); ok {
+					break
+				}
+			}
+			if pi == nil {
+				return nil, withReason(reasonInvalid, errors.New("no pool of a purpose allowing the address-family"))
+			}
+			// the pools have no room left, the allocation is retried in a
+			// pool carved out of the aggregate of the auto-expand policy
+			var expansion *table.Route
+			if !ok {
+				if expansion, ok = r.expand(t, routes, uint8(prefixLength)); ok {
+					pi = poolInfo(info, expansion)
+					a, ok = r.findFreePrefix(iptree, expansion.IPPrefix(), uint8(prefixLength), pi, ni)
+					if !ok {
+						r.discard(t, expansion)
+					}
+				}
+			}
 			if !ok {
 				r.log.Debug("allocation failed")
-				return nil, errors.New("allocation failed")
+				return nil, withReason(reasonExhausted, errors.New("allocation failed"))
+			}
+			if err := r.checkQuota(pi, a, scope); err != nil {
+				if expansion != nil {
+					r.discard(t, expansion)
+				}
+				return nil, err
+			}
+			for key, val := range pi.Selector {
+				l[key] = val
 			}
 
 			route := table.NewRoute(a)
 			route.UpdateLabel(l)
 			if err := iptree.Add(route); err != nil {
 				r.log.Debug("route insertion failed")
-				return nil, errors.Wrap(err, "route insertion failed")
+				if expansion != nil {
+					r.discard(t, expansion)
+				}
+				return nil, withReason(reasonInsert, errors.Wrap(err, "route insertion failed"))
 			}
+			alloc.added = true
+			alloc.expansion = expansion
 			prefix = route.String()
 
 		} else {
@@ -258,97 +387,309 @@ func (r *handler) Register(ctx context.Context, info *RegisterInfo) (*string, er
 				// this should never happen since the labels should provide uniqueness
 				r.log.Debug("strange situation, route in tree found multiple times", "ases", routes)
 			}
-			prefix = routes[0].IPPrefix().String()
+			route := pickAllocation(routes)
+			if route.Get(labelKind) == kindQuarantine {
+				// the allocation returns within the quarantine period, with
+				// the purpose and address-family it had
+				pi := poolInfo(info, route)
+				if err := r.checkQuota(pi, route.IPPrefix(), scope); err != nil {
+					return nil, err
+				}
+				for key, val := range pi.Selector {
+					l[key] = val
+				}
+				tombstone := copyLabels(route)
+				if err := revive(iptree, route, l); err != nil {
+					return nil, err
+				}
+				alloc.added = true
+				alloc.tombstone = tombstone
+			}
+			prefix = route.IPPrefix().String()
 		}
 
 	}
-	return &prefix, nil
+	r.recordRequest(info, prefix)
+	alloc.prefix = prefix
+	return alloc, nil
 }
 
-func (r *handler) DeRegister(ctx context.Context, info *RegisterInfo) error {
+func (r *handler) DeRegister(ctx context.Context, info *RegisterInfo) (err error) {
+	defer func() { r.metrics.observeDeRegister(info, err) }()
 
-	_, iptree, err := r.validateRegister(ctx, info)
+	_, t, err := r.validateRegister(ctx, info)
 	if err != nil {
 		return err
 	}
 
-	p, err := netaddr.ParseIPPrefix(info.IpPrefix)
+	r.lockTree(opDeRegister, t)
+	defer t.Unlock()
+	l := routeLabels(t.routes, info.IpPrefix)
+	if err := r.deregister(info, t.routes); err != nil {
+		return err
+	}
+	r.quarantine(t, info.IpPrefix, l)
+	r.publish(EventRelease, info, info.IpPrefix, l)
+	return nil
+}
+
+// deregister releases the allocation of the info from the iptree, the selector
+// and source-tag of the info have to match the labels of the allocation such
+// that a client can only release what it owns
+func (r *handler) deregister(info *RegisterInfo, iptree *table.RouteTable) error {
+	route, err := r.checkRelease(info, iptree)
 	if err != nil {
 		return err
 	}
-	/*
-		routes := r.iptree[treename].Children(p)
-	*/
-	/*
-		if len(routes) > 0 {
-			// We cannot delete the prefix yet due to existing allocations
-			record.Event(cr, event.Warning(reasonCannotDeleteDueToAllocations, err))
-			log.Debug("Cannot delete prefix due to existing allocations", "error", err)
-			return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.client.Status().Update(ctx, cr), errUpdateStatus)
-		}
-	*/
+	return r.release(info, route, iptree)
+}
 
-	route := table.NewRoute(p)
-	// TODO do we need to add the labels or not
-	//route.UpdateLabel(cr.GetTags())
+// checkRelease returns the route of the allocation of the info when it is
+// owned by the info
+func (r *handler) checkRelease(info *RegisterInfo, iptree *table.RouteTable) (*table.Route, error) {
+	p, err := netaddr.ParseIPPrefix(info.IpPrefix)
+	if err != nil {
+		return nil, withReason(reasonInvalid, err)
+	}
+	route, ok, err := iptree.Get(p)
+	if err != nil || !ok {
+		r.log.Debug("IPPrefix not found", "prefix", p)
+		return nil, withReason(reasonNotFound, fmt.Errorf("allocation not found, prefix: %s", info.IpPrefix))
+	}
+	if route.Get(labelKind) == kindQuarantine {
+		// the prefix is already released
+		return nil, withReason(reasonNotFound, fmt.Errorf("allocation not found, prefix: %s", info.IpPrefix))
+	}
+	if route.Get(labelKind) != kindAllocation {
+		return nil, withReason(reasonConflict, fmt.Errorf("prefix is not an allocation, prefix: %s", info.IpPrefix))
+	}
+	if err := owns(info, route); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
 
+// release deletes the route of an allocation from the iptree
+func (r *handler) release(info *RegisterInfo, route *table.Route, iptree *table.RouteTable) error {
 	if _, _, err := iptree.Delete(route); err != nil {
-		r.log.Debug("IPPrefix deleteion failed", "prefix", p)
-		return err
+		r.log.Debug("IPPrefix deleteion failed", "prefix", route.IPPrefix())
+		return withReason(reasonNotFound, err)
 	}
+	r.forgetRequests(info.CrName, route.String())
 	return nil
+}
 
+// owns checks the labels of the route, other than the labels set by the
+// handler, are exactly the selector and source-tag of the info; the source-tag
+// identifies the owner and is required
+func owns(info *RegisterInfo, route *table.Route) error {
+	if len(info.SourceTag) == 0 {
+		return withReason(reasonConflict, fmt.Errorf("source-tag of the allocation not provided, prefix: %s", route.String()))
+	}
+	if !ownedBy(info, route) {
+		return withReason(reasonConflict, fmt.Errorf("allocation not owned by the requester, prefix: %s", route.String()))
+	}
+	return nil
 }
 
-func (r *handler) validateRegister(ctx context.Context, info *RegisterInfo) (ipamv1alpha1.In, *table.RouteTable, error) {
-	namespace := info.Namespace
-	//registryName := info.RegistryName
-	crName := info.CrName
-	networkInstanceName := info.NetworkInstanceName
+// owned returns the routes that are owned by the info
+func owned(info *RegisterInfo, routes table.Routes) table.Routes {
+	o := make(table.Routes, 0, len(routes))
+	for _, route := range routes {
+		if ownedBy(info, route) {
+			o = append(o, route)
+		}
+	}
+	return o
+}
+
+// ownedBy reports if the labels of the route, other than the labels set by the
+// handler, are exactly the selector and source-tag of the info
+func ownedBy(info *RegisterInfo, route *table.Route) bool {
+	return ownsLabels(info, *route.GetLabels())
+}
+
+// ownsLabels reports if the labels, other than the labels set by the handler,
+// are exactly the selector and source-tag of the info; the purpose and
+// address-family the info selects with a match-expression are taken from the
+// pool and can be any of the selected values
+func ownsLabels(info *RegisterInfo, l map[string]string) bool {
+	want := make(map[string]string, len(info.Selector)+len(info.SourceTag))
+	for _, l := range []map[string]string{info.Selector, info.SourceTag} {
+		for key, val := range l {
+			want[key] = val
+		}
+	}
+	got := make(map[string]string, len(want))
+	for key, val := range l {
+		if strings.HasPrefix(key, labelPrefix) {
+			continue
+		}
+		if _, ok := want[key]; !ok && selectedByExpression(info, key, val) {
+			continue
+		}
+		got[key] = val
+	}
+	return labels.Equals(want, got)
+}
+
+func (r *handler) validateRegister(ctx context.Context, info *RegisterInfo) (ipamv1alpha1.In, *ipTree, error) {
+	ni, err := r.validateNetworkInstance(ctx, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := r.getTree(info.CrName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ni, t, nil
+}
+
+// validateNetworkInstance checks the network instance of the info exists and is ready
+func (r *handler) validateNetworkInstance(ctx context.Context, info *RegisterInfo) (ipamv1alpha1.In, error) {
+	if info.RegistryName == "" || info.NetworkInstanceName == "" {
+		return nil, withReason(reasonInvalid, fmt.Errorf("registry or networkInstance not provided, registry: %s, networkInstance: %s", info.RegistryName, info.NetworkInstanceName))
+	}
+	// the iptree records the network instance resource it was created for,
+	// such that the resource name does not have to be derived from the
+	// register name
+	key, ok := r.lookupState(info.CrName)
+	if !ok {
+		r.log.Debug("networkInstance not found")
+		// the iptree is missing until the network instance is initialized,
+		// a network instance that does not exist is an invalid reference
+		exists, err := r.networkInstanceExists(ctx, info)
+		if err != nil {
+			return nil, withReason(reasonNotReady, err)
+		}
+		if !exists {
+			return nil, withReason(reasonInvalid, fmt.Errorf("networkInstance not found: %s/%s", info.RegistryName, info.NetworkInstanceName))
+		}
+		return nil, withReason(reasonNotReady, fmt.Errorf("networkInstance not initialized: %s/%s", info.RegistryName, info.NetworkInstanceName))
+	}
 
 	// find registry in k8s api
 	ni := r.newIpamNetworkInstance()
-	if err := r.client.Get(ctx, types.NamespacedName{
-		Namespace: namespace,
-		Name:      networkInstanceName}, ni); err != nil {
-		// can happen when the ipam is not found
+	if err := r.client.Get(ctx, key, ni); err != nil {
 		r.log.Debug("networkInstance not found")
-		return nil, nil, fmt.Errorf("networkInstance not found: %s", networkInstanceName)
+		if apierrors.IsNotFound(err) {
+			return nil, withReason(reasonInvalid, fmt.Errorf("networkInstance not found: %s", key.Name))
+		}
+		return nil, withReason(reasonNotReady, errors.Wrap(err, "cannot get networkInstance"))
 	}
 
 	// check is registry is ready
 	if ni.GetCondition(ipamv1alpha1.ConditionKindReady).Status != corev1.ConditionTrue {
-		return nil, nil, fmt.Errorf("networkInstance not ready: %s", networkInstanceName)
+		return nil, withReason(reasonNotReady, fmt.Errorf("networkInstance not ready: %s", key.Name))
+	}
+	return ni, nil
+}
+
+// networkInstanceExists reports if the namespace of the info has a network
+// instance for the registry and network instance of the info
+func (r *handler) networkInstanceExists(ctx context.Context, info *RegisterInfo) (bool, error) {
+	nis := &ipamv1alpha1.IpamNetworkInstanceList{}
+	if err := r.client.List(ctx, nis, client.InNamespace(info.Namespace)); err != nil {
+		return false, errors.Wrap(err, "cannot list networkInstances")
+	}
+	for _, ni := range nis.GetNetworkInstances() {
+		if ni.GetIpamName() == info.RegistryName && ni.GetNetworkInstanceName() == info.NetworkInstanceName {
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
-	if _, ok := r.iptree[crName]; !ok {
-		return nil, nil, fmt.Errorf("networkInstance iptree not ready: %s", crName)
+// checkAdminState checks new allocations are allowed in the network instance,
+// the network instance is down when it or its ipam is disabled
+func checkAdminState(ni ipamv1alpha1.In) error {
+	if ni.GetAdminState() == ipamv1alpha1.AdminStateDisable {
+		return withReason(reasonDisabled, fmt.Errorf("networkInstance administratively disabled: %s", ni.GetName()))
 	}
+	if ni.GetStatus() == "down" {
+		return withReason(reasonDisabled, fmt.Errorf("networkInstance down: %s, reason: %s", ni.GetName(), ni.GetReason()))
+	}
+	return nil
+}
+
+// availablePools returns the pools of the routes that are neither disabled nor
+// draining
+func availablePools(routes table.Routes) table.Routes {
+	pools := make(table.Routes, 0, len(routes))
+	for _, route := range routes {
+		if route.Get(labelKind) == kindPool && available(route) {
+			pools = append(pools, route)
+		}
+	}
+	return pools
+}
+
+func available(pool *table.Route) bool {
+	return pool.Get(labelAdminState) != ipamv1alpha1.AdminStateDisable &&
+		pool.Get(labelLifecycle) != ipamv1alpha1.LifecycleDraining
+}
+
+// checkParentPools checks the prefix is not allocated from a disabled or
+// draining pool
+func checkParentPools(iptree *table.RouteTable, p netaddr.IPPrefix) error {
+	for _, parent := range iptree.Parents(p) {
+		if parent.Get(labelKind) == kindPool && !available(parent) {
+			return withReason(reasonDisabled, fmt.Errorf("pool disabled or draining: %s", parent.IPPrefix()))
+		}
+	}
+	return nil
+}
 
-	// check if the pool/register is ready to handle new registrations
-	r.iptreeMutex.Lock()
-	defer r.iptreeMutex.Unlock()
-	if _, ok := r.iptree[crName]; !ok {
-		r.log.Debug("pool/tree not ready", "crName", crName)
-		return nil, nil, fmt.Errorf("pool/tree not ready, crName: %s", crName)
+// routeLabels returns the labels of the route of the prefix in the iptree
+func routeLabels(iptree *table.RouteTable, prefix string) map[string]string {
+	p, err := netaddr.ParseIPPrefix(prefix)
+	if err != nil {
+		return nil
+	}
+	route, ok, _ := iptree.Get(p)
+	if !ok {
+		return nil
 	}
-	iptree := r.iptree[crName]
+	return *route.GetLabels()
+}
 
-	return ni, iptree, nil
+// matchRequirements converts the match-expressions in label requirements
+func matchRequirements(exprs []metav1.LabelSelectorRequirement) ([]labels.Requirement, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{MatchExpressions: exprs})
+	if err != nil {
+		return nil, err
+	}
+	reqs, _ := selector.Requirements()
+	return reqs, nil
 }
 
-func getPrefixLength(info *RegisterInfo, ni ipamv1alpha1.In) (uint32, error) {
+// getPrefixLength returns the default prefix length of the network instance
+// for the purpose, falling back to the default of the purpose catalogue
+func (r *handler) getPrefixLength(info *RegisterInfo, ni ipamv1alpha1.In) (uint32, error) {
 	prefixLength := ni.GetDefaultPrefixLength(info.Purpose, info.AddressFamily)
+	pu, ok := r.getPurpose(info.Purpose)
+	if prefixLength == nil && ok {
+		prefixLength = pu.GetDefaultPrefixLength(info.AddressFamily)
+	}
 	if prefixLength == nil {
 		return 0, fmt.Errorf("default prefix length not configured properly, purpose: %s, sf: %s", info.Purpose, info.AddressFamily)
 	}
+	if ok {
+		if err := checkPrefixLength(pu, info.AddressFamily, *prefixLength); err != nil {
+			return 0, err
+		}
+	}
 	return *prefixLength, nil
 }
 
+// AddIpPrefix adds the ip prefix to the iptree of the network instance, the
+// iptree does not have to be ready such that it can be loaded
 func (r *handler) AddIpPrefix(crName string, cr ipamv1alpha1.Ipp) error {
-	r.speedyMutex.Lock()
-	defer r.speedyMutex.Unlock()
-	if _, ok := r.iptree[crName]; !ok {
+	t, ok := r.lookupTree(crName)
+	if !ok {
 		r.log.Debug("Parent Routing table not ready")
 		return errors.New("ipam ni not ready")
 	}
@@ -367,14 +708,18 @@ func (r *handler) AddIpPrefix(crName string, cr ipamv1alpha1.Ipp) error {
 		af = string(ipamv1alpha1.AddressFamilyIpv6)
 	}
 	cr.SetAddressFamily(af)
-	// we add the address family in the tag/label to allow to selec the prefix on this basis
-	tags := cr.GetTags()
-	tags[ipamv1alpha1.KeyAddressFamily] = af
 	route := table.NewRoute(p)
-	route.UpdateLabel(tags)
+	route.UpdateLabel(ipPrefixLabels(cr, af))
 
-	if err := r.iptree[crName].Add(route); err != nil {
+	r.lockTree(opAddIpPrefix, t)
+	defer t.Unlock()
+	t.setExpandPolicy(p, cr, af)
+	if err := t.routes.Add(route); err != nil {
 		if strings.Contains(err.Error(), "already exists") {
+			// replace the pool such that its admin-state and tags are updated
+			if existing, ok, _ := t.routes.Get(p); ok && existing.Get(labelKind) == kindPool {
+				return errors.Wrap(t.routes.Update(route), "IPPrefix update failed")
+			}
 			return nil
 		}
 		r.log.Debug("IPPrefix insertion failed", "prefix", p)
@@ -382,3 +727,90 @@ func (r *handler) AddIpPrefix(crName string, cr ipamv1alpha1.Ipp) error {
 	}
 	return nil
 }
+
+// ipPrefixLabels returns the labels of the route of the ip prefix in the iptree
+func ipPrefixLabels(cr ipamv1alpha1.Ipp, af string) map[string]string {
+	// we add the address family in the tag/label to allow to selec the prefix on this basis
+	tags := cr.GetTags()
+	tags[ipamv1alpha1.KeyAddressFamily] = af
+	tags[labelKind] = kindPool
+	tags[labelAdminState] = cr.GetAdminState()
+	tags[labelLifecycle] = cr.GetLifecycle()
+	if cr.GetMigrate() {
+		tags[labelMigrate] = "true"
+	}
+	if cr.HasParent() {
+		tags[labelCarvedFor] = cr.GetName()
+	}
+	// an expansion is controlled by the ip prefix it expands
+	if owner := metav1.GetControllerOf(cr); owner != nil && owner.Kind == ipamv1alpha1.IpamNetworkInstanceIpPrefixKindKind {
+		tags[labelExpansionOf] = owner.Name
+	}
+	return tags
+}
+
+// DeleteIpPrefix deletes the ip prefix from the iptree of the network
+// instance without touching the other prefixes of the network instance. A pool
+// that still has allocations is only deleted with the cascade deletion policy,
+// which releases the allocations; a pool with nested pools is never deleted.
+func (r *handler) DeleteIpPrefix(crName string, cr ipamv1alpha1.Ipp) error {
+	t, ok := r.lookupTree(crName)
+	if !ok {
+		// the iptree is already gone
+		return nil
+	}
+
+	p, err := netaddr.ParseIPPrefix(cr.GetIpPrefix())
+	if err != nil {
+		r.log.Debug("UpdateConfig ParseIPPrefix", "Error", err)
+		return errors.Wrap(err, "ParseIPPrefix failed")
+	}
+
+	r.lockTree(opDeleteIpPrefix, t)
+	defer t.Unlock()
+	route, ok, err := t.routes.Get(p)
+	if err != nil || !ok {
+		return nil
+	}
+	if route.Get(labelKind) != kindPool {
+		return withReason(reasonConflict, fmt.Errorf("prefix is not a pool, prefix: %s", p))
+	}
+	// the quarantined prefixes are removed with the pool
+	children := make(table.Routes, 0)
+	tombstones := make(table.Routes, 0)
+	for _, child := range t.routes.Children(p) {
+		if child.Get(labelKind) == kindQuarantine {
+			tombstones = append(tombstones, child)
+		} else {
+			children = append(children, child)
+		}
+	}
+	if len(children) > 0 && cr.GetDeletionPolicy() != ipamv1alpha1.DeletionPolicyCascade {
+		return withReason(reasonConflict, fmt.Errorf("pool still has %d children, prefix: %s", len(children), p))
+	}
+	for _, child := range children {
+		if child.Get(labelKind) != kindAllocation {
+			return withReason(reasonConflict, fmt.Errorf("pool has nested pool %s, prefix: %s", child.String(), p))
+		}
+	}
+	info := &RegisterInfo{Namespace: cr.GetNamespace(), CrName: crName}
+	for _, child := range children {
+		l := *child.GetLabels()
+		if err := r.release(info, child, t.routes); err != nil {
+			return errors.Wrap(err, "IPPrefix cascade release failed")
+		}
+		r.metrics.releases.WithLabelValues(crName).Inc()
+		r.publish(EventRelease, info, child.String(), l)
+	}
+	for _, tombstone := range tombstones {
+		if _, _, err := t.routes.Delete(tombstone); err != nil {
+			return errors.Wrap(err, "IPPrefix tombstone deletion failed")
+		}
+	}
+	if _, _, err := t.routes.Delete(route); err != nil {
+		r.log.Debug("IPPrefix deleteion failed", "prefix", p)
+		return errors.Wrap(err, "IPPrefix deletion failed")
+	}
+	delete(t.expandPolicies, p.String())
+	return nil
+}
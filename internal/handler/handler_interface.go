@@ -2,9 +2,12 @@ package handler
 
 import (
 	"context"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/yndd/ndd-runtime/pkg/logging"
 	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -24,16 +27,42 @@ func WithClient(c client.Client) Option {
 	}
 }
 
+// WithMetrics registers the metrics of the handler with the registerer
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(s Handler) {
+		s.WithMetrics(reg)
+	}
+}
+
 type Handler interface {
 	WithLogger(log logging.Logger)
 	WithClient(a client.Client)
-	Init(string)
+	WithMetrics(reg prometheus.Registerer)
+	Init(crName string, ni types.NamespacedName)
+	Load(crName string, ipps []ipamv1alpha1.Ipp)
+	GetState(crName string) State
 	Delete(string)
-	CheckAllocation(crName string, cr ipamv1alpha1.Rr) (bool, error)
-	ResetSpeedy(string)
-	GetSpeedy(crName string) int
-	IncrementSpeedy(crName string)
+	Quarantine(crName string, period time.Duration)
+	AddStateFn(StateFn)
+	AddExpansionFn(ExpansionFn)
 	Register(context.Context, *RegisterInfo) (*string, error)
 	DeRegister(context.Context, *RegisterInfo) error
+	Reallocate(ctx context.Context, from, to *RegisterInfo) (*string, error)
+	RegisterBulk(context.Context, []*RegisterInfo) ([]*RegisterResult, error)
+	DeRegisterBulk(context.Context, []*RegisterInfo) ([]*RegisterResult, error)
+	Get(context.Context, *RegisterInfo) (*string, error)
+	Watch(ctx context.Context, filter *WatchFilter, resumeToken string) ([]*Event, <-chan *Event, error)
 	AddIpPrefix(crName string, cr ipamv1alpha1.Ipp) error
+	DeleteIpPrefix(crName string, cr ipamv1alpha1.Ipp) error
+	CarveIpPrefix(crName string, cr ipamv1alpha1.Ipp) (string, error)
+	GetPoolHierarchy(crName, prefix string) (*PoolHierarchy, error)
+	GetPoolUsage(crName, prefix string) (*PoolUsage, error)
+	SetPurpose(pu ipamv1alpha1.Pu)
+	DeletePurpose(name string)
+	SetQuota(q ipamv1alpha1.Qu) error
+	DeleteQuota(namespace, name string)
+	GetQuotaUsage(namespace, name string) (*QuotaUsage, error)
+	GetTenants(crName, prefix string) ([]*Tenant, error)
+	Migrating(crName, prefix string) bool
+	GetExpansions(crName, name string) []string
 }
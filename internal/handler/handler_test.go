@@ -0,0 +1,1273 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	nddov1 "github.com/yndd/nddo-runtime/apis/common/v1"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"inet.af/netaddr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const (
+	testNamespace = "default"
+	testRegistry  = "nokia"
+	testPurpose   = "isl"
+)
+
+// newTestHandler returns a handler with a ready iptree for each of the network
+// instances, the network instances are served by a fake client
+func newTestHandler(t *testing.T, nis ...string) *handler {
+	t.Helper()
+	s := runtime.NewScheme()
+	if err := ipamv1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	objs := make([]client.Object, 0, len(nis))
+	for _, ni := range nis {
+		objs = append(objs, newTestNetworkInstance(ni))
+	}
+	h, err := New(
+		WithLogger(logging.NewNopLogger()),
+		WithClient(fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := h.(*handler)
+	for _, ni := range nis {
+		r.Init(testCrName(ni), types.NamespacedName{Namespace: testNamespace, Name: ni})
+		r.Load(testCrName(ni), nil)
+	}
+	return r
+}
+
+// newTestNetworkInstance returns a ready network instance with a default
+// prefix length for the isl purpose of both address families
+func newTestNetworkInstance(name string) *ipamv1alpha1.IpamNetworkInstance {
+	ni := &ipamv1alpha1.IpamNetworkInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: ipamv1alpha1.IpamNetworkInstanceSpec{
+			IpamNetworkInstance: &ipamv1alpha1.IpamIpamNetworkInstance{
+				AdminState: utils.StringPtr(ipamv1alpha1.AdminStateEnable),
+				DefaultPrefixLength: map[string]*ipamv1alpha1.IpamIpamNetworkInstanceDefaultPrefixLength{
+					testPurpose: {AddressFamily: map[string]*uint32{
+						string(ipamv1alpha1.AddressFamilyIpv4): utils.Uint32Ptr(31),
+						string(ipamv1alpha1.AddressFamilyIpv6): utils.Uint32Ptr(127),
+					}},
+				},
+			},
+		},
+	}
+	ni.SetConditions(ipamv1alpha1.Ready())
+	return ni
+}
+
+func testCrName(ni string) string {
+	return fmt.Sprintf("%s.%s.%s", testNamespace, testRegistry, ni)
+}
+
+// newTestIpPrefix returns an ip prefix of the isl purpose
+func newTestIpPrefix(name, prefix string) *ipamv1alpha1.IpamNetworkInstanceIpPrefix {
+	return &ipamv1alpha1.IpamNetworkInstanceIpPrefix{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: ipamv1alpha1.IpamNetworkInstanceIpPrefixSpec{
+			IpamNetworkInstanceIpPrefix: &ipamv1alpha1.IpamIpamNetworkInstanceIpPrefix{
+				AdminState: utils.StringPtr(ipamv1alpha1.AdminStateEnable),
+				Prefix:     utils.StringPtr(prefix),
+				Tag: []*nddov1.Tag{
+					{Key: utils.StringPtr(ipamv1alpha1.KeyPurpose), Value: utils.StringPtr(testPurpose)},
+				},
+			},
+		},
+		Status: ipamv1alpha1.IpamNetworkInstanceIpPrefixStatus{
+			IpamNetworkInstanceIpPrefix: &ipamv1alpha1.NddrIpamIpamNetworkInstanceIpPrefix{
+				State: &ipamv1alpha1.NddrIpamIpamNetworkInstanceIpPrefixState{},
+			},
+		},
+	}
+}
+
+// newTestInfo returns the info of a dynamic allocation of the isl purpose
+// owned by the client
+func newTestInfo(ni, af, owner string) *RegisterInfo {
+	return &RegisterInfo{
+		Namespace:           testNamespace,
+		RegistryName:        testRegistry,
+		NetworkInstanceName: ni,
+		CrName:              testCrName(ni),
+		Purpose:             testPurpose,
+		AddressFamily:       af,
+		Selector: map[string]string{
+			ipamv1alpha1.KeyPurpose:       testPurpose,
+			ipamv1alpha1.KeyAddressFamily: af,
+		},
+		SourceTag: map[string]string{"client": owner},
+	}
+}
+
+const (
+	ipv4 = string(ipamv1alpha1.AddressFamilyIpv4)
+	ipv6 = string(ipamv1alpha1.AddressFamilyIpv6)
+	// testAggregate is the purpose of the aggregates pools are expanded from
+	testAggregate = "aggregate"
+)
+
+// addTestPools adds the prefixes as pools of the isl purpose to the iptree of
+// the network instance
+func addTestPools(t *testing.T, r *handler, ni string, prefixes ...string) {
+	t.Helper()
+	for _, prefix := range prefixes {
+		if err := r.AddIpPrefix(testCrName(ni), newTestIpPrefix(prefix, prefix)); err != nil {
+			t.Fatalf("cannot add pool %s: %v", prefix, err)
+		}
+	}
+}
+
+// registerTest registers the infos and returns the allocated prefixes
+func registerTest(t *testing.T, r *handler, infos ...*RegisterInfo) []string {
+	t.Helper()
+	prefixes := make([]string, 0, len(infos))
+	for _, info := range infos {
+		p, err := r.Register(context.Background(), info)
+		if err != nil {
+			t.Fatalf("cannot register %v: %v", info.SourceTag, err)
+		}
+		prefixes = append(prefixes, *p)
+	}
+	return prefixes
+}
+
+// withPrefix returns the info for the explicit prefix
+func withPrefix(info *RegisterInfo, prefix string) *RegisterInfo {
+	info.IpPrefix = prefix
+	return info
+}
+
+// checkReason checks the error has the reason, an empty reason expects no
+// error
+func checkReason(t *testing.T, err error, reason string) {
+	t.Helper()
+	switch {
+	case reason == "" && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case reason != "" && err == nil:
+		t.Fatalf("expected %s error, got none", reason)
+	case reason != "" && reasonOf(err) != reason:
+		t.Fatalf("expected %s error, got %s: %v", reason, reasonOf(err), err)
+	}
+}
+
+// routeKind returns the kind of the route of the prefix in the iptree of the
+// network instance, or an empty string when the prefix is not in the iptree
+func routeKind(t *testing.T, r *handler, ni, prefix string) string {
+	t.Helper()
+	tr, ok := r.lookupTree(testCrName(ni))
+	if !ok {
+		t.Fatalf("iptree of %s not found", ni)
+	}
+	route, ok, _ := tr.routes.Get(netaddr.MustParseIPPrefix(prefix))
+	if !ok {
+		return ""
+	}
+	return route.Get(labelKind)
+}
+
+// newTestAggregate returns an aggregate the pools of the isl purpose are
+// expanded from
+func newTestAggregate(prefix string) *ipamv1alpha1.IpamNetworkInstanceIpPrefix {
+	ipp := newTestIpPrefix(prefix, prefix)
+	ipp.Spec.IpamNetworkInstanceIpPrefix.Tag = []*nddov1.Tag{
+		{Key: utils.StringPtr(ipamv1alpha1.KeyPurpose), Value: utils.StringPtr(testAggregate)},
+	}
+	return ipp
+}
+
+// withAutoExpand returns the pool expanded by at most max prefixes of the
+// length out of the aggregate
+func withAutoExpand(ipp *ipamv1alpha1.IpamNetworkInstanceIpPrefix, bits, max uint32) *ipamv1alpha1.IpamNetworkInstanceIpPrefix {
+	ipp.Spec.IpamNetworkInstanceIpPrefix.AutoExpand = &ipamv1alpha1.IpamAutoExpand{
+		Selector: []*nddov1.Tag{
+			{Key: utils.StringPtr(ipamv1alpha1.KeyPurpose), Value: utils.StringPtr(testAggregate)},
+		},
+		PrefixLength:  utils.Uint32Ptr(bits),
+		MaxExpansions: utils.Uint32Ptr(max),
+	}
+	return ipp
+}
+
+// addTestIpPrefixes adds the ip prefixes to the iptree of the network instance
+func addTestIpPrefixes(t *testing.T, r *handler, ni string, ipps ...*ipamv1alpha1.IpamNetworkInstanceIpPrefix) {
+	t.Helper()
+	for _, ipp := range ipps {
+		if err := r.AddIpPrefix(testCrName(ni), ipp); err != nil {
+			t.Fatalf("cannot add ip prefix %s: %v", ipp.GetName(), err)
+		}
+	}
+}
+
+// releaseTest releases the infos, the prefix of an info is the prefix it was
+// allocated
+func releaseTest(t *testing.T, r *handler, infos ...*RegisterInfo) {
+	t.Helper()
+	for _, info := range infos {
+		if err := r.DeRegister(context.Background(), info); err != nil {
+			t.Fatalf("cannot release %s: %v", info.IpPrefix, err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name     string
+		pools    []string
+		disabled []string
+		prior    []*RegisterInfo
+		info     *RegisterInfo
+		want     string
+		reason   string
+	}{
+		{
+			name:  "ipv4 from the pool",
+			pools: []string{"10.0.0.0/24"},
+			info:  newTestInfo("ni-a", ipv4, "a"),
+			want:  "10.0.0.0/31",
+		},
+		{
+			name:  "ipv6 from the pool",
+			pools: []string{"10.0.0.0/24", "2001:db8::/64"},
+			info:  newTestInfo("ni-a", ipv6, "a"),
+			want:  "2001:db8::/127",
+		},
+		{
+			name:  "dual families for one owner",
+			pools: []string{"10.0.0.0/24", "2001:db8::/64"},
+			prior: []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:  newTestInfo("ni-a", ipv6, "a"),
+			want:  "2001:db8::/127",
+		},
+		{
+			name:  "next free prefix",
+			pools: []string{"10.0.0.0/24"},
+			prior: []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:  newTestInfo("ni-a", ipv4, "b"),
+			want:  "10.0.0.2/31",
+		},
+		{
+			name:  "existing allocation of the owner",
+			pools: []string{"10.0.0.0/24"},
+			prior: []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			info:  newTestInfo("ni-a", ipv4, "a"),
+			want:  "10.0.0.0/31",
+		},
+		{
+			name:  "second pool when the first is full",
+			pools: []string{"10.0.0.0/30", "10.0.1.0/30"},
+			prior: []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			info:  newTestInfo("ni-a", ipv4, "c"),
+			want:  "10.0.1.0/31",
+		},
+		{
+			name:  "explicit prefix",
+			pools: []string{"10.0.0.0/24"},
+			info:  withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.8/31"),
+			want:  "10.0.0.8/31",
+		},
+		{
+			name:  "explicit prefix of the owner",
+			pools: []string{"10.0.0.0/24"},
+			prior: []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.8/31")},
+			info:  withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.8/31"),
+			want:  "10.0.0.8/31",
+		},
+		{
+			name:   "explicit prefix of another owner",
+			pools:  []string{"10.0.0.0/24"},
+			prior:  []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.8/31")},
+			info:   withPrefix(newTestInfo("ni-a", ipv4, "b"), "10.0.0.8/31"),
+			reason: reasonConflict,
+		},
+		{
+			name:   "explicit prefix of a pool",
+			pools:  []string{"10.0.0.0/24"},
+			info:   withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/24"),
+			reason: reasonConflict,
+		},
+		{
+			name:   "no pool",
+			info:   newTestInfo("ni-a", ipv4, "a"),
+			reason: reasonExhausted,
+		},
+		{
+			name:   "no pool of the address family",
+			pools:  []string{"10.0.0.0/24"},
+			info:   newTestInfo("ni-a", ipv6, "a"),
+			reason: reasonExhausted,
+		},
+		{
+			name:   "pool exhausted",
+			pools:  []string{"10.0.0.0/30"},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			info:   newTestInfo("ni-a", ipv4, "c"),
+			reason: reasonExhausted,
+		},
+		{
+			name:     "disabled pool",
+			pools:    []string{"10.0.0.0/24"},
+			disabled: []string{"10.0.0.0/24"},
+			info:     newTestInfo("ni-a", ipv4, "a"),
+			reason:   reasonDisabled,
+		},
+		{
+			name:     "enabled pool next to a disabled pool",
+			pools:    []string{"10.0.0.0/24", "10.0.1.0/24"},
+			disabled: []string{"10.0.0.0/24"},
+			info:     newTestInfo("ni-a", ipv4, "a"),
+			want:     "10.0.1.0/31",
+		},
+		{
+			name:   "no source-tag",
+			pools:  []string{"10.0.0.0/24"},
+			info:   &RegisterInfo{Namespace: testNamespace, RegistryName: testRegistry, NetworkInstanceName: "ni-a", CrName: testCrName("ni-a"), Purpose: testPurpose, AddressFamily: ipv4, Selector: map[string]string{ipamv1alpha1.KeyPurpose: testPurpose}},
+			reason: reasonInvalid,
+		},
+		{
+			name:   "unknown network instance",
+			pools:  []string{"10.0.0.0/24"},
+			info:   newTestInfo("ni-x", ipv4, "a"),
+			reason: reasonInvalid,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestHandler(t, "ni-a")
+			addTestPools(t, r, "ni-a", tc.pools...)
+			registerTest(t, r, tc.prior...)
+			for _, prefix := range tc.disabled {
+				ipp := newTestIpPrefix(prefix, prefix)
+				ipp.Spec.IpamNetworkInstanceIpPrefix.AdminState = utils.StringPtr(ipamv1alpha1.AdminStateDisable)
+				if err := r.AddIpPrefix(testCrName("ni-a"), ipp); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			p, err := r.Register(context.Background(), tc.info)
+			checkReason(t, err, tc.reason)
+			if err != nil {
+				return
+			}
+			if *p != tc.want {
+				t.Fatalf("prefix: want %s, got %s", tc.want, *p)
+			}
+			if kind := routeKind(t, r, "ni-a", *p); kind != kindAllocation {
+				t.Fatalf("route of %s: want %s, got %q", *p, kindAllocation, kind)
+			}
+		})
+	}
+}
+
+func TestDeRegister(t *testing.T) {
+	tests := []struct {
+		name   string
+		prior  []*RegisterInfo
+		info   *RegisterInfo
+		reason string
+	}{
+		{
+			name:  "own allocation",
+			prior: []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:  withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31"),
+		},
+		{
+			name:  "own ipv6 allocation",
+			prior: []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv6, "a")},
+			info:  withPrefix(newTestInfo("ni-a", ipv6, "a"), "2001:db8::/127"),
+		},
+		{
+			name:   "allocation of another owner",
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:   withPrefix(newTestInfo("ni-a", ipv4, "b"), "10.0.0.0/31"),
+			reason: reasonConflict,
+		},
+		{
+			name:   "prefix not allocated",
+			info:   withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31"),
+			reason: reasonNotFound,
+		},
+		{
+			name:   "prefix of a pool",
+			info:   withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/24"),
+			reason: reasonConflict,
+		},
+		{
+			name:   "invalid prefix",
+			info:   withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/33"),
+			reason: reasonInvalid,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestHandler(t, "ni-a")
+			addTestPools(t, r, "ni-a", "10.0.0.0/24", "2001:db8::/64")
+			registerTest(t, r, tc.prior...)
+
+			err := r.DeRegister(context.Background(), tc.info)
+			checkReason(t, err, tc.reason)
+			if err != nil {
+				return
+			}
+			if kind := routeKind(t, r, "ni-a", tc.info.IpPrefix); kind != "" {
+				t.Fatalf("route of %s: want none, got %s", tc.info.IpPrefix, kind)
+			}
+			// a released prefix cannot be released again
+			checkReason(t, r.DeRegister(context.Background(), tc.info), reasonNotFound)
+		})
+	}
+}
+
+func TestAddIpPrefix(t *testing.T) {
+	disabled := newTestIpPrefix("10.0.0.0/24", "10.0.0.0/24")
+	disabled.Spec.IpamNetworkInstanceIpPrefix.AdminState = utils.StringPtr(ipamv1alpha1.AdminStateDisable)
+
+	tests := []struct {
+		name    string
+		ni      string
+		pools   []string
+		ipp     *ipamv1alpha1.IpamNetworkInstanceIpPrefix
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "ipv4 pool",
+			ni:   "ni-a",
+			ipp:  newTestIpPrefix("10.0.0.0/24", "10.0.0.0/24"),
+			want: map[string]string{labelKind: kindPool, ipamv1alpha1.KeyPurpose: testPurpose, ipamv1alpha1.KeyAddressFamily: ipv4},
+		},
+		{
+			name: "ipv6 pool",
+			ni:   "ni-a",
+			ipp:  newTestIpPrefix("2001:db8::/64", "2001:db8::/64"),
+			want: map[string]string{labelKind: kindPool, ipamv1alpha1.KeyPurpose: testPurpose, ipamv1alpha1.KeyAddressFamily: ipv6},
+		},
+		{
+			name:  "nested pool",
+			ni:    "ni-a",
+			pools: []string{"10.0.0.0/16"},
+			ipp:   newTestIpPrefix("10.0.0.0/24", "10.0.0.0/24"),
+			want:  map[string]string{labelKind: kindPool, ipamv1alpha1.KeyAddressFamily: ipv4},
+		},
+		{
+			name:  "update of the pool",
+			ni:    "ni-a",
+			pools: []string{"10.0.0.0/24"},
+			ipp:   disabled,
+			want:  map[string]string{labelKind: kindPool, labelAdminState: ipamv1alpha1.AdminStateDisable},
+		},
+		{
+			name:    "invalid prefix",
+			ni:      "ni-a",
+			ipp:     newTestIpPrefix("10.0.0.0/33", "10.0.0.0/33"),
+			wantErr: true,
+		},
+		{
+			name:    "network instance not initialized",
+			ni:      "ni-x",
+			ipp:     newTestIpPrefix("10.0.0.0/24", "10.0.0.0/24"),
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestHandler(t, "ni-a")
+			addTestPools(t, r, "ni-a", tc.pools...)
+
+			err := r.AddIpPrefix(testCrName(tc.ni), tc.ipp)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("error: want %t, got %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			tr, _ := r.lookupTree(testCrName(tc.ni))
+			route, ok, _ := tr.routes.Get(netaddr.MustParseIPPrefix(tc.ipp.GetIpPrefix()))
+			if !ok {
+				t.Fatalf("route of %s not found", tc.ipp.GetIpPrefix())
+			}
+			for key, val := range tc.want {
+				if got := route.Get(key); got != val {
+					t.Errorf("label %s: want %s, got %q", key, val, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteIpPrefix(t *testing.T) {
+	cascade := newTestIpPrefix("10.0.0.0/24", "10.0.0.0/24")
+	cascade.Spec.IpamNetworkInstanceIpPrefix.DeletionPolicy = utils.StringPtr(ipamv1alpha1.DeletionPolicyCascade)
+
+	tests := []struct {
+		name     string
+		pools    []string
+		prior    []*RegisterInfo
+		ipp      *ipamv1alpha1.IpamNetworkInstanceIpPrefix
+		released []string
+		reason   string
+	}{
+		{
+			name:  "empty pool",
+			pools: []string{"10.0.0.0/24"},
+			ipp:   newTestIpPrefix("10.0.0.0/24", "10.0.0.0/24"),
+		},
+		{
+			name:   "pool with allocations",
+			pools:  []string{"10.0.0.0/24"},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			ipp:    newTestIpPrefix("10.0.0.0/24", "10.0.0.0/24"),
+			reason: reasonConflict,
+		},
+		{
+			name:     "pool with allocations and cascade deletion",
+			pools:    []string{"10.0.0.0/24"},
+			prior:    []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			ipp:      cascade,
+			released: []string{"10.0.0.0/31", "10.0.0.2/31"},
+		},
+		{
+			name:   "pool with nested pool and cascade deletion",
+			pools:  []string{"10.0.0.0/24", "10.0.0.0/28"},
+			ipp:    cascade,
+			reason: reasonConflict,
+		},
+		{
+			name:  "nested pool",
+			pools: []string{"10.0.0.0/16", "10.0.0.0/24"},
+			ipp:   newTestIpPrefix("10.0.0.0/24", "10.0.0.0/24"),
+		},
+		{
+			name: "pool not found",
+			ipp:  newTestIpPrefix("10.0.0.0/24", "10.0.0.0/24"),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestHandler(t, "ni-a")
+			addTestPools(t, r, "ni-a", tc.pools...)
+			registerTest(t, r, tc.prior...)
+
+			err := r.DeleteIpPrefix(testCrName("ni-a"), tc.ipp)
+			checkReason(t, err, tc.reason)
+			if err != nil {
+				if kind := routeKind(t, r, "ni-a", tc.ipp.GetIpPrefix()); kind != kindPool {
+					t.Fatalf("route of %s: want %s, got %q", tc.ipp.GetIpPrefix(), kindPool, kind)
+				}
+				return
+			}
+			for _, prefix := range append(tc.released, tc.ipp.GetIpPrefix()) {
+				if kind := routeKind(t, r, "ni-a", prefix); kind != "" {
+					t.Fatalf("route of %s: want none, got %s", prefix, kind)
+				}
+			}
+		})
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	tests := []struct {
+		name     string
+		pools    []string
+		period   time.Duration
+		prior    []*RegisterInfo
+		released []*RegisterInfo
+		// expire expires the tombstones of which the period passed before
+		// the info is registered
+		expire bool
+		after  []*RegisterInfo
+		info   *RegisterInfo
+		want   string
+		reason string
+		// routes are the kinds of the routes of the prefixes afterwards
+		routes map[string]string
+		// used and quarantined are the usage of the first pool afterwards
+		used, quarantined float64
+	}{
+		{
+			name:        "released prefix is skipped",
+			pools:       []string{"10.0.0.0/24"},
+			period:      time.Hour,
+			prior:       []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			released:    []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			info:        newTestInfo("ni-a", ipv4, "b"),
+			want:        "10.0.0.2/31",
+			routes:      map[string]string{"10.0.0.0/31": kindQuarantine, "10.0.0.2/31": kindAllocation},
+			used:        4,
+			quarantined: 2,
+		},
+		{
+			name:     "owner gets its released prefix back",
+			pools:    []string{"10.0.0.0/24"},
+			period:   time.Hour,
+			prior:    []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			released: []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			info:     newTestInfo("ni-a", ipv4, "a"),
+			want:     "10.0.0.0/31",
+			routes:   map[string]string{"10.0.0.0/31": kindAllocation},
+			used:     2,
+		},
+		{
+			name:     "allocation of the owner is preferred over its tombstone",
+			pools:    []string{"10.0.0.0/24"},
+			period:   time.Hour,
+			prior:    []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			released: []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			after:    []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.8/31")},
+			info:     newTestInfo("ni-a", ipv4, "a"),
+			want:     "10.0.0.8/31",
+			routes:   map[string]string{"10.0.0.0/31": kindQuarantine, "10.0.0.8/31": kindAllocation},
+		},
+		{
+			name:     "released prefix of another owner is a conflict",
+			pools:    []string{"10.0.0.0/24"},
+			period:   time.Hour,
+			prior:    []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			released: []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			info:     withPrefix(newTestInfo("ni-a", ipv4, "b"), "10.0.0.0/31"),
+			reason:   reasonConflict,
+			routes:   map[string]string{"10.0.0.0/31": kindQuarantine},
+		},
+		{
+			name:        "released prefixes exhaust the pool",
+			pools:       []string{"10.0.0.0/30"},
+			period:      time.Hour,
+			prior:       []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			released:    []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			info:        newTestInfo("ni-a", ipv4, "c"),
+			reason:      reasonExhausted,
+			used:        4,
+			quarantined: 2,
+		},
+		{
+			name:     "released prefix is reused without quarantine",
+			pools:    []string{"10.0.0.0/24"},
+			prior:    []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			released: []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			info:     newTestInfo("ni-a", ipv4, "b"),
+			want:     "10.0.0.0/31",
+			routes:   map[string]string{"10.0.0.0/31": kindAllocation},
+			used:     2,
+		},
+		{
+			name:     "expired prefix is reused",
+			pools:    []string{"10.0.0.0/24"},
+			period:   time.Nanosecond,
+			prior:    []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			released: []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			expire:   true,
+			info:     newTestInfo("ni-a", ipv4, "b"),
+			want:     "10.0.0.0/31",
+			routes:   map[string]string{"10.0.0.0/31": kindAllocation},
+			used:     2,
+		},
+		{
+			name:     "prefix is held until it expires",
+			pools:    []string{"10.0.0.0/24"},
+			period:   time.Hour,
+			prior:    []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			released: []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			expire:   true,
+			info:     newTestInfo("ni-a", ipv4, "b"),
+			want:     "10.0.0.2/31",
+			routes:   map[string]string{"10.0.0.0/31": kindQuarantine},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestHandler(t, "ni-a")
+			r.Quarantine(testCrName("ni-a"), tc.period)
+			addTestPools(t, r, "ni-a", tc.pools...)
+			registerTest(t, r, tc.prior...)
+			releaseTest(t, r, tc.released...)
+			if tc.expire {
+				r.Quarantine(testCrName("ni-a"), tc.period)
+			}
+			registerTest(t, r, tc.after...)
+
+			p, err := r.Register(context.Background(), tc.info)
+			checkReason(t, err, tc.reason)
+			if tc.want != "" && (p == nil || *p != tc.want) {
+				t.Errorf("want %s, got %v", tc.want, p)
+			}
+			for prefix, kind := range tc.routes {
+				if got := routeKind(t, r, "ni-a", prefix); got != kind {
+					t.Errorf("route of %s: want %q, got %q", prefix, kind, got)
+				}
+			}
+			if tc.used == 0 {
+				return
+			}
+			u, err := r.GetPoolUsage(testCrName("ni-a"), tc.pools[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Used != tc.used || u.Quarantined != tc.quarantined {
+				t.Errorf("usage: want %v used %v quarantined, got %v used %v quarantined", tc.used, tc.quarantined, u.Used, u.Quarantined)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		prior    []*RegisterInfo
+		released []*RegisterInfo
+		deleted  []string
+		filter   *WatchFilter
+		want     []string
+	}{
+		{
+			name:   "allocations of the namespace",
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-b", ipv4, "b")},
+			filter: &WatchFilter{Namespace: testNamespace},
+			want:   []string{testCrName("ni-a") + "/10.0.0.0/31", testCrName("ni-b") + "/10.0.0.0/31"},
+		},
+		{
+			name:   "allocations of the network instance",
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-b", ipv4, "b")},
+			filter: &WatchFilter{Namespace: testNamespace, CrName: testCrName("ni-b")},
+			want:   []string{testCrName("ni-b") + "/10.0.0.0/31"},
+		},
+		{
+			name:   "allocations of another namespace",
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			filter: &WatchFilter{Namespace: "other"},
+		},
+		{
+			name:     "released allocation",
+			prior:    []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			released: []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			filter:   &WatchFilter{Namespace: testNamespace},
+			want:     []string{testCrName("ni-a") + "/10.0.0.2/31"},
+		},
+		{
+			name:    "deleted network instance",
+			prior:   []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-b", ipv4, "b")},
+			deleted: []string{"ni-a"},
+			filter:  &WatchFilter{Namespace: testNamespace},
+			want:    []string{testCrName("ni-b") + "/10.0.0.0/31"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestHandler(t, "ni-a", "ni-b")
+			addTestPools(t, r, "ni-a", "10.0.0.0/24")
+			addTestPools(t, r, "ni-b", "10.0.0.0/24")
+			registerTest(t, r, tc.prior...)
+			releaseTest(t, r, tc.released...)
+			for _, ni := range tc.deleted {
+				r.Delete(testCrName(ni))
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, _, err := r.Watch(ctx, tc.filter, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last := events[len(events)-1]; last.Kind != EventSynced {
+				t.Fatalf("last event: want %s, got %s", EventSynced, last.Kind)
+			}
+			got := make([]string, 0, len(events)-1)
+			for _, e := range events[:len(events)-1] {
+				got = append(got, e.CrName+"/"+e.Prefix)
+			}
+			sort.Strings(got)
+			if len(got) != len(tc.want) || (len(got) > 0 && !reflect.DeepEqual(got, tc.want)) {
+				t.Errorf("snapshot: want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+// withExpression moves the key from the selector of the info to an In
+// match-expression with the values
+func withExpression(info *RegisterInfo, key string, values ...string) *RegisterInfo {
+	delete(info.Selector, key)
+	switch key {
+	case ipamv1alpha1.KeyPurpose:
+		info.Purpose = ""
+	case ipamv1alpha1.KeyAddressFamily:
+		info.AddressFamily = ""
+	}
+	info.MatchExpressions = append(info.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      key,
+		Operator: metav1.LabelSelectorOpIn,
+		Values:   values,
+	})
+	return info
+}
+
+func TestRegisterExpression(t *testing.T) {
+	tests := []struct {
+		name   string
+		pools  []string
+		quotas []*ipamv1alpha1.IpamQuota
+		prior  []*RegisterInfo
+		info   *RegisterInfo
+		want   string
+		reason string
+		// purpose and af are the labels of the allocation
+		purpose, af string
+	}{
+		{
+			name:    "purpose of the pool",
+			pools:   []string{"10.0.0.0/24"},
+			info:    withExpression(newTestInfo("ni-a", ipv4, "a"), ipamv1alpha1.KeyPurpose, "p2p", testPurpose),
+			want:    "10.0.0.0/31",
+			purpose: testPurpose,
+			af:      ipv4,
+		},
+		{
+			name:    "address-family of the pool",
+			pools:   []string{"2001:db8::/64"},
+			info:    withExpression(newTestInfo("ni-a", ipv4, "a"), ipamv1alpha1.KeyAddressFamily, ipv4, ipv6),
+			want:    "2001:db8::/127",
+			purpose: testPurpose,
+			af:      ipv6,
+		},
+		{
+			name:    "existing allocation of the owner",
+			pools:   []string{"10.0.0.0/24"},
+			prior:   []*RegisterInfo{withExpression(newTestInfo("ni-a", ipv4, "a"), ipamv1alpha1.KeyPurpose, testPurpose), newTestInfo("ni-a", ipv4, "b")},
+			info:    withExpression(newTestInfo("ni-a", ipv4, "a"), ipamv1alpha1.KeyPurpose, testPurpose),
+			want:    "10.0.0.0/31",
+			purpose: testPurpose,
+			af:      ipv4,
+		},
+		{
+			name:    "explicit prefix",
+			pools:   []string{"10.0.0.0/24"},
+			info:    withPrefix(withExpression(newTestInfo("ni-a", ipv4, "a"), ipamv1alpha1.KeyPurpose, testPurpose), "10.0.0.8/31"),
+			want:    "10.0.0.8/31",
+			purpose: testPurpose,
+			af:      ipv4,
+		},
+		{
+			name:   "quota of the purpose of the pool",
+			pools:  []string{"10.0.0.0/24"},
+			quotas: []*ipamv1alpha1.IpamQuota{newTestQuota("isl", testPurpose, 1)},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "b")},
+			info:   withExpression(newTestInfo("ni-a", ipv4, "a"), ipamv1alpha1.KeyPurpose, "p2p", testPurpose),
+			reason: reasonQuota,
+		},
+		{
+			name:   "no pool of the purposes",
+			pools:  []string{"10.0.0.0/24"},
+			info:   withExpression(newTestInfo("ni-a", ipv4, "a"), ipamv1alpha1.KeyPurpose, "p2p"),
+			reason: reasonExhausted,
+		},
+		{
+			name:   "purpose not provided",
+			pools:  []string{"10.0.0.0/24"},
+			info:   withExpression(newTestInfo("ni-a", ipv4, "a"), ipamv1alpha1.KeyPurpose),
+			reason: reasonInvalid,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestHandler(t, "ni-a")
+			addTestPools(t, r, "ni-a", tc.pools...)
+			registerTest(t, r, tc.prior...)
+			for _, q := range tc.quotas {
+				if err := r.SetQuota(q); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			p, err := r.Register(context.Background(), tc.info)
+			checkReason(t, err, tc.reason)
+			if err != nil {
+				return
+			}
+			if *p != tc.want {
+				t.Fatalf("want %s, got %s", tc.want, *p)
+			}
+			tr, _ := r.lookupTree(testCrName("ni-a"))
+			l := routeLabels(tr.routes, *p)
+			if l[ipamv1alpha1.KeyPurpose] != tc.purpose || l[ipamv1alpha1.KeyAddressFamily] != tc.af {
+				t.Errorf("labels: want %s %s, got %v", tc.purpose, tc.af, l)
+			}
+			// the allocation is owned by the info
+			releaseTest(t, r, withPrefix(tc.info, *p))
+			if kind := routeKind(t, r, "ni-a", *p); kind != "" {
+				t.Errorf("route of %s: want released, got %q", *p, kind)
+			}
+		})
+	}
+}
+
+// withRequestId returns the info with the idempotency key
+func withRequestId(info *RegisterInfo, id string) *RegisterInfo {
+	info.RequestId = id
+	return info
+}
+
+func TestRegisterIdempotency(t *testing.T) {
+	upper := withRequestId(newTestInfo("ni-a", ipv4, "a"), "req-1")
+	upper.SourceTag = map[string]string{"client": " A "}
+
+	tests := []struct {
+		name     string
+		prior    []*RegisterInfo
+		released []*RegisterInfo
+		after    []*RegisterInfo
+		// forget drops the recorded requests, like a restart of the handler
+		forget bool
+		info   *RegisterInfo
+		want   string
+		reason string
+	}{
+		{
+			name:  "same id and request",
+			prior: []*RegisterInfo{withRequestId(newTestInfo("ni-a", ipv4, "a"), "req-1"), newTestInfo("ni-a", ipv4, "b")},
+			info:  withRequestId(newTestInfo("ni-a", ipv4, "a"), "req-1"),
+			want:  "10.0.0.0/31",
+		},
+		{
+			name:  "same id and normalized request",
+			prior: []*RegisterInfo{withRequestId(newTestInfo("ni-a", ipv4, "a"), "req-1")},
+			info:  upper,
+			want:  "10.0.0.0/31",
+		},
+		{
+			name:   "same id and another request",
+			prior:  []*RegisterInfo{withRequestId(newTestInfo("ni-a", ipv4, "a"), "req-1")},
+			info:   withRequestId(newTestInfo("ni-a", ipv4, "b"), "req-1"),
+			reason: reasonConflict,
+		},
+		{
+			name:   "same id and another prefix",
+			prior:  []*RegisterInfo{withRequestId(newTestInfo("ni-a", ipv4, "a"), "req-1")},
+			info:   withPrefix(withRequestId(newTestInfo("ni-a", ipv4, "a"), "req-1"), "10.0.0.8/31"),
+			reason: reasonConflict,
+		},
+		{
+			name:   "same id after a restart",
+			prior:  []*RegisterInfo{withRequestId(newTestInfo("ni-a", ipv4, "a"), "req-1")},
+			forget: true,
+			info:   withRequestId(newTestInfo("ni-a", ipv4, "b"), "req-1"),
+			reason: reasonConflict,
+		},
+		{
+			name:     "replay after release",
+			prior:    []*RegisterInfo{withRequestId(newTestInfo("ni-a", ipv4, "a"), "req-1")},
+			released: []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			after:    []*RegisterInfo{newTestInfo("ni-a", ipv4, "b")},
+			info:     withRequestId(newTestInfo("ni-a", ipv4, "a"), "req-1"),
+			want:     "10.0.0.2/31",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestHandler(t, "ni-a")
+			addTestPools(t, r, "ni-a", "10.0.0.0/24")
+			registerTest(t, r, tc.prior...)
+			releaseTest(t, r, tc.released...)
+			registerTest(t, r, tc.after...)
+			if tc.forget {
+				r.requestMutex.Lock()
+				r.requests = make(map[string]map[string]*request)
+				r.requestMutex.Unlock()
+			}
+
+			p, err := r.Register(context.Background(), tc.info)
+			checkReason(t, err, tc.reason)
+			if err != nil {
+				return
+			}
+			if *p != tc.want {
+				t.Fatalf("want %s, got %s", tc.want, *p)
+			}
+			if kind := routeKind(t, r, "ni-a", *p); kind != kindAllocation {
+				t.Errorf("route of %s: want %q, got %q", *p, kindAllocation, kind)
+			}
+		})
+	}
+}
+
+// newTestQuota returns a quota of the namespace limiting the allocations of
+// the purpose, an empty purpose applies to all purposes
+func newTestQuota(name, purpose string, maxAllocations uint32) *ipamv1alpha1.IpamQuota {
+	q := &ipamv1alpha1.IpamQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: ipamv1alpha1.IpamQuotaSpec{
+			Quota: &ipamv1alpha1.IpamIpamQuota{MaxAllocations: utils.Uint32Ptr(maxAllocations)},
+		},
+	}
+	if purpose != "" {
+		q.Spec.Quota.Purpose = utils.StringPtr(purpose)
+	}
+	return q
+}
+
+func TestRegisterExpand(t *testing.T) {
+	tests := []struct {
+		name   string
+		ipps   []*ipamv1alpha1.IpamNetworkInstanceIpPrefix
+		quotas []*ipamv1alpha1.IpamQuota
+		prior  []*RegisterInfo
+		info   *RegisterInfo
+		want   string
+		reason string
+		// expansions are the expansions of the pool afterwards
+		expansions []string
+		notified   int
+	}{
+		{
+			name: "exhausted pool is expanded",
+			ipps: []*ipamv1alpha1.IpamNetworkInstanceIpPrefix{
+				newTestAggregate("10.1.0.0/16"),
+				withAutoExpand(newTestIpPrefix("isl", "10.0.0.0/30"), 30, 1),
+			},
+			prior:      []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			info:       newTestInfo("ni-a", ipv4, "c"),
+			want:       "10.1.0.0/31",
+			expansions: []string{"isl-expand-1"},
+			notified:   1,
+		},
+		{
+			name: "expansion is used before expanding again",
+			ipps: []*ipamv1alpha1.IpamNetworkInstanceIpPrefix{
+				newTestAggregate("10.1.0.0/16"),
+				withAutoExpand(newTestIpPrefix("isl", "10.0.0.0/30"), 30, 2),
+			},
+			prior:      []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b"), newTestInfo("ni-a", ipv4, "c")},
+			info:       newTestInfo("ni-a", ipv4, "d"),
+			want:       "10.1.0.2/31",
+			expansions: []string{"isl-expand-1"},
+		},
+		{
+			name: "maximum expansions reached",
+			ipps: []*ipamv1alpha1.IpamNetworkInstanceIpPrefix{
+				newTestAggregate("10.1.0.0/16"),
+				withAutoExpand(newTestIpPrefix("isl", "10.0.0.0/30"), 30, 1),
+			},
+			prior: []*RegisterInfo{
+				newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b"),
+				newTestInfo("ni-a", ipv4, "c"), newTestInfo("ni-a", ipv4, "d"),
+			},
+			info:       newTestInfo("ni-a", ipv4, "e"),
+			reason:     reasonExhausted,
+			expansions: []string{"isl-expand-1"},
+		},
+		{
+			name:   "pool without auto-expand",
+			ipps:   []*ipamv1alpha1.IpamNetworkInstanceIpPrefix{newTestAggregate("10.1.0.0/16"), newTestIpPrefix("isl", "10.0.0.0/30")},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			info:   newTestInfo("ni-a", ipv4, "c"),
+			reason: reasonExhausted,
+		},
+		{
+			name: "expansion is discarded when the quota is exceeded",
+			ipps: []*ipamv1alpha1.IpamNetworkInstanceIpPrefix{
+				newTestAggregate("10.1.0.0/16"),
+				withAutoExpand(newTestIpPrefix("isl", "10.0.0.0/30"), 30, 1),
+			},
+			quotas: []*ipamv1alpha1.IpamQuota{newTestQuota("isl", testPurpose, 2)},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			info:   newTestInfo("ni-a", ipv4, "c"),
+			reason: reasonQuota,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestHandler(t, "ni-a")
+			addTestIpPrefixes(t, r, "ni-a", tc.ipps...)
+			registerTest(t, r, tc.prior...)
+			for _, q := range tc.quotas {
+				if err := r.SetQuota(q); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var notified int
+			r.AddExpansionFn(func(string, types.NamespacedName) { notified++ })
+
+			p, err := r.Register(context.Background(), tc.info)
+			checkReason(t, err, tc.reason)
+			if tc.want != "" && (p == nil || *p != tc.want) {
+				t.Errorf("want %s, got %v", tc.want, p)
+			}
+			if got := r.GetExpansions(testCrName("ni-a"), "isl"); len(got) != len(tc.expansions) || (len(got) > 0 && !reflect.DeepEqual(got, tc.expansions)) {
+				t.Errorf("expansions: want %v, got %v", tc.expansions, got)
+			}
+			if notified != tc.notified {
+				t.Errorf("expansions notified: want %d, got %d", tc.notified, notified)
+			}
+		})
+	}
+}
+
+// withMaxAddresses returns the quota limiting the addresses of the allocations
+func withMaxAddresses(q *ipamv1alpha1.IpamQuota, max uint64) *ipamv1alpha1.IpamQuota {
+	q.Spec.Quota.MaxAddresses = &max
+	return q
+}
+
+// withQuotaTag returns the quota limited to the allocations with the source-tag
+func withQuotaTag(q *ipamv1alpha1.IpamQuota, key, val string) *ipamv1alpha1.IpamQuota {
+	q.Spec.Quota.SourceTag = append(q.Spec.Quota.SourceTag, &nddov1.Tag{Key: utils.StringPtr(key), Value: utils.StringPtr(val)})
+	return q
+}
+
+// withQuotaNamespace returns the quota in the namespace
+func withQuotaNamespace(q *ipamv1alpha1.IpamQuota, namespace string) *ipamv1alpha1.IpamQuota {
+	q.Namespace = namespace
+	return q
+}
+
+func TestQuota(t *testing.T) {
+	ipv4 := string(ipamv1alpha1.AddressFamilyIpv4)
+	tests := []struct {
+		name   string
+		quotas []*ipamv1alpha1.IpamQuota
+		prior  []*RegisterInfo
+		info   *RegisterInfo
+		reason string
+		// usage is the usage of the first quota afterwards
+		usage QuotaUsage
+	}{
+		{
+			name:   "below max-allocations",
+			quotas: []*ipamv1alpha1.IpamQuota{newTestQuota("isl", testPurpose, 2)},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:   newTestInfo("ni-a", ipv4, "b"),
+			usage:  QuotaUsage{Allocations: 2, Addresses: 4},
+		},
+		{
+			name:   "max-allocations reached",
+			quotas: []*ipamv1alpha1.IpamQuota{newTestQuota("isl", testPurpose, 1)},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:   newTestInfo("ni-a", ipv4, "b"),
+			reason: reasonQuota,
+			usage:  QuotaUsage{Allocations: 1, Addresses: 2},
+		},
+		{
+			name:   "max-addresses reached",
+			quotas: []*ipamv1alpha1.IpamQuota{withMaxAddresses(newTestQuota("isl", testPurpose, 10), 4)},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-a", ipv4, "b")},
+			info:   newTestInfo("ni-a", ipv4, "c"),
+			reason: reasonQuota,
+			usage:  QuotaUsage{Allocations: 2, Addresses: 4},
+		},
+		{
+			name:   "existing allocation is not counted again",
+			quotas: []*ipamv1alpha1.IpamQuota{newTestQuota("isl", testPurpose, 1)},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:   newTestInfo("ni-a", ipv4, "a"),
+			usage:  QuotaUsage{Allocations: 1, Addresses: 2},
+		},
+		{
+			name:   "quota of another namespace",
+			quotas: []*ipamv1alpha1.IpamQuota{withQuotaNamespace(newTestQuota("isl", testPurpose, 1), "other")},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:   newTestInfo("ni-a", ipv4, "b"),
+		},
+		{
+			name:   "quota of another purpose",
+			quotas: []*ipamv1alpha1.IpamQuota{newTestQuota("loopback", "loopback", 1)},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:   newTestInfo("ni-a", ipv4, "b"),
+		},
+		{
+			name:   "quota of all purposes",
+			quotas: []*ipamv1alpha1.IpamQuota{newTestQuota("all", "", 1)},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:   newTestInfo("ni-a", ipv4, "b"),
+			reason: reasonQuota,
+			usage:  QuotaUsage{Allocations: 1, Addresses: 2},
+		},
+		{
+			name:   "quota of the source-tag",
+			quotas: []*ipamv1alpha1.IpamQuota{withQuotaTag(newTestQuota("client-a", "", 1), "client", "a")},
+			prior:  []*RegisterInfo{withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.0/31")},
+			info:   withPrefix(newTestInfo("ni-a", ipv4, "a"), "10.0.0.2/31"),
+			reason: reasonQuota,
+			usage:  QuotaUsage{Allocations: 1, Addresses: 2},
+		},
+		{
+			name:   "quota of another source-tag",
+			quotas: []*ipamv1alpha1.IpamQuota{withQuotaTag(newTestQuota("client-a", "", 1), "client", "a")},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:   newTestInfo("ni-a", ipv4, "b"),
+			usage:  QuotaUsage{Allocations: 1, Addresses: 2},
+		},
+		{
+			name:   "allocations of another network instance of the namespace",
+			quotas: []*ipamv1alpha1.IpamQuota{newTestQuota("isl", testPurpose, 1)},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a")},
+			info:   newTestInfo("ni-b", ipv4, "b"),
+			reason: reasonQuota,
+			usage:  QuotaUsage{Allocations: 1, Addresses: 2},
+		},
+		{
+			name:   "allocations of several network instances of the namespace",
+			quotas: []*ipamv1alpha1.IpamQuota{newTestQuota("isl", testPurpose, 3)},
+			prior:  []*RegisterInfo{newTestInfo("ni-a", ipv4, "a"), newTestInfo("ni-b", ipv4, "b")},
+			info:   newTestInfo("ni-b", ipv4, "c"),
+			usage:  QuotaUsage{Allocations: 3, Addresses: 6},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestHandler(t, "ni-a", "ni-b")
+			addTestPools(t, r, "ni-a", "10.0.0.0/24")
+			addTestPools(t, r, "ni-b", "10.1.0.0/24")
+			registerTest(t, r, tc.prior...)
+			for _, q := range tc.quotas {
+				if err := r.SetQuota(q); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := r.Register(context.Background(), tc.info)
+			checkReason(t, err, tc.reason)
+
+			q := tc.quotas[0]
+			u, err := r.GetQuotaUsage(q.GetNamespace(), q.GetName())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *u != tc.usage {
+				t.Errorf("usage of quota %s: got %+v, want %+v", q.GetName(), *u, tc.usage)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+
+	"github.com/hansthienpondt/goipam/pkg/table"
+	"github.com/pkg/errors"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"inet.af/netaddr"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// labelCarvedFor is set on a pool carved out of a parent pool, it holds the
+// name of the ip prefix the pool was carved for
+const labelCarvedFor = "ipam.nddr.yndd.io/carved-for"
+
+// PoolHierarchy is the position of a pool in the iptree
+type PoolHierarchy struct {
+	// Parent is the most specific pool the pool is part of, it is empty for a
+	// top level pool
+	Parent string
+	// Children are the pools that are directly part of the pool
+	Children []string
+}
+
+// CarveIpPrefix allocates the prefix of an ip prefix that requests it from a
+// parent pool, the prefix is carved out of the first available pool matching
+// the parent selector that has room for it and added to the iptree as a pool.
+// An ip prefix that was carved before keeps its prefix.
+func (r *handler) CarveIpPrefix(crName string, cr ipamv1alpha1.Ipp) (string, error) {
+	if p := cr.GetIpPrefix(); p != "" {
+		// the prefix is added back by AddIpPrefix when the iptree was rebuilt
+		return p, nil
+	}
+	t, ok := r.lookupTree(crName)
+	if !ok {
+		return "", withReason(reasonNotReady, errors.New("ipam ni not ready"))
+	}
+
+	r.lockTree(opCarveIpPrefix, t)
+	defer t.Unlock()
+	for _, pool := range t.routes.GetTable() {
+		// the status update of an earlier carve failed or the pool was
+		// carved while expanding a pool in an allocation
+		if pool.Get(labelKind) == kindPool && pool.Get(labelCarvedFor) == cr.GetName() {
+			return pool.IPPrefix().String(), nil
+		}
+	}
+
+	p, err := carve(t.routes, cr.GetParentSelector(), cr.GetParentPrefixLength())
+	if err != nil {
+		return "", err
+	}
+	af := string(ipamv1alpha1.AddressFamilyIpv4)
+	if p.IP().Is6() {
+		af = string(ipamv1alpha1.AddressFamilyIpv6)
+	}
+	route := table.NewRoute(p)
+	route.UpdateLabel(ipPrefixLabels(cr, af))
+	if err := t.routes.Add(route); err != nil {
+		return "", withReason(reasonInsert, errors.Wrap(err, "route insertion failed"))
+	}
+	r.log.Debug("carved ip prefix", "prefix", p)
+	return p.String(), nil
+}
+
+// carve returns a free prefix with the bits in the first available pool
+// matching the selector that has room for it
+func carve(iptree *table.RouteTable, parentSelector map[string]string, bits uint32) (netaddr.IPPrefix, error) {
+	selector := labels.NewSelector()
+	for key, val := range parentSelector {
+		req, err := labels.NewRequirement(key, selection.In, []string{val})
+		if err != nil {
+			return netaddr.IPPrefix{}, withReason(reasonInvalid, errors.Wrap(err, "wrong parent selector"))
+		}
+		selector = selector.Add(*req)
+	}
+	req, err := labels.NewRequirement(labelKind, selection.In, []string{kindPool})
+	if err != nil {
+		return netaddr.IPPrefix{}, err
+	}
+	selector = selector.Add(*req)
+
+	parents := availablePools(iptree.GetByLabel(selector))
+	if len(parents) == 0 {
+		return netaddr.IPPrefix{}, withReason(reasonExhausted, errors.New("no available parent pools"))
+	}
+	for _, parent := range parents {
+		pp := parent.IPPrefix()
+		if bits <= uint32(pp.Bits()) || bits > uint32(pp.IP().BitLen()) {
+			continue
+		}
+		if p, ok := iptree.FindFreePrefix(pp, uint8(bits)); ok {
+			return p, nil
+		}
+	}
+	return netaddr.IPPrefix{}, withReason(reasonExhausted, fmt.Errorf("no parent pool has room for a /%d", bits))
+}
+
+// GetPoolHierarchy returns the parent pool and the child pools of the pool of
+// the prefix in the iptree of the network instance
+func (r *handler) GetPoolHierarchy(crName, prefix string) (*PoolHierarchy, error) {
+	p, err := netaddr.ParseIPPrefix(prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseIPPrefix failed")
+	}
+	t, ok := r.lookupTree(crName)
+	if !ok {
+		return nil, withReason(reasonNotReady, fmt.Errorf("pool/tree not ready, crName: %s", crName))
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	h := &PoolHierarchy{}
+	var parent *table.Route
+	for _, route := range t.routes.Parents(p) {
+		if route.Get(labelKind) == kindPool && (parent == nil || route.IPPrefix().Bits() > parent.IPPrefix().Bits()) {
+			parent = route
+		}
+	}
+	if parent != nil {
+		h.Parent = parent.IPPrefix().String()
+	}
+	children := childPools(t.routes, p)
+	for _, child := range children {
+		if !covered(child, children) {
+			h.Children = append(h.Children, child.IPPrefix().String())
+		}
+	}
+	return h, nil
+}
+
+// childPools returns the pools that are part of the prefix
+func childPools(iptree *table.RouteTable, p netaddr.IPPrefix) table.Routes {
+	pools := make(table.Routes, 0)
+	for _, child := range iptree.Children(p) {
+		if child.Get(labelKind) == kindPool {
+			pools = append(pools, child)
+		}
+	}
+	return pools
+}
+
+// covered reports if the route is part of one of the pools
+func covered(route *table.Route, pools table.Routes) bool {
+	for _, pool := range pools {
+		if pool.IPPrefix().Bits() < route.IPPrefix().Bits() && pool.IPPrefix().Contains(route.IPPrefix().IP()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hansthienpondt/goipam/pkg/table"
+	"inet.af/netaddr"
+)
+
+const (
+	// labelRequestId and labelRequestHash are set on an allocation made for a
+	// request with an idempotency key, such that the requests are rebuilt from
+	// the iptree after a restart
+	labelRequestId   = "ipam.nddr.yndd.io/request-id"
+	labelRequestHash = "ipam.nddr.yndd.io/request-hash"
+)
+
+// request is the allocation recorded for an idempotency key
+type request struct {
+	fingerprint string
+	prefix      string
+}
+
+// getRequest returns the prefix that was allocated before for the request id
+// of the info. A request id that was used for a different request results in
+// a conflict error, an allocation that no longer exists in the tree is forgotten.
+func (r *handler) getRequest(info *RegisterInfo, iptree *table.RouteTable) (string, bool, error) {
+	if info.RequestId == "" {
+		return "", false, nil
+	}
+	r.requestMutex.Lock()
+	defer r.requestMutex.Unlock()
+	req, ok := r.requests[info.CrName][info.RequestId]
+	if !ok {
+		// the allocation can be added to the iptree after it was loaded
+		if req, ok = lookupRequest(iptree, info.RequestId); !ok {
+			return "", false, nil
+		}
+		r.setRequest(info.CrName, info.RequestId, req)
+	}
+	if req.fingerprint != fingerprint(info) {
+		return "", false, withReason(reasonConflict, fmt.Errorf("request id %s conflicts with a previous request", info.RequestId))
+	}
+	p, err := netaddr.ParseIPPrefix(req.prefix)
+	if err != nil {
+		return "", false, err
+	}
+	if route, ok, _ := iptree.Get(p); !ok || route.Get(labelKind) != kindAllocation {
+		delete(r.requests[info.CrName], info.RequestId)
+		return "", false, nil
+	}
+	return req.prefix, true, nil
+}
+
+// recordRequest records the prefix allocated for the request id of the info
+func (r *handler) recordRequest(info *RegisterInfo, prefix string) {
+	if info.RequestId == "" {
+		return
+	}
+	r.requestMutex.Lock()
+	defer r.requestMutex.Unlock()
+	r.setRequest(info.CrName, info.RequestId, &request{
+		fingerprint: fingerprint(info),
+		prefix:      prefix,
+	})
+}
+
+func (r *handler) setRequest(crName, id string, req *request) {
+	if _, ok := r.requests[crName]; !ok {
+		r.requests[crName] = make(map[string]*request)
+	}
+	r.requests[crName][id] = req
+}
+
+// loadRequests rebuilds the requests of the iptree from the labels of its
+// allocations
+func (r *handler) loadRequests(crName string, iptree *table.RouteTable) {
+	r.requestMutex.Lock()
+	defer r.requestMutex.Unlock()
+	delete(r.requests, crName)
+	for _, route := range iptree.GetTable() {
+		if id := route.Get(labelRequestId); id != "" && route.Get(labelKind) == kindAllocation {
+			r.setRequest(crName, id, &request{fingerprint: route.Get(labelRequestHash), prefix: route.String()})
+		}
+	}
+}
+
+// lookupRequest returns the request of the allocation in the iptree with the
+// request id
+func lookupRequest(iptree *table.RouteTable, id string) (*request, bool) {
+	for _, route := range iptree.GetTable() {
+		if route.Get(labelRequestId) == id && route.Get(labelKind) == kindAllocation {
+			return &request{fingerprint: route.Get(labelRequestHash), prefix: route.String()}, true
+		}
+	}
+	return nil, false
+}
+
+// forgetRequests removes the request ids that point to a released prefix
+func (r *handler) forgetRequests(crName, prefix string) {
+	r.requestMutex.Lock()
+	defer r.requestMutex.Unlock()
+	for id, req := range r.requests[crName] {
+		if req.prefix == prefix {
+			delete(r.requests[crName], id)
+		}
+	}
+}
+
+// requestLabels adds the request id and fingerprint of the info to the labels
+// of its allocation
+func requestLabels(info *RegisterInfo, l map[string]string) {
+	if info.RequestId == "" {
+		return
+	}
+	l[labelRequestId] = info.RequestId
+	l[labelRequestHash] = fingerprint(info)
+}
+
+// withoutRequest returns the labels without the request id and fingerprint
+func withoutRequest(l map[string]string) map[string]string {
+	c := make(map[string]string, len(l))
+	for key, val := range l {
+		if key != labelRequestId && key != labelRequestHash {
+			c[key] = val
+		}
+	}
+	return c
+}
+
+// fingerprint identifies what is requested and by whom independent of the
+// normalization of the tags, such that a request id reused by another owner
+// conflicts. It is a hash to fit in the labels of the allocation.
+func fingerprint(info *RegisterInfo) string {
+	s := make([]string, 0, len(info.Selector)+len(info.SourceTag)+1)
+	for key, val := range info.Selector {
+		s = append(s, "selector:"+normalize(key)+"="+normalize(val))
+	}
+	for key, val := range info.SourceTag {
+		s = append(s, "source-tag:"+normalize(key)+"="+normalize(val))
+	}
+	sort.Strings(s)
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(append(s, normalize(info.IpPrefix)), ",")))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "nddr_ipam"
+
+	// failure reasons
+	reasonNotReady  = "not-ready"
+	reasonInvalid   = "invalid"
+	reasonExhausted = "exhausted"
+	reasonConfig    = "config"
+	reasonConflict  = "conflict"
+	reasonInsert    = "insert-failed"
+	reasonNotFound  = "not-found"
+	reasonDisabled  = "disabled"
+	reasonQuota     = "quota-exceeded"
+	reasonUnknown   = "unknown"
+
+	// operations
+	opRegister       = "register"
+	opDeRegister     = "deregister"
+	opReallocate     = "reallocate"
+	opBulk           = "bulk"
+	opAddIpPrefix    = "add-ip-prefix"
+	opDeleteIpPrefix = "delete-ip-prefix"
+	opLoad           = "load"
+	opCarveIpPrefix  = "carve-ip-prefix"
+	opExpire         = "expire"
+	opQuota          = "quota"
+)
+
+// reasonError annotates an error with the reason reported in the failure metric
+type reasonError struct {
+	reason string
+	error
+}
+
+func (e *reasonError) Unwrap() error { return e.error }
+
+func withReason(reason string, err error) error {
+	return &reasonError{reason: reason, error: err}
+}
+
+// IsNotFound reports if the error is caused by a prefix that is not allocated
+func IsNotFound(err error) bool {
+	return reasonOf(err) == reasonNotFound
+}
+
+func reasonOf(err error) string {
+	var re *reasonError
+	if errors.As(err, &re) {
+		return re.reason
+	}
+	return reasonUnknown
+}
+
+type metrics struct {
+	allocations      *prometheus.CounterVec
+	releases         *prometheus.CounterVec
+	failures         *prometheus.CounterVec
+	registerDuration prometheus.Histogram
+	lockWait         *prometheus.HistogramVec
+	pools            *poolCollector
+}
+
+func newMetrics(r *handler) *metrics {
+	return &metrics{
+		allocations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "allocations_total",
+			Help:      "Number of prefixes allocated per network instance.",
+		}, []string{"network_instance", "purpose", "address_family"}),
+		releases: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "releases_total",
+			Help:      "Number of prefixes released per network instance.",
+		}, []string{"network_instance"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "failures_total",
+			Help:      "Number of failed allocations and releases per network instance by reason.",
+		}, []string{"network_instance", "operation", "reason"}),
+		registerDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "register_duration_seconds",
+			Help:      "Latency of the allocation of a prefix.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}),
+		lockWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "tree_lock_wait_seconds",
+			Help:      "Time spent waiting for the iptree lock.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 12),
+		}, []string{"operation"}),
+		pools: &poolCollector{handler: r},
+	}
+}
+
+func (m *metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.allocations, m.releases, m.failures, m.registerDuration, m.lockWait, m.pools}
+}
+
+func (m *metrics) observeRegister(info *RegisterInfo, start time.Time, added bool, err error) {
+	m.registerDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.failures.WithLabelValues(info.CrName, opRegister, reasonOf(err)).Inc()
+		return
+	}
+	if added {
+		m.allocations.WithLabelValues(info.CrName, info.Purpose, info.AddressFamily).Inc()
+	}
+}
+
+func (m *metrics) observeDeRegister(info *RegisterInfo, err error) {
+	if err != nil {
+		m.failures.WithLabelValues(info.CrName, opDeRegister, reasonOf(err)).Inc()
+		return
+	}
+	m.releases.WithLabelValues(info.CrName).Inc()
+}
+
+func (m *metrics) observeReallocate(info *RegisterInfo, released, added bool, err error) {
+	if err != nil {
+		m.failures.WithLabelValues(info.CrName, opReallocate, reasonOf(err)).Inc()
+		return
+	}
+	if released {
+		m.releases.WithLabelValues(info.CrName).Inc()
+	}
+	if added {
+		m.allocations.WithLabelValues(info.CrName, info.Purpose, info.AddressFamily).Inc()
+	}
+}
+
+var (
+	poolLabels              = []string{"network_instance", "prefix", "purpose", "address_family"}
+	networkInstanceLabels   = []string{"network_instance", "address_family"}
+	descPoolSize            = prometheus.NewDesc(metricsNamespace+"_prefix_size_addresses", "Number of addresses of a pool.", poolLabels, nil)
+	descPoolUsed            = prometheus.NewDesc(metricsNamespace+"_prefix_used_addresses", "Number of addresses allocated from a pool.", poolLabels, nil)
+	descPoolFree            = prometheus.NewDesc(metricsNamespace+"_prefix_free_addresses", "Number of addresses available in a pool.", poolLabels, nil)
+	descPoolQuarantined     = prometheus.NewDesc(metricsNamespace+"_prefix_quarantined_addresses", "Number of used addresses of a pool held in quarantine.", poolLabels, nil)
+	descNetworkInstanceSize = prometheus.NewDesc(metricsNamespace+"_network_instance_size_addresses", "Number of addresses of the pools of a network instance.", networkInstanceLabels, nil)
+	descNetworkInstanceUsed = prometheus.NewDesc(metricsNamespace+"_network_instance_used_addresses", "Number of addresses allocated in a network instance.", networkInstanceLabels, nil)
+	descNetworkInstanceFree = prometheus.NewDesc(metricsNamespace+"_network_instance_free_addresses", "Number of addresses available in a network instance.", networkInstanceLabels, nil)
+)
+
+// poolCollector reports the utilisation of the pools when the metrics are
+// scraped, such that deleted pools and network instances disappear
+type poolCollector struct {
+	handler *handler
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{descPoolSize, descPoolUsed, descPoolFree, descPoolQuarantined, descNetworkInstanceSize, descNetworkInstanceUsed, descNetworkInstanceFree} {
+		ch <- d
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	for crName, usages := range c.handler.getUsage() {
+		size := make(map[string]float64)
+		used := make(map[string]float64)
+		for _, u := range usages {
+			ch <- prometheus.MustNewConstMetric(descPoolSize, prometheus.GaugeValue, u.Size, crName, u.Prefix, u.Purpose, u.AddressFamily)
+			ch <- prometheus.MustNewConstMetric(descPoolUsed, prometheus.GaugeValue, u.Used, crName, u.Prefix, u.Purpose, u.AddressFamily)
+			ch <- prometheus.MustNewConstMetric(descPoolFree, prometheus.GaugeValue, u.Size-u.Used, crName, u.Prefix, u.Purpose, u.AddressFamily)
+			ch <- prometheus.MustNewConstMetric(descPoolQuarantined, prometheus.GaugeValue, u.Quarantined, crName, u.Prefix, u.Purpose, u.AddressFamily)
+			// nested pools are accounted in their parent pool
+			if !u.Nested {
+				size[u.AddressFamily] += u.Size
+				used[u.AddressFamily] += u.Used
+			}
+		}
+		for af := range size {
+			ch <- prometheus.MustNewConstMetric(descNetworkInstanceSize, prometheus.GaugeValue, size[af], crName, af)
+			ch <- prometheus.MustNewConstMetric(descNetworkInstanceUsed, prometheus.GaugeValue, used[af], crName, af)
+			ch <- prometheus.MustNewConstMetric(descNetworkInstanceFree, prometheus.GaugeValue, size[af]-used[af], crName, af)
+		}
+	}
+}
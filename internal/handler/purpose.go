@@ -0,0 +1,210 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/hansthienpondt/goipam/pkg/table"
+	"github.com/pkg/errors"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"inet.af/netaddr"
+)
+
+// SetPurpose adds the purpose to the purpose catalogue or updates it
+func (r *handler) SetPurpose(pu ipamv1alpha1.Pu) {
+	r.purposeMutex.Lock()
+	defer r.purposeMutex.Unlock()
+	r.purposes[pu.GetPurposeName()] = pu
+}
+
+// DeletePurpose removes the purpose from the purpose catalogue, allocations
+// for the purpose use the defaults of the network instance afterwards
+func (r *handler) DeletePurpose(name string) {
+	r.purposeMutex.Lock()
+	defer r.purposeMutex.Unlock()
+	delete(r.purposes, name)
+}
+
+func (r *handler) getPurpose(name string) (ipamv1alpha1.Pu, bool) {
+	r.purposeMutex.Lock()
+	defer r.purposeMutex.Unlock()
+	pu, ok := r.purposes[name]
+	return pu, ok
+}
+
+// checkPurpose checks the purpose and address-family of the info are provided,
+// either in the selector or as In match-expression, and every purpose in the
+// catalogue allows one of the address families
+func (r *handler) checkPurpose(info *RegisterInfo) error {
+	purposes := ipamv1alpha1.SelectorValues(info.Selector, info.MatchExpressions, ipamv1alpha1.KeyPurpose)
+	if len(purposes) == 0 {
+		return withReason(reasonInvalid, errors.New("purpose not provided in the selector or as match-expression"))
+	}
+	afs := ipamv1alpha1.SelectorValues(info.Selector, info.MatchExpressions, ipamv1alpha1.KeyAddressFamily)
+	if len(afs) == 0 {
+		return withReason(reasonInvalid, errors.New("address-family not provided in the selector or as match-expression"))
+	}
+	for _, purpose := range purposes {
+		pu, ok := r.getPurpose(purpose)
+		if !ok || hasAddressFamily(pu, afs) {
+			continue
+		}
+		return withReason(reasonInvalid, fmt.Errorf("address-family %s not allowed for purpose %s, allowed: %v", strings.Join(afs, ","), purpose, pu.GetAddressFamilies()))
+	}
+	return nil
+}
+
+func hasAddressFamily(pu ipamv1alpha1.Pu, afs []string) bool {
+	for _, af := range afs {
+		if pu.HasAddressFamily(af) {
+			return true
+		}
+	}
+	return false
+}
+
+// poolInfo returns the info for an allocation from the pool, a purpose or
+// address-family the info selects with a match-expression is taken from the
+// pool and added to the selector of the returned info
+func poolInfo(info *RegisterInfo, pool *table.Route) *RegisterInfo {
+	_, purpose := info.Selector[ipamv1alpha1.KeyPurpose]
+	_, af := info.Selector[ipamv1alpha1.KeyAddressFamily]
+	if purpose && af {
+		return info
+	}
+	pi := *info
+	pi.Selector = make(map[string]string, len(info.Selector)+2)
+	for key, val := range info.Selector {
+		pi.Selector[key] = val
+	}
+	if !purpose {
+		pi.Purpose = pool.Get(ipamv1alpha1.KeyPurpose)
+		pi.Selector[ipamv1alpha1.KeyPurpose] = pi.Purpose
+	}
+	if !af {
+		pi.AddressFamily = pool.Get(ipamv1alpha1.KeyAddressFamily)
+		pi.Selector[ipamv1alpha1.KeyAddressFamily] = pi.AddressFamily
+	}
+	return &pi
+}
+
+// selectedByExpression reports if the info selects the value of the key with
+// a match-expression, the purpose and address-family of such an allocation
+// are taken from its pool
+func selectedByExpression(info *RegisterInfo, key, val string) bool {
+	if key != ipamv1alpha1.KeyPurpose && key != ipamv1alpha1.KeyAddressFamily {
+		return false
+	}
+	if _, ok := info.Selector[key]; ok {
+		return false
+	}
+	for _, v := range ipamv1alpha1.SelectorValues(nil, info.MatchExpressions, key) {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+// parentPool returns the innermost pool the prefix is part of
+func parentPool(iptree *table.RouteTable, p netaddr.IPPrefix) *table.Route {
+	var pool *table.Route
+	for _, parent := range iptree.Parents(p) {
+		if parent.Get(labelKind) == kindPool && (pool == nil || parent.IPPrefix().Bits() > pool.IPPrefix().Bits()) {
+			pool = parent
+		}
+	}
+	return pool
+}
+
+// checkPrefixLength checks the prefix length is within the bounds of the
+// purpose for the address family
+func checkPrefixLength(pu ipamv1alpha1.Pu, af string, pl uint32) error {
+	if min := pu.GetMinPrefixLength(af); min != nil && pl < *min {
+		return withReason(reasonConfig, fmt.Errorf("prefix length %d below the minimum %d of purpose %s", pl, *min, pu.GetPurposeName()))
+	}
+	if max := pu.GetMaxPrefixLength(af); max != nil && pl > *max {
+		return withReason(reasonConfig, fmt.Errorf("prefix length %d above the maximum %d of purpose %s", pl, *max, pu.GetPurposeName()))
+	}
+	return nil
+}
+
+// findFreePrefix finds a free prefix in the pool with the allocation strategy
+// of the purpose, or else of the network instance
+func (r *handler) findFreePrefix(iptree *table.RouteTable, pool netaddr.IPPrefix, bits uint8, info *RegisterInfo, ni ipamv1alpha1.In) (netaddr.IPPrefix, bool) {
+	strategy := ni.GetAllocationStrategy()
+	if pu, ok := r.getPurpose(info.Purpose); ok && pu.GetAllocationStrategy() != "" {
+		strategy = pu.GetAllocationStrategy()
+	}
+	if strategy == ipamv1alpha1.AllocationStrategyDeterministic {
+		if p, ok := deterministicPrefix(iptree, pool, bits, info.SourceTag); ok {
+			return p, true
+		}
+	}
+	return iptree.FindFreePrefix(pool, bits)
+}
+
+// deterministicPrefix derives the prefix in the pool from a hash of the
+// source-tag, such that an allocation gets the same prefix after the iptree is
+// rebuilt; it fails when the derived prefix is not free
+func deterministicPrefix(iptree *table.RouteTable, pool netaddr.IPPrefix, bits uint8, sourceTag map[string]string) (netaddr.IPPrefix, bool) {
+	if bits < pool.Bits() || bits > pool.IP().BitLen() {
+		return netaddr.IPPrefix{}, false
+	}
+	keys := make([]string, 0, len(sourceTag))
+	for key := range sourceTag {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := fnv.New32a()
+	for _, key := range keys {
+		h.Write([]byte(key + "=" + sourceTag[key] + ";"))
+	}
+	// the hash selects one of the prefixes of the pool, at most 2^32
+	n := bits - pool.Bits()
+	if n > 32 {
+		n = 32
+	}
+	index := uint64(h.Sum32()) % (uint64(1) << n)
+
+	ip := pool.IP().As16()
+	addr := new(big.Int).SetBytes(ip[:])
+	addr.Add(addr, new(big.Int).Lsh(new(big.Int).SetUint64(index), uint(pool.IP().BitLen()-bits)))
+	var b [16]byte
+	addr.FillBytes(b[:])
+	a := netaddr.IPFrom16(b)
+	if pool.IP().Is4() {
+		a = a.Unmap()
+	}
+	p := netaddr.IPPrefixFrom(a, bits)
+
+	// the prefix is free when it does not overlap any route but the pools
+	if _, ok, _ := iptree.Get(p); ok || len(iptree.Children(p)) > 0 {
+		return netaddr.IPPrefix{}, false
+	}
+	for _, parent := range iptree.Parents(p) {
+		if parent.Get(labelKind) != kindPool {
+			return netaddr.IPPrefix{}, false
+		}
+	}
+	return p, true
+}
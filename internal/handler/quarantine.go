@@ -0,0 +1,149 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hansthienpondt/goipam/pkg/table"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+const (
+	// kindQuarantine marks the tombstone route of a released prefix, the
+	// prefix is not allocated again until labelExpires has passed, except to
+	// an allocation with the same selector and source-tag
+	kindQuarantine = "quarantine"
+	labelExpires   = "ipam.nddr.yndd.io/expires"
+)
+
+// Quarantine sets the period released prefixes of the network instance are
+// held before they are allocated again and removes the tombstones of which the
+// period expired
+func (r *handler) Quarantine(crName string, period time.Duration) {
+	t, ok := r.lookupTree(crName)
+	if !ok {
+		return
+	}
+	r.lockTree(opExpire, t)
+	defer t.Unlock()
+	t.quarantine = period
+
+	req, err := labels.NewRequirement(labelKind, selection.In, []string{kindQuarantine})
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	info := &RegisterInfo{Namespace: strings.SplitN(crName, ".", 2)[0], CrName: crName}
+	for _, route := range t.routes.GetByLabel(labels.NewSelector().Add(*req)) {
+		if now.Before(expires(route)) {
+			continue
+		}
+		l := tombstoneLabels(route)
+		if _, _, err := t.routes.Delete(route); err != nil {
+			r.log.Debug("cannot expire quarantined prefix", "crName", crName, "prefix", route.String(), "error", err)
+			continue
+		}
+		r.publish(EventExpire, info, route.String(), l)
+	}
+}
+
+// quarantine adds a tombstone route for a released prefix when the network
+// instance has a quarantine period
+func (r *handler) quarantine(t *ipTree, prefix string, l map[string]string) {
+	if t.quarantine <= 0 || l == nil {
+		return
+	}
+	if pu, ok := r.getPurpose(l[ipamv1alpha1.KeyPurpose]); ok && pu.GetReusePolicy() == ipamv1alpha1.ReusePolicyImmediate {
+		return
+	}
+	// the request id is not held, a retried request allocates again
+	tl := withoutRequest(l)
+	tl[labelKind] = kindQuarantine
+	tl[labelExpires] = strconv.FormatInt(time.Now().Add(t.quarantine).Unix(), 10)
+	if err := restore(t.routes, prefix, tl); err != nil {
+		r.log.Debug("cannot quarantine prefix", "prefix", prefix, "error", err)
+	}
+}
+
+// revive turns the tombstone route into an allocation with the labels l when
+// the tombstone was released by an allocation with the same labels, such that
+// an allocation returning within the quarantine period gets its prefix back
+func revive(iptree *table.RouteTable, tombstone *table.Route, l map[string]string) error {
+	tl := tombstoneLabels(tombstone)
+	tl[labelKind] = kindAllocation
+	if !labels.Equals(tl, withoutRequest(l)) {
+		return withReason(reasonConflict, fmt.Errorf("prefix is quarantined until %s, prefix: %s", expires(tombstone).Format(time.RFC3339), tombstone.String()))
+	}
+	route := table.NewRoute(tombstone.IPPrefix())
+	route.UpdateLabel(l)
+	return iptree.Update(route)
+}
+
+// requarantine puts the tombstone of a revived allocation back with its
+// original labels, such that the prefix keeps its original expiry
+func (r *handler) requarantine(t *ipTree, prefix string, tombstone map[string]string) {
+	if err := restore(t.routes, prefix, tombstone); err != nil {
+		r.log.Debug("cannot quarantine prefix again", "prefix", prefix, "error", err)
+	}
+}
+
+// pickAllocation returns the allocation of the routes, a tombstone is only
+// returned when there is no allocation
+func pickAllocation(routes table.Routes) *table.Route {
+	for _, route := range routes {
+		if route.Get(labelKind) != kindQuarantine {
+			return route
+		}
+	}
+	return routes[0]
+}
+
+// tombstoneLabels returns the labels of the allocation the tombstone was
+// created for
+func tombstoneLabels(route *table.Route) map[string]string {
+	l := make(map[string]string)
+	for key, val := range *route.GetLabels() {
+		if key != labelExpires {
+			l[key] = val
+		}
+	}
+	return l
+}
+
+// copyLabels returns a copy of the labels of the route, the labels are kept
+// when the route is replaced in the iptree
+func copyLabels(route *table.Route) map[string]string {
+	l := make(map[string]string)
+	for key, val := range *route.GetLabels() {
+		l[key] = val
+	}
+	return l
+}
+
+func expires(route *table.Route) time.Time {
+	sec, err := strconv.ParseInt(route.Get(labelExpires), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
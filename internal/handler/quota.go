@@ -0,0 +1,211 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hansthienpondt/goipam/pkg/table"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"inet.af/netaddr"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// QuotaUsage is the usage of a quota in the iptrees of its namespace
+type QuotaUsage struct {
+	Allocations uint32
+	Addresses   float64
+}
+
+// quota is a quota of the catalogue with the selector of the allocations it
+// applies to
+type quota struct {
+	ipamv1alpha1.Qu
+	selector labels.Selector
+}
+
+// quotaScope are the iptrees the allocations of the quotas are counted in,
+// indexed by namespace and crName
+type quotaScope map[string]map[string]*ipTree
+
+func quotaKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// SetQuota adds the quota to the quota catalogue or updates it
+func (r *handler) SetQuota(q ipamv1alpha1.Qu) error {
+	selector, err := quotaSelector(q)
+	if err != nil {
+		return withReason(reasonInvalid, err)
+	}
+	r.quotaMutex.Lock()
+	defer r.quotaMutex.Unlock()
+	r.quotas[quotaKey(q.GetNamespace(), q.GetName())] = &quota{Qu: q, selector: selector}
+	return nil
+}
+
+// DeleteQuota removes the quota from the quota catalogue
+func (r *handler) DeleteQuota(namespace, name string) {
+	r.quotaMutex.Lock()
+	defer r.quotaMutex.Unlock()
+	delete(r.quotas, quotaKey(namespace, name))
+}
+
+// GetQuotaUsage returns the allocations and addresses counted against the
+// quota in the iptrees of its namespace
+func (r *handler) GetQuotaUsage(namespace, name string) (*QuotaUsage, error) {
+	r.quotaMutex.Lock()
+	q, ok := r.quotas[quotaKey(namespace, name)]
+	r.quotaMutex.Unlock()
+	if !ok {
+		return nil, withReason(reasonNotFound, fmt.Errorf("quota not found: %s", quotaKey(namespace, name)))
+	}
+
+	scope := r.getScope(map[string]bool{namespace: true})
+	defer r.lockTrees(opQuota, scope.merge(nil))()
+	return quotaUsage(q, scope[namespace]), nil
+}
+
+// getQuotaScope returns the iptrees of the namespaces of the infos that have
+// quotas, the quotas are counted in these iptrees. A namespace with quotas is
+// in scope even when none of them applies to the info, since a purpose
+// selected with a match-expression is only known once the pool is found.
+func (r *handler) getQuotaScope(infos ...*RegisterInfo) quotaScope {
+	namespaces := make(map[string]bool)
+	r.quotaMutex.Lock()
+	for _, q := range r.quotas {
+		for _, info := range infos {
+			if q.GetNamespace() == info.Namespace {
+				namespaces[info.Namespace] = true
+			}
+		}
+	}
+	r.quotaMutex.Unlock()
+	if len(namespaces) == 0 {
+		return quotaScope{}
+	}
+	return r.getScope(namespaces)
+}
+
+// getScope returns the iptrees of the network instances in the namespaces
+func (r *handler) getScope(namespaces map[string]bool) quotaScope {
+	r.iptreeMutex.Lock()
+	defer r.iptreeMutex.Unlock()
+	scope := make(quotaScope, len(namespaces))
+	for crName, t := range r.iptree {
+		s, ok := r.states[crName]
+		if !ok || !namespaces[s.ni.Namespace] {
+			continue
+		}
+		if _, ok := scope[s.ni.Namespace]; !ok {
+			scope[s.ni.Namespace] = make(map[string]*ipTree)
+		}
+		scope[s.ni.Namespace][crName] = t
+	}
+	return scope
+}
+
+// merge returns the iptrees of the scope together with the trees, such that
+// they can be locked at once
+func (s quotaScope) merge(trees map[string]*ipTree) map[string]*ipTree {
+	merged := make(map[string]*ipTree, len(trees))
+	for _, nsTrees := range s {
+		for crName, t := range nsTrees {
+			merged[crName] = t
+		}
+	}
+	for crName, t := range trees {
+		merged[crName] = t
+	}
+	return merged
+}
+
+// getQuotas returns the quotas of the catalogue that apply to the allocation
+// of the info ordered by name
+func (r *handler) getQuotas(info *RegisterInfo) []*quota {
+	l := make(labels.Set, len(info.Selector)+len(info.SourceTag))
+	for key, val := range info.Selector {
+		l[key] = val
+	}
+	for key, val := range info.SourceTag {
+		l[key] = val
+	}
+
+	r.quotaMutex.Lock()
+	defer r.quotaMutex.Unlock()
+	quotas := make([]*quota, 0)
+	for _, q := range r.quotas {
+		if q.GetNamespace() == info.Namespace && q.selector.Matches(l) {
+			quotas = append(quotas, q)
+		}
+	}
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].GetName() < quotas[j].GetName() })
+	return quotas
+}
+
+// checkQuota checks the allocation of the prefix for the info stays within
+// the quotas that apply to the info, the iptrees of the scope are locked by
+// the caller
+func (r *handler) checkQuota(info *RegisterInfo, p netaddr.IPPrefix, scope quotaScope) error {
+	size := routeSize(table.NewRoute(p))
+	for _, q := range r.getQuotas(info) {
+		u := quotaUsage(q, scope[q.GetNamespace()])
+		if max := q.GetMaxAllocations(); max != nil && u.Allocations+1 > *max {
+			return withReason(reasonQuota, fmt.Errorf("quota %s exceeded, allocations: %d, max-allocations: %d", q.GetName(), u.Allocations, *max))
+		}
+		if max := q.GetMaxAddresses(); max != nil && u.Addresses+size > float64(*max) {
+			return withReason(reasonQuota, fmt.Errorf("quota %s exceeded, addresses: %.0f, requested: %.0f, max-addresses: %d", q.GetName(), u.Addresses, size, *max))
+		}
+	}
+	return nil
+}
+
+// quotaUsage counts the allocations the quota applies to in the iptrees
+func quotaUsage(q *quota, trees map[string]*ipTree) *QuotaUsage {
+	u := &QuotaUsage{}
+	req, err := labels.NewRequirement(labelKind, selection.In, []string{kindAllocation})
+	if err != nil {
+		return u
+	}
+	selector := q.selector.Add(*req)
+	for _, t := range trees {
+		for _, route := range t.routes.GetByLabel(selector) {
+			u.Allocations++
+			u.Addresses += routeSize(route)
+		}
+	}
+	return u
+}
+
+// quotaSelector returns the selector of the allocations the quota applies to
+func quotaSelector(q ipamv1alpha1.Qu) (labels.Selector, error) {
+	selector := labels.NewSelector()
+	l := q.GetSourceTag()
+	if purpose := q.GetPurpose(); purpose != "" {
+		l[ipamv1alpha1.KeyPurpose] = purpose
+	}
+	for key, val := range l {
+		req, err := labels.NewRequirement(key, selection.In, []string{val})
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*req)
+	}
+	return selector, nil
+}
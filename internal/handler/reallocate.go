@@ -0,0 +1,91 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hansthienpondt/goipam/pkg/table"
+	"github.com/pkg/errors"
+	"inet.af/netaddr"
+)
+
+// Reallocate releases the allocation of from and allocates to under a single
+// lock of the iptree, when the allocation of to fails the allocation of from
+// is restored. An allocation of from that is no longer in the iptree is
+// ignored, such that a register that was not restored can still move.
+func (r *handler) Reallocate(ctx context.Context, from, to *RegisterInfo) (prefix *string, err error) {
+	var released, added bool
+	defer func() { r.metrics.observeReallocate(to, released, added, err) }()
+
+	if from.CrName != to.CrName {
+		return nil, withReason(reasonInvalid, fmt.Errorf("cannot reallocate across network instances, from: %s, to: %s", from.CrName, to.CrName))
+	}
+
+	ni, t, err := r.validateRegister(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAdminState(ni); err != nil {
+		return nil, err
+	}
+
+	scope := r.getQuotaScope(to)
+	defer r.lockTrees(opReallocate, scope.merge(map[string]*ipTree{to.CrName: t}))()
+	l := routeLabels(t.routes, from.IpPrefix)
+	released = l != nil && l[labelKind] != kindQuarantine
+	if released {
+		if err := r.deregister(from, t.routes); err != nil {
+			return nil, err
+		}
+	}
+	a, err := r.register(to, ni, t, scope)
+	if err != nil {
+		if released {
+			if rerr := restore(t.routes, from.IpPrefix, l); rerr != nil {
+				r.log.Debug("cannot restore allocation", "prefix", from.IpPrefix, "error", rerr)
+				// the old allocation is gone, which is reported as a release
+				r.publish(EventRelease, from, from.IpPrefix, l)
+			}
+		}
+		return nil, err
+	}
+	added = a.added
+	if a.expansion != nil {
+		r.notifyExpansion(to.CrName, ni)
+	}
+	if released {
+		if a.prefix != from.IpPrefix {
+			r.quarantine(t, from.IpPrefix, l)
+		}
+		r.publish(EventRelease, from, from.IpPrefix, l)
+	}
+	r.publish(EventAllocate, to, a.prefix, routeLabels(t.routes, a.prefix))
+	return &a.prefix, nil
+}
+
+// restore adds the route of the prefix with its labels back to the iptree
+func restore(iptree *table.RouteTable, prefix string, l map[string]string) error {
+	p, err := netaddr.ParseIPPrefix(prefix)
+	if err != nil {
+		return err
+	}
+	route := table.NewRoute(p)
+	route.UpdateLabel(l)
+	return errors.Wrap(iptree.Add(route), "route insertion failed")
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// State is the readiness of the iptree of a network instance
+type State string
+
+const (
+	// StateInitializing indicates the iptree is created but the ip prefixes
+	// of the network instance are not loaded yet
+	StateInitializing State = "initializing"
+	// StateLoading indicates the ip prefixes are being loaded in the iptree
+	StateLoading State = "loading"
+	// StateReady indicates the iptree handles allocations
+	StateReady State = "ready"
+	// StateDeleted indicates the iptree was removed
+	StateDeleted State = "deleted"
+)
+
+// StateFn is called on every state change of the iptree of a network
+// instance, the crName identifies the iptree and ni the network instance
+// resource it belongs to
+type StateFn func(crName string, ni types.NamespacedName, state State)
+
+type treeState struct {
+	ni    types.NamespacedName
+	state State
+}
+
+// Init creates the iptree of the network instance, the iptree does not handle
+// allocations until it is loaded
+func (r *handler) Init(crName string, ni types.NamespacedName) {
+	r.iptreeMutex.Lock()
+	_, exists := r.iptree[crName]
+	if !exists {
+		r.iptree[crName] = newIpTree()
+		r.states[crName] = &treeState{ni: ni, state: StateInitializing}
+	}
+	r.iptreeMutex.Unlock()
+
+	if !exists {
+		r.notifyState(crName, ni, StateInitializing)
+	}
+}
+
+// Load adds the ip prefixes of the network instance to an initializing iptree
+// after which the iptree is ready. Ip prefixes that fail to load are retried
+// by their own reconciliation and do not block the readiness.
+func (r *handler) Load(crName string, ipps []ipamv1alpha1.Ipp) {
+	ni, ok := r.setState(crName, StateInitializing, StateLoading)
+	if !ok {
+		return
+	}
+	r.notifyState(crName, ni, StateLoading)
+
+	for _, ipp := range ipps {
+		if err := r.AddIpPrefix(crName, ipp); err != nil {
+			r.log.Debug("cannot load ip prefix", "crName", crName, "prefix", ipp.GetIpPrefix(), "error", err)
+		}
+	}
+	if t, ok := r.lookupTree(crName); ok {
+		r.lockTree(opLoad, t)
+		r.loadRequests(crName, t.routes)
+		t.Unlock()
+	}
+
+	if _, ok := r.setState(crName, StateLoading, StateReady); ok {
+		r.notifyState(crName, ni, StateReady)
+	}
+}
+
+// setState changes the state of the iptree if it is in the expected state
+func (r *handler) setState(crName string, from, to State) (types.NamespacedName, bool) {
+	r.iptreeMutex.Lock()
+	defer r.iptreeMutex.Unlock()
+	s, ok := r.states[crName]
+	if !ok || s.state != from {
+		return types.NamespacedName{}, false
+	}
+	s.state = to
+	return s.ni, true
+}
+
+// lookupState returns the network instance resource of the iptree
+func (r *handler) lookupState(crName string) (types.NamespacedName, bool) {
+	r.iptreeMutex.Lock()
+	defer r.iptreeMutex.Unlock()
+	s, ok := r.states[crName]
+	if !ok {
+		return types.NamespacedName{}, false
+	}
+	return s.ni, true
+}
+
+// GetState returns the state of the iptree of the network instance
+func (r *handler) GetState(crName string) State {
+	r.iptreeMutex.Lock()
+	defer r.iptreeMutex.Unlock()
+	if s, ok := r.states[crName]; ok {
+		return s.state
+	}
+	return StateDeleted
+}
+
+// Delete removes the iptree of the network instance with all its prefixes, it
+// is part of the network instance lifecycle; an individual ip prefix is removed
+// with DeleteIpPrefix
+func (r *handler) Delete(crName string) {
+	r.iptreeMutex.Lock()
+	s, exists := r.states[crName]
+	delete(r.iptree, crName)
+	delete(r.states, crName)
+	r.iptreeMutex.Unlock()
+
+	r.requestMutex.Lock()
+	delete(r.requests, crName)
+	r.requestMutex.Unlock()
+	r.feed.drop(crName)
+
+	if exists {
+		r.notifyState(crName, s.ni, StateDeleted)
+	}
+}
+
+// AddStateFn registers a function that is called on every state change of
+// a network instance iptree, the state of the existing trees is reported
+// immediately
+func (r *handler) AddStateFn(fn StateFn) {
+	r.stateFnMutex.Lock()
+	r.stateFns = append(r.stateFns, fn)
+	r.stateFnMutex.Unlock()
+
+	r.iptreeMutex.Lock()
+	states := make(map[string]treeState, len(r.states))
+	for crName, s := range r.states {
+		states[crName] = *s
+	}
+	r.iptreeMutex.Unlock()
+
+	for crName, s := range states {
+		fn(crName, s.ni, s.state)
+	}
+}
+
+func (r *handler) notifyState(crName string, ni types.NamespacedName, state State) {
+	r.stateFnMutex.Lock()
+	defer r.stateFnMutex.Unlock()
+	for _, fn := range r.stateFns {
+		fn(crName, ni, state)
+	}
+}
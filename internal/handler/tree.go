@@ -0,0 +1,96 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hansthienpondt/goipam/pkg/table"
+)
+
+// ipTree is the iptree of a network instance, the lock serializes the changes
+// of the iptree such that finding a free prefix and inserting it is atomic.
+// The iptreeMutex of the handler only protects the map of the iptrees and is
+// never taken while holding the lock of an iptree.
+type ipTree struct {
+	sync.Mutex
+	routes *table.RouteTable
+	// quarantine is the period a released prefix is held as a tombstone
+	quarantine time.Duration
+	// expandPolicies are the auto-expand policies of the pools, indexed by
+	// the prefix of the pool
+	expandPolicies map[string]*expandPolicy
+}
+
+func newIpTree() *ipTree {
+	return &ipTree{
+		routes:         table.NewRouteTable(),
+		expandPolicies: make(map[string]*expandPolicy),
+	}
+}
+
+// getTree returns the iptree of the network instance if it is ready to handle
+// new registrations
+func (r *handler) getTree(crName string) (*ipTree, error) {
+	r.iptreeMutex.Lock()
+	defer r.iptreeMutex.Unlock()
+	t, ok := r.iptree[crName]
+	if !ok || r.states[crName].state != StateReady {
+		r.log.Debug("pool/tree not ready", "crName", crName)
+		return nil, withReason(reasonNotReady, fmt.Errorf("pool/tree not ready, crName: %s", crName))
+	}
+	return t, nil
+}
+
+// lookupTree returns the iptree of the network instance regardless of its state
+func (r *handler) lookupTree(crName string) (*ipTree, bool) {
+	r.iptreeMutex.Lock()
+	defer r.iptreeMutex.Unlock()
+	t, ok := r.iptree[crName]
+	return t, ok
+}
+
+// lockTree locks the iptree and records the time waiting for it
+func (r *handler) lockTree(op string, t *ipTree) {
+	start := time.Now()
+	t.Lock()
+	r.metrics.lockWait.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// lockTrees locks the iptrees in the order of their crName to avoid
+// deadlocks between operations spanning multiple network instances, the
+// returned function unlocks them
+func (r *handler) lockTrees(op string, trees map[string]*ipTree) func() {
+	crNames := make([]string, 0, len(trees))
+	for crName := range trees {
+		crNames = append(crNames, crName)
+	}
+	sort.Strings(crNames)
+	start := time.Now()
+	for _, crName := range crNames {
+		trees[crName].Lock()
+	}
+	r.metrics.lockWait.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return func() {
+		for _, crName := range crNames {
+			trees[crName].Unlock()
+		}
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+)
+
+// TestConcurrentRegister registers, releases and adds pools concurrently in
+// several network instances and checks a prefix is never handed out to two
+// owners at the same time. Run with the race detector.
+func TestConcurrentRegister(t *testing.T) {
+	const (
+		workers    = 8
+		iterations = 50
+		pools      = 4
+	)
+	nis := []string{"ni-a", "ni-b", "ni-c"}
+	r := newTestHandler(t, nis...)
+
+	var mu sync.Mutex
+	held := make(map[string]string)
+	hold := func(crName, prefix, owner string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		key := crName + "/" + prefix
+		if other, ok := held[key]; ok {
+			return fmt.Errorf("prefix %s handed out to %s and %s", key, other, owner)
+		}
+		held[key] = owner
+		return nil
+	}
+	drop := func(crName, prefix string) {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(held, crName+"/"+prefix)
+	}
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, len(nis)*(workers+1))
+	for n, ni := range nis {
+		n, ni := n, ni
+		// the pools are added while the workers allocate from them
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < pools; i++ {
+				ipp := newTestIpPrefix(fmt.Sprintf("%s-pool-%d", ni, i), fmt.Sprintf("10.%d.%d.0/28", n, i))
+				if err := r.AddIpPrefix(testCrName(ni), ipp); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+		for w := 0; w < workers; w++ {
+			w := w
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				owned := make([]*RegisterInfo, 0, iterations)
+				for i := 0; i < iterations; i++ {
+					info := newTestInfo(ni, string(ipamv1alpha1.AddressFamilyIpv4), fmt.Sprintf("%d-%d", w, i))
+					p, err := r.Register(ctx, info)
+					switch {
+					case err == nil:
+						if err := hold(info.CrName, *p, info.SourceTag["client"]); err != nil {
+							errs <- err
+							return
+						}
+						info.IpPrefix = *p
+						owned = append(owned, info)
+					case reasonOf(err) != reasonExhausted:
+						errs <- fmt.Errorf("register %s: %w", info.SourceTag["client"], err)
+						return
+					}
+					// release every other allocation such that the
+					// prefixes are reused
+					if i%2 == 1 && len(owned) > 0 {
+						release := owned[0]
+						owned = owned[1:]
+						// the prefix is dropped before it is released, such
+						// that it is held as long as it is allocated
+						drop(release.CrName, release.IpPrefix)
+						if err := r.DeRegister(ctx, release); err != nil {
+							errs <- fmt.Errorf("deregister %s: %w", release.IpPrefix, err)
+							return
+						}
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// the allocations in the iptrees are exactly the held prefixes
+	allocated := make(map[string]string)
+	for _, ni := range nis {
+		tr, _ := r.lookupTree(testCrName(ni))
+		for _, route := range tr.routes.GetTable() {
+			if route.Get(labelKind) == kindAllocation {
+				allocated[testCrName(ni)+"/"+route.String()] = route.Get("client")
+			}
+		}
+	}
+	if len(allocated) != len(held) {
+		t.Errorf("allocations in the iptrees: %d, held: %d", len(allocated), len(held))
+	}
+	for key, owner := range held {
+		if allocated[key] != owner {
+			t.Errorf("prefix %s held by %s, allocated to %q", key, owner, allocated[key])
+		}
+	}
+}
+
+// TestConcurrentQuota registers concurrently in two network instances of the
+// namespace that share a quota and checks the quota is never exceeded. Run
+// with the race detector.
+func TestConcurrentQuota(t *testing.T) {
+	const (
+		workers        = 16
+		iterations     = 10
+		maxAllocations = 50
+	)
+	nis := []string{"ni-a", "ni-b"}
+	r := newTestHandler(t, nis...)
+	for n, ni := range nis {
+		addTestPools(t, r, ni, fmt.Sprintf("10.%d.0.0/24", n))
+	}
+	if err := r.SetQuota(newTestQuota("isl", testPurpose, maxAllocations)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	var allocated int32
+	var wg sync.WaitGroup
+	// the workers start at once such that they contend for the quota
+	start := make(chan struct{})
+	errs := make(chan error, len(nis)*workers)
+	for _, ni := range nis {
+		ni := ni
+		for w := 0; w < workers; w++ {
+			w := w
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				for i := 0; i < iterations; i++ {
+					info := newTestInfo(ni, string(ipamv1alpha1.AddressFamilyIpv4), fmt.Sprintf("%s-%d-%d", ni, w, i))
+					_, err := r.Register(ctx, info)
+					switch {
+					case err == nil:
+						atomic.AddInt32(&allocated, 1)
+					case reasonOf(err) != reasonQuota:
+						errs <- fmt.Errorf("register %s: %w", info.SourceTag["client"], err)
+						return
+					}
+				}
+			}()
+		}
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if allocated != maxAllocations {
+		t.Errorf("allocations: %d, max-allocations: %d", allocated, maxAllocations)
+	}
+	u, err := r.GetQuotaUsage(testNamespace, "isl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Allocations != maxAllocations {
+		t.Errorf("usage of the quota: %d, max-allocations: %d", u.Allocations, maxAllocations)
+	}
+}
+
+// TestQuotaLocksNamespace checks an allocation counted against a quota waits
+// for the iptrees of the other network instances of the namespace
+func TestQuotaLocksNamespace(t *testing.T) {
+	r := newTestHandler(t, "ni-a", "ni-b")
+	addTestPools(t, r, "ni-b", "10.1.0.0/24")
+	if err := r.SetQuota(newTestQuota("isl", testPurpose, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	tr, _ := r.lookupTree(testCrName("ni-a"))
+	tr.Lock()
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Register(context.Background(), newTestInfo("ni-b", string(ipamv1alpha1.AddressFamilyIpv4), "b"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		tr.Unlock()
+		t.Fatalf("register did not wait for the iptree of ni-a, err: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	tr.Unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
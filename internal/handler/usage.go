@@ -0,0 +1,134 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/hansthienpondt/goipam/pkg/table"
+	"github.com/pkg/errors"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"inet.af/netaddr"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// PoolUsage is the utilisation of a pool in the iptree
+type PoolUsage struct {
+	Prefix        string
+	Purpose       string
+	AddressFamily string
+	Size          float64
+	// Used includes the quarantined addresses since they cannot be allocated
+	// to another owner until the quarantine expires
+	Used        float64
+	Quarantined float64
+	// Nested indicates the pool is part of another pool
+	Nested bool
+}
+
+// GetPoolUsage returns the utilisation of the pool of the prefix in the
+// iptree of the network instance
+func (r *handler) GetPoolUsage(crName, prefix string) (*PoolUsage, error) {
+	p, err := netaddr.ParseIPPrefix(prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseIPPrefix failed")
+	}
+	t, ok := r.lookupTree(crName)
+	if !ok {
+		return nil, withReason(reasonNotReady, fmt.Errorf("pool/tree not ready, crName: %s", crName))
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	route, ok, err := t.routes.Get(p)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("prefix not found: %s", prefix)
+	}
+	return poolUsage(t.routes, route), nil
+}
+
+// getUsage returns the utilisation of every pool per network instance
+func (r *handler) getUsage() map[string][]*PoolUsage {
+	r.iptreeMutex.Lock()
+	trees := make(map[string]*ipTree, len(r.iptree))
+	for crName, t := range r.iptree {
+		trees[crName] = t
+	}
+	r.iptreeMutex.Unlock()
+
+	usage := make(map[string][]*PoolUsage, len(trees))
+	for crName, t := range trees {
+		t.Lock()
+		usage[crName] = treeUsage(t.routes)
+		t.Unlock()
+	}
+	return usage
+}
+
+func treeUsage(iptree *table.RouteTable) []*PoolUsage {
+	req, err := labels.NewRequirement(labelKind, selection.In, []string{kindPool})
+	if err != nil {
+		return nil
+	}
+	usages := make([]*PoolUsage, 0)
+	for _, pool := range iptree.GetByLabel(labels.NewSelector().Add(*req)) {
+		usages = append(usages, poolUsage(iptree, pool))
+	}
+	return usages
+}
+
+func poolUsage(iptree *table.RouteTable, pool *table.Route) *PoolUsage {
+	u := &PoolUsage{
+		Prefix:        pool.IPPrefix().String(),
+		Purpose:       pool.Get(ipamv1alpha1.KeyPurpose),
+		AddressFamily: pool.Get(ipamv1alpha1.KeyAddressFamily),
+		Size:          routeSize(pool),
+	}
+	// the pools carved out of the pool are used as a whole, their allocations
+	// are accounted for by the carved pools
+	pools := childPools(iptree, pool.IPPrefix())
+	for _, child := range iptree.Children(pool.IPPrefix()) {
+		kind := child.Get(labelKind)
+		if covered(child, pools) {
+			continue
+		}
+		switch kind {
+		case kindAllocation, kindPool:
+			u.Used += routeSize(child)
+		case kindQuarantine:
+			u.Used += routeSize(child)
+			u.Quarantined += routeSize(child)
+		}
+	}
+	for _, parent := range iptree.Parents(pool.IPPrefix()) {
+		if parent.Get(labelKind) == kindPool {
+			u.Nested = true
+		}
+	}
+	return u
+}
+
+// routeSize returns the number of addresses of the route
+func routeSize(route *table.Route) float64 {
+	p := route.IPPrefix()
+	return math.Pow(2, float64(p.IP().BitLen()-p.Bits()))
+}
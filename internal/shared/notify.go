@@ -0,0 +1,57 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shared
+
+import (
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"github.com/yndd/nddr-ipam-registry/internal/handler"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// NotifyReady returns a handler.StateFn that sends the network instance on
+// the event channel when its iptree becomes ready, such that the controller
+// reconciles the resources that depend on it
+func NotifyReady(events chan event.GenericEvent) handler.StateFn {
+	return func(crName string, ni types.NamespacedName, state handler.State) {
+		if state != handler.StateReady {
+			return
+		}
+		// the state fns are called synchronously by the handler
+		go send(events, ni)
+	}
+}
+
+// NotifyExpanded returns a handler.ExpansionFn that sends the network
+// instance on the event channel when an allocation expanded one of its pools,
+// such that the controller records the expansion as ip prefix
+func NotifyExpanded(events chan event.GenericEvent) handler.ExpansionFn {
+	return func(crName string, ni types.NamespacedName) {
+		// the expansion fns are called synchronously by the handler while
+		// it holds the lock of the iptree
+		go send(events, ni)
+	}
+}
+
+func send(events chan event.GenericEvent, ni types.NamespacedName) {
+	events <- event.GenericEvent{
+		Object: &ipamv1alpha1.IpamNetworkInstance{
+			ObjectMeta: metav1.ObjectMeta{Name: ni.Name, Namespace: ni.Namespace},
+		},
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:webhook:path=/mutate-ipam-nddr-yndd-io-v1alpha1-ipam,mutating=true,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=ipams,verbs=create;update,versions=v1alpha1,name=mipam.ipam.nddr.yndd.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-ipam-nddr-yndd-io-v1alpha1-ipam,mutating=false,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=ipams,verbs=create;update,versions=v1alpha1,name=vipam.ipam.nddr.yndd.io,admissionReviewVersions=v1
+
+func newIpam() client.Object { return &ipamv1alpha1.Ipam{} }
+
+func defaultIpam(obj client.Object) {
+	cr := obj.(*ipamv1alpha1.Ipam)
+	if cr.Spec.Ipam == nil {
+		cr.Spec.Ipam = &ipamv1alpha1.IpamIpam{}
+	}
+	if cr.Spec.Ipam.AdminState == nil {
+		cr.Spec.Ipam.AdminState = utils.StringPtr("enable")
+	}
+}
+
+func validateIpam(ctx context.Context, c client.Reader, obj, old client.Object) error {
+	cr := obj.(*ipamv1alpha1.Ipam)
+	if old == nil {
+		return nil
+	}
+	// the organization and deployment determine the registry of the ipam
+	if !reflect.DeepEqual(cr.Spec.Oda, old.(*ipamv1alpha1.Ipam).Spec.Oda) {
+		return fmt.Errorf("oda is immutable")
+	}
+	return nil
+}
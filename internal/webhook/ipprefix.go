@@ -0,0 +1,187 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"inet.af/netaddr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:webhook:path=/mutate-ipam-nddr-yndd-io-v1alpha1-ipamnetworkinstanceipprefix,mutating=true,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=ipamnetworkinstanceipprefixes,verbs=create;update,versions=v1alpha1,name=mipamnetworkinstanceipprefix.ipam.nddr.yndd.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-ipam-nddr-yndd-io-v1alpha1-ipamnetworkinstanceipprefix,mutating=false,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=ipamnetworkinstanceipprefixes,verbs=create;update,versions=v1alpha1,name=vipamnetworkinstanceipprefix.ipam.nddr.yndd.io,admissionReviewVersions=v1
+
+func newIpamNetworkInstanceIpPrefix() client.Object {
+	return &ipamv1alpha1.IpamNetworkInstanceIpPrefix{}
+}
+
+func defaultIpamNetworkInstanceIpPrefix(obj client.Object) {
+	cr := obj.(*ipamv1alpha1.IpamNetworkInstanceIpPrefix)
+	if cr.Spec.IpamNetworkInstanceIpPrefix == nil {
+		return
+	}
+	if cr.Spec.IpamNetworkInstanceIpPrefix.AdminState == nil {
+		cr.Spec.IpamNetworkInstanceIpPrefix.AdminState = utils.StringPtr("enable")
+	}
+}
+
+func validateIpamNetworkInstanceIpPrefix(ctx context.Context, c client.Reader, obj, old client.Object) error {
+	cr := obj.(*ipamv1alpha1.IpamNetworkInstanceIpPrefix)
+	if cr.Spec.IpamNetworkInstanceIpPrefix == nil {
+		return fmt.Errorf("ip-prefix not provided")
+	}
+	if err := validateCapacityThreshold(cr.Spec.IpamNetworkInstanceIpPrefix.CapacityThreshold); err != nil {
+		return err
+	}
+	if err := validateAutoExpand(cr.GetAutoExpand()); err != nil {
+		return err
+	}
+	if cr.HasParent() {
+		return validateParent(ctx, c, cr, old)
+	}
+	if cr.Spec.IpamNetworkInstanceIpPrefix.Prefix == nil {
+		return fmt.Errorf("prefix or parent not provided")
+	}
+	p, err := parsePrefix(cr.GetIpPrefix())
+	if err != nil {
+		return err
+	}
+	// the allocations of a pool are bounded by the purpose, not the pool itself
+	if err := validatePurpose(ctx, c, cr.GetTags()[ipamv1alpha1.KeyPurpose], addressFamily(p), nil); err != nil {
+		return err
+	}
+
+	if old != nil {
+		// the allocations of the pool depend on the prefix
+		if prev := old.(*ipamv1alpha1.IpamNetworkInstanceIpPrefix).GetIpPrefix(); prev != cr.GetIpPrefix() {
+			return fmt.Errorf("prefix is immutable, prefix: %s", prev)
+		}
+		return nil
+	}
+	return validateOverlap(ctx, c, cr, p)
+}
+
+// validateParent checks the request of a prefix from a parent pool, the
+// prefix is carved by the handler so it cannot overlap another prefix
+func validateParent(ctx context.Context, c client.Reader, cr *ipamv1alpha1.IpamNetworkInstanceIpPrefix, old client.Object) error {
+	if cr.Spec.IpamNetworkInstanceIpPrefix.Prefix != nil {
+		return fmt.Errorf("prefix and parent are mutually exclusive")
+	}
+	af := cr.GetParentSelector()[ipamv1alpha1.KeyAddressFamily]
+	max, ok := maxPrefixLength[af]
+	if !ok {
+		return fmt.Errorf("parent selector %s not provided or unknown, %s: %s", ipamv1alpha1.KeyAddressFamily, ipamv1alpha1.KeyAddressFamily, af)
+	}
+	if cr.Spec.IpamNetworkInstanceIpPrefix.Parent.PrefixLength == nil || cr.GetParentPrefixLength() > max {
+		return fmt.Errorf("parent prefix-length not provided or out of bounds for the address-family, address-family: %s, max: %d", af, max)
+	}
+	if err := validatePurpose(ctx, c, cr.GetTags()[ipamv1alpha1.KeyPurpose], af, nil); err != nil {
+		return err
+	}
+	if old != nil {
+		// the parent determines the carved prefix
+		o := old.(*ipamv1alpha1.IpamNetworkInstanceIpPrefix)
+		if !reflect.DeepEqual(o.Spec.IpamNetworkInstanceIpPrefix.Parent, cr.Spec.IpamNetworkInstanceIpPrefix.Parent) {
+			return fmt.Errorf("parent is immutable")
+		}
+	}
+	return nil
+}
+
+// validateAutoExpand checks the aggregate and the prefix length of the
+// expansions, the threshold and the maximum are bounded by the schema
+func validateAutoExpand(ae *ipamv1alpha1.IpamAutoExpand) error {
+	if ae == nil {
+		return nil
+	}
+	var af string
+	for _, tag := range ae.Selector {
+		if tag.Key != nil && *tag.Key == ipamv1alpha1.KeyAddressFamily && tag.Value != nil {
+			af = *tag.Value
+		}
+	}
+	max, ok := maxPrefixLength[af]
+	if !ok {
+		return fmt.Errorf("auto-expand selector %s not provided or unknown, %s: %s", ipamv1alpha1.KeyAddressFamily, ipamv1alpha1.KeyAddressFamily, af)
+	}
+	if ae.PrefixLength == nil || *ae.PrefixLength > max {
+		return fmt.Errorf("auto-expand prefix-length not provided or out of bounds for the address-family, address-family: %s, max: %d", af, max)
+	}
+	return nil
+}
+
+// validateOverlap checks the prefix is not a duplicate of another prefix of the
+// network instance and only overlaps with the other prefixes by nesting, such
+// that a pool can be defined inside an aggregate or a parent pool
+func validateOverlap(ctx context.Context, c client.Reader, cr *ipamv1alpha1.IpamNetworkInstanceIpPrefix, p netaddr.IPPrefix) error {
+	ipps := &ipamv1alpha1.IpamNetworkInstanceIpPrefixList{}
+	if err := c.List(ctx, ipps, client.InNamespace(cr.GetNamespace())); err != nil {
+		return errors.Wrap(err, "cannot list ip prefixes")
+	}
+	for _, ipp := range ipps.GetIpPrefixes() {
+		if ipp.GetName() == cr.GetName() ||
+			ipp.GetIpamName() != cr.GetIpamName() ||
+			ipp.GetNetworkInstanceName() != cr.GetNetworkInstanceName() ||
+			ipp.GetDeletionTimestamp() != nil {
+			continue
+		}
+		other, err := netaddr.ParseIPPrefix(ipp.GetIpPrefix())
+		if err != nil {
+			continue
+		}
+		switch {
+		case p == other:
+			return fmt.Errorf("prefix %s already exists as %s", p, ipp.GetName())
+		case nested(p, other) || nested(other, p):
+			// a pool inside an aggregate or an aggregate around its pools
+		case p.Overlaps(other):
+			return fmt.Errorf("prefix %s partially overlaps with prefix %s of %s", p, other, ipp.GetName())
+		}
+	}
+	return nil
+}
+
+// nested reports if the prefix p is contained in the prefix of parent
+func nested(p, parent netaddr.IPPrefix) bool {
+	return p.Bits() >= parent.Bits() && parent.Contains(p.IP())
+}
+
+// parsePrefix parses a prefix that has no host bits set
+func parsePrefix(s string) (netaddr.IPPrefix, error) {
+	p, err := netaddr.ParseIPPrefix(s)
+	if err != nil {
+		return netaddr.IPPrefix{}, errors.Wrap(err, "cannot parse ip prefix")
+	}
+	if p.Masked() != p {
+		return netaddr.IPPrefix{}, fmt.Errorf("ip prefix has host bits set, prefix: %s, expected: %s", p, p.Masked())
+	}
+	return p, nil
+}
+
+// addressFamily returns the address family of the prefix
+func addressFamily(p netaddr.IPPrefix) string {
+	if p.IP().Is4() {
+		return string(ipamv1alpha1.AddressFamilyIpv4)
+	}
+	return string(ipamv1alpha1.AddressFamilyIpv6)
+}
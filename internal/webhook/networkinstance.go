@@ -0,0 +1,91 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:webhook:path=/mutate-ipam-nddr-yndd-io-v1alpha1-ipamnetworkinstance,mutating=true,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=ipamnetworkinstances,verbs=create;update,versions=v1alpha1,name=mipamnetworkinstance.ipam.nddr.yndd.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-ipam-nddr-yndd-io-v1alpha1-ipamnetworkinstance,mutating=false,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=ipamnetworkinstances,verbs=create;update,versions=v1alpha1,name=vipamnetworkinstance.ipam.nddr.yndd.io,admissionReviewVersions=v1
+
+// maxPrefixLength is the length of an address per address family
+var maxPrefixLength = map[string]uint32{
+	string(ipamv1alpha1.AddressFamilyIpv4): 32,
+	string(ipamv1alpha1.AddressFamilyIpv6): 128,
+}
+
+func newIpamNetworkInstance() client.Object { return &ipamv1alpha1.IpamNetworkInstance{} }
+
+func defaultIpamNetworkInstance(obj client.Object) {
+	cr := obj.(*ipamv1alpha1.IpamNetworkInstance)
+	if cr.Spec.IpamNetworkInstance == nil {
+		cr.Spec.IpamNetworkInstance = &ipamv1alpha1.IpamIpamNetworkInstance{}
+	}
+	ni := cr.Spec.IpamNetworkInstance
+	if ni.AdminState == nil {
+		ni.AdminState = utils.StringPtr("enable")
+	}
+	if ni.AllocationStrategy == nil {
+		ni.AllocationStrategy = utils.StringPtr("first-available")
+	}
+	if ni.Name == nil {
+		ni.Name = utils.StringPtr("default")
+	}
+}
+
+func validateIpamNetworkInstance(ctx context.Context, c client.Reader, obj, old client.Object) error {
+	cr := obj.(*ipamv1alpha1.IpamNetworkInstance)
+	if cr.Spec.IpamNetworkInstance == nil {
+		return fmt.Errorf("network-instance not provided")
+	}
+	for purpose, dpl := range cr.Spec.IpamNetworkInstance.DefaultPrefixLength {
+		if dpl == nil {
+			continue
+		}
+		for af, pl := range dpl.AddressFamily {
+			max, ok := maxPrefixLength[af]
+			if !ok {
+				return fmt.Errorf("default-prefix-length has an unknown address-family, purpose: %s, address-family: %s", purpose, af)
+			}
+			if pl == nil || *pl > max {
+				return fmt.Errorf("default-prefix-length out of bounds for the address-family, purpose: %s, address-family: %s, max: %d", purpose, af, max)
+			}
+		}
+	}
+	if cr.GetQuarantinePeriod() < 0 {
+		return fmt.Errorf("quarantine-period is negative: %s", cr.GetQuarantinePeriod())
+	}
+	return validateCapacityThreshold(cr.Spec.IpamNetworkInstance.CapacityThreshold)
+}
+
+// validateCapacityThreshold checks the warning threshold does not exceed the
+// critical threshold
+func validateCapacityThreshold(t *ipamv1alpha1.IpamCapacityThreshold) error {
+	if t == nil || t.Warning == nil || t.Critical == nil {
+		return nil
+	}
+	if *t.Warning > *t.Critical {
+		return fmt.Errorf("capacity-threshold warning %d exceeds critical %d", *t.Warning, *t.Critical)
+	}
+	return nil
+}
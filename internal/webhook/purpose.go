@@ -0,0 +1,103 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:webhook:path=/mutate-ipam-nddr-yndd-io-v1alpha1-ipampurpose,mutating=true,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=ipampurposes,verbs=create;update,versions=v1alpha1,name=mipampurpose.ipam.nddr.yndd.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-ipam-nddr-yndd-io-v1alpha1-ipampurpose,mutating=false,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=ipampurposes,verbs=create;update,versions=v1alpha1,name=vipampurpose.ipam.nddr.yndd.io,admissionReviewVersions=v1
+
+func newIpamPurpose() client.Object { return &ipamv1alpha1.IpamPurpose{} }
+
+func defaultIpamPurpose(obj client.Object) {}
+
+// validateIpamPurpose checks the prefix lengths of every address family are
+// ordered as min <= default <= max and fit in the address family
+func validateIpamPurpose(ctx context.Context, c client.Reader, obj, old client.Object) error {
+	cr := obj.(*ipamv1alpha1.IpamPurpose)
+	if len(cr.GetAddressFamilies()) == 0 {
+		return fmt.Errorf("address-family not provided, purpose: %s", cr.GetPurposeName())
+	}
+	for _, af := range cr.GetAddressFamilies() {
+		max, ok := maxPrefixLength[af]
+		if !ok {
+			return fmt.Errorf("unknown address-family, purpose: %s, address-family: %s", cr.GetPurposeName(), af)
+		}
+		// unset bounds do not constrain the prefix length
+		lower, upper := uint32(0), max
+		if pl := cr.GetMinPrefixLength(af); pl != nil {
+			lower = *pl
+		}
+		if pl := cr.GetMaxPrefixLength(af); pl != nil {
+			upper = *pl
+		}
+		if upper > max || lower > upper {
+			return fmt.Errorf("prefix length bounds out of order, purpose: %s, address-family: %s, min: %d, max: %d", cr.GetPurposeName(), af, lower, upper)
+		}
+		if pl := cr.GetDefaultPrefixLength(af); pl != nil && (*pl < lower || *pl > upper) {
+			return fmt.Errorf("default prefix length %d outside the bounds, purpose: %s, address-family: %s, min: %d, max: %d", *pl, cr.GetPurposeName(), af, lower, upper)
+		}
+	}
+	return nil
+}
+
+// getPurpose returns the purpose from the catalogue, a purpose that is not in
+// the catalogue is not constrained
+func getPurpose(ctx context.Context, c client.Reader, name string) (ipamv1alpha1.Pu, bool, error) {
+	pu := &ipamv1alpha1.IpamPurpose{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, pu); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, errors.Wrap(err, "cannot get purpose")
+	}
+	return pu, true, nil
+}
+
+// validatePurpose checks the address family is allowed by the purpose in the
+// catalogue, and the prefix length, when not nil, is within its bounds
+func validatePurpose(ctx context.Context, c client.Reader, purpose, af string, pl *uint32) error {
+	if purpose == "" {
+		return nil
+	}
+	pu, ok, err := getPurpose(ctx, c, purpose)
+	if err != nil || !ok {
+		return err
+	}
+	if !pu.HasAddressFamily(af) {
+		return fmt.Errorf("address-family %s not allowed for purpose %s, allowed: %v", af, purpose, pu.GetAddressFamilies())
+	}
+	if pl == nil {
+		return nil
+	}
+	if min := pu.GetMinPrefixLength(af); min != nil && *pl < *min {
+		return fmt.Errorf("prefix length %d below the minimum %d of purpose %s", *pl, *min, purpose)
+	}
+	if max := pu.GetMaxPrefixLength(af); max != nil && *pl > *max {
+		return fmt.Errorf("prefix length %d above the maximum %d of purpose %s", *pl, *max, purpose)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:webhook:path=/mutate-ipam-nddr-yndd-io-v1alpha1-ipamquota,mutating=true,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=ipamquotas,verbs=create;update,versions=v1alpha1,name=mipamquota.ipam.nddr.yndd.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-ipam-nddr-yndd-io-v1alpha1-ipamquota,mutating=false,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=ipamquotas,verbs=create;update,versions=v1alpha1,name=vipamquota.ipam.nddr.yndd.io,admissionReviewVersions=v1
+
+func newIpamQuota() client.Object { return &ipamv1alpha1.IpamQuota{} }
+
+func defaultIpamQuota(obj client.Object) {}
+
+// validateIpamQuota checks the quota has a limit and the purpose and
+// source-tag can be matched against the labels of the allocations
+func validateIpamQuota(ctx context.Context, c client.Reader, obj, old client.Object) error {
+	cr := obj.(*ipamv1alpha1.IpamQuota)
+	if cr.GetMaxAllocations() == nil && cr.GetMaxAddresses() == nil {
+		return fmt.Errorf("max-allocations or max-addresses not provided, quota: %s", cr.GetName())
+	}
+	l := cr.GetSourceTag()
+	if purpose := cr.GetPurpose(); purpose != "" {
+		if _, ok := l[ipamv1alpha1.KeyPurpose]; ok {
+			return fmt.Errorf("purpose provided as purpose and source-tag, quota: %s", cr.GetName())
+		}
+		l[ipamv1alpha1.KeyPurpose] = purpose
+	}
+	for key, val := range l {
+		if _, err := labels.NewRequirement(key, selection.In, []string{val}); err != nil {
+			return fmt.Errorf("invalid source-tag, quota: %s, %s", cr.GetName(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	ipamv1alpha1 "github.com/yndd/nddr-ipam-registry/apis/ipam/v1alpha1"
+	"inet.af/netaddr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:webhook:path=/mutate-ipam-nddr-yndd-io-v1alpha1-register,mutating=true,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=registers,verbs=create;update,versions=v1alpha1,name=mregister.ipam.nddr.yndd.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-ipam-nddr-yndd-io-v1alpha1-register,mutating=false,failurePolicy=fail,sideEffects=None,groups=ipam.nddr.yndd.io,resources=registers,verbs=create;update,versions=v1alpha1,name=vregister.ipam.nddr.yndd.io,admissionReviewVersions=v1
+
+func newRegister() client.Object { return &ipamv1alpha1.Register{} }
+
+// defaultRegister derives the address-family from the selector or a
+// match-expression selecting a single address-family, since the
+// address-family of the spec is otherwise defaulted to ipv4 by the crd
+func defaultRegister(obj client.Object) {
+	cr := obj.(*ipamv1alpha1.Register)
+	if cr.Spec.Register == nil {
+		return
+	}
+	if afs := ipamv1alpha1.SelectorValues(cr.GetSelector(), cr.GetMatchExpressions(), ipamv1alpha1.KeyAddressFamily); len(afs) == 1 {
+		cr.Spec.Register.AddressFamily = utils.StringPtr(afs[0])
+	}
+}
+
+// validateRegister checks the selector keys that are required for an
+// allocation, the purpose, address-family and ip-prefix can change after
+// allocation since the register is reallocated
+func validateRegister(ctx context.Context, c client.Reader, obj, old client.Object) error {
+	cr := obj.(*ipamv1alpha1.Register)
+	if cr.Spec.Register == nil {
+		return fmt.Errorf("register not provided")
+	}
+	if cr.GetIpamName() == "" || cr.GetNetworkInstanceName() == "" {
+		return fmt.Errorf("registry-name or network-instance-name not provided and not derivable from the register name: %s", cr.GetName())
+	}
+	if old != nil {
+		o := old.(*ipamv1alpha1.Register)
+		if _, ok := o.HasIpPrefix(); ok && (o.GetIpamName() != cr.GetIpamName() || o.GetNetworkInstanceName() != cr.GetNetworkInstanceName()) {
+			return fmt.Errorf("registry-name and network-instance-name are immutable once allocated")
+		}
+	}
+	if c := cr.GetConsumer(); c != nil && c.ApiVersion != nil {
+		if _, err := schema.ParseGroupVersion(*c.ApiVersion); err != nil {
+			return errors.Wrap(err, "cannot parse consumer api-version")
+		}
+	}
+	// the purpose and address-family are in the selector or else selected
+	// with an In match-expression
+	selector := cr.GetSelector()
+	exprs := cr.GetMatchExpressions()
+	purposes := ipamv1alpha1.SelectorValues(selector, exprs, ipamv1alpha1.KeyPurpose)
+	if len(purposes) == 0 || purposes[0] == "" {
+		return fmt.Errorf("selector %s not provided", ipamv1alpha1.KeyPurpose)
+	}
+	afs := ipamv1alpha1.SelectorValues(selector, exprs, ipamv1alpha1.KeyAddressFamily)
+	if len(afs) == 0 {
+		return fmt.Errorf("selector %s not provided", ipamv1alpha1.KeyAddressFamily)
+	}
+	for _, af := range afs {
+		if _, ok := maxPrefixLength[af]; !ok {
+			return fmt.Errorf("selector %s unknown, %s: %s", ipamv1alpha1.KeyAddressFamily, ipamv1alpha1.KeyAddressFamily, af)
+		}
+	}
+	if len(cr.GetSourceTag()) == 0 {
+		return fmt.Errorf("source-tag not provided, it identifies the owner of the allocation")
+	}
+	if _, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{MatchExpressions: exprs}); err != nil {
+		return errors.Wrap(err, "invalid match-expressions")
+	}
+	var pl *uint32
+	if prefix := cr.GetIpPrefix(); prefix != "" {
+		p, err := netaddr.ParseIPPrefix(prefix)
+		if err != nil {
+			return errors.Wrap(err, "cannot parse ip prefix")
+		}
+		af := addressFamily(p)
+		if !contains(afs, af) {
+			return fmt.Errorf("ip-prefix %s does not match the address-family %s", prefix, strings.Join(afs, ","))
+		}
+		afs = []string{af}
+		pl = utils.Uint32Ptr(uint32(p.Bits()))
+	}
+	// every purpose allows one of the address families
+	for _, purpose := range purposes {
+		var err error
+		for _, af := range afs {
+			if err = validatePurpose(ctx, c, purpose, af, pl); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
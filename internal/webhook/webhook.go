@@ -0,0 +1,129 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	admissionv1 "k8s.io/api/admission/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// validateFn validates the object of a create or update, old is nil on create
+type validateFn func(ctx context.Context, c client.Reader, obj, old client.Object) error
+
+// defaultFn sets the defaults of the object
+type defaultFn func(obj client.Object)
+
+type kind struct {
+	name      string
+	newObject func() client.Object
+	validate  validateFn
+	defaults  defaultFn
+}
+
+var kinds = []kind{
+	{name: "ipam", newObject: newIpam, validate: validateIpam, defaults: defaultIpam},
+	{name: "ipamnetworkinstance", newObject: newIpamNetworkInstance, validate: validateIpamNetworkInstance, defaults: defaultIpamNetworkInstance},
+	{name: "ipamnetworkinstanceipprefix", newObject: newIpamNetworkInstanceIpPrefix, validate: validateIpamNetworkInstanceIpPrefix, defaults: defaultIpamNetworkInstanceIpPrefix},
+	{name: "register", newObject: newRegister, validate: validateRegister, defaults: defaultRegister},
+	{name: "ipampurpose", newObject: newIpamPurpose, validate: validateIpamPurpose, defaults: defaultIpamPurpose},
+	{name: "ipamquota", newObject: newIpamQuota, validate: validateIpamQuota, defaults: defaultIpamQuota},
+}
+
+// Setup registers the validating and defaulting webhooks of the ipam
+// resources with the webhook server of the manager
+func Setup(mgr ctrl.Manager, log logging.Logger) error {
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	server := mgr.GetWebhookServer()
+	for _, k := range kinds {
+		server.Register("/validate-ipam-nddr-yndd-io-v1alpha1-"+k.name, &webhook.Admission{Handler: &validator{
+			log:       log.WithValues("webhook", "validate", "kind", k.name),
+			client:    mgr.GetAPIReader(),
+			decoder:   decoder,
+			newObject: k.newObject,
+			validate:  k.validate,
+		}})
+		server.Register("/mutate-ipam-nddr-yndd-io-v1alpha1-"+k.name, &webhook.Admission{Handler: &defaulter{
+			log:       log.WithValues("webhook", "mutate", "kind", k.name),
+			decoder:   decoder,
+			newObject: k.newObject,
+			defaults:  k.defaults,
+		}})
+	}
+	return nil
+}
+
+type validator struct {
+	log       logging.Logger
+	client    client.Reader
+	decoder   *admission.Decoder
+	newObject func() client.Object
+	validate  validateFn
+}
+
+func (v *validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obj := v.newObject()
+	if err := v.decoder.Decode(req, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old client.Object
+	if req.Operation == admissionv1.Update {
+		old = v.newObject()
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		// an object that is being deleted only changes its finalizers
+		if obj.GetDeletionTimestamp() != nil {
+			return admission.Allowed("")
+		}
+	}
+	if err := v.validate(ctx, v.client, obj, old); err != nil {
+		v.log.Debug("denied", "name", obj.GetName(), "namespace", obj.GetNamespace(), "error", err)
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+type defaulter struct {
+	log       logging.Logger
+	decoder   *admission.Decoder
+	newObject func() client.Object
+	defaults  defaultFn
+}
+
+func (d *defaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obj := d.newObject()
+	if err := d.decoder.Decode(req, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	d.defaults(obj)
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, b)
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2021 NDDO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ipampb provides the ipam specific grpc service of the ipam registry.
+// The service reuses the messages of the nddo-grpc resource service, such that
+// clients and servers only need the resourcepb package for the payload.
+package ipampb
+
+// keys used in the data of the watch request and replies
+const (
+	// KeyNetworkInstance is the name of the IpamNetworkInstance to watch,
+	// all network instances of the namespace are watched when omitted
+	KeyNetworkInstance = "network-instance"
+	// KeyResumeToken is the token of the last event seen by the client in the
+	// request, and the token of the event in the reply
+	KeyResumeToken = "resume-token"
+	// KeyEvent is the kind of the event: allocate, release, expire or synced
+	KeyEvent = "event"
+	// KeyIpPrefix is the prefix of the event
+	KeyIpPrefix = "ip-prefix"
+	// KeyLabels is the json encoded map of the labels of the prefix
+	KeyLabels = "labels"
+)